@@ -0,0 +1,10 @@
+// Package build holds the files shipped with the service.
+package build
+
+import "embed"
+
+// Errors holds the default errors catalog, errors.json, and its translations,
+// named like errors.ru.json.
+//
+//go:embed errors*.json
+var Errors embed.FS
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/definitions"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo"
+	"github.com/0x16F/cloud-users/internal/usecase/config"
+	"github.com/0x16F/cloud-users/internal/usecase/users"
+	"github.com/goccy/go-json"
+)
+
+// Imports users with password hashes exported from another system. The input file
+// has the same shape as the body of POST /api/v1/users/import, the per user results
+// are written to stdout.
+func main() {
+	path := flag.String("file", "", "path to the users export")
+	flag.Parse()
+
+	container, err := definitions.New()
+	if err != nil {
+		panic(err)
+	}
+
+	defer container.Delete()
+
+	ctx, _ := container.Get(definitions.ContextDef).(context.Context)
+	cfg, _ := container.Get(definitions.ConfigDef).(*config.Config)
+	log, _ := container.Get(definitions.LoggerDef).(logger.Logger)
+
+	if cfg.Database.Driver == repo.DriverMemory {
+		log.Fatalf("nothing to import into with the %s database driver", repo.DriverMemory)
+	}
+
+	if cfg.Database.Driver == repo.DriverPostgres {
+		if err = repo.Wait(ctx, log, cfg.Database); err != nil {
+			log.Fatalf("failed to connect to database: %v", err)
+		}
+	}
+
+	usersService, _ := container.Get(definitions.UsersServiceDef).(*users.Service)
+
+	data, err := os.ReadFile(*path)
+	if err != nil {
+		log.Fatalf("failed to read users export: %v", err)
+	}
+
+	var dto entity.UsersImportDTO
+
+	if err = json.Unmarshal(data, &dto); err != nil {
+		log.Fatalf("failed to unmarshal users export: %v", err)
+	}
+
+	results, err := usersService.ImportUsers(ctx, dto)
+	if err != nil {
+		log.Fatalf("failed to import users: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	if err = encoder.Encode(results); err != nil {
+		log.Fatalf("failed to write results: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 	"os/signal"
 	"syscall"
@@ -8,7 +9,9 @@ import (
 	"github.com/0x16F/cloud-common/pkg/logger"
 	"github.com/0x16F/cloud-users/internal/controller/httpsrv"
 	"github.com/0x16F/cloud-users/internal/definitions"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo"
 	"github.com/0x16F/cloud-users/internal/usecase/config"
+	"github.com/0x16F/cloud-users/internal/usecase/purge"
 )
 
 func main() {
@@ -17,10 +20,22 @@ func main() {
 		panic(err)
 	}
 
+	ctx, _ := container.Get(definitions.ContextDef).(context.Context)
 	cfg, _ := container.Get(definitions.ConfigDef).(*config.Config)
-	server, _ := container.Get(definitions.HTTPServerDef).(*httpsrv.Server)
 	log, _ := container.Get(definitions.LoggerDef).(logger.Logger)
 
+	// the database is needed to build the server, which runs the migrations
+	if cfg.Database.Driver == repo.DriverPostgres {
+		if err = repo.Wait(ctx, log, cfg.Database); err != nil {
+			log.Fatalf("failed to connect to database: %v", err)
+		}
+	}
+
+	server, _ := container.Get(definitions.HTTPServerDef).(*httpsrv.Server)
+	purgeJob, _ := container.Get(definitions.PurgeJobDef).(*purge.Job)
+
+	purgeJob.Start()
+
 	go func() {
 		if err := server.Start(cfg.App.Port); err != nil {
 			log.Fatalf("failed to start server: %v", err)
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/definitions"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo/users"
+	"github.com/0x16F/cloud-users/internal/usecase/config"
+	"github.com/0x16F/cloud-users/internal/usecase/identities"
+	"github.com/goccy/go-json"
+)
+
+// Normalizes the stored emails and usernames and reports the users that would collide
+// once they are compared case-insensitively. It has to run before the citext
+// migration, so it connects without applying migrations. The report is written to
+// stdout.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only report, don't update users")
+	flag.Parse()
+
+	container, err := definitions.New()
+	if err != nil {
+		panic(err)
+	}
+
+	defer container.Delete()
+
+	ctx, _ := container.Get(definitions.ContextDef).(context.Context)
+	log, _ := container.Get(definitions.LoggerDef).(logger.Logger)
+	cfg, _ := container.Get(definitions.ConfigDef).(*config.Config)
+
+	// the other drivers compare emails and usernames case-insensitively from the start
+	if cfg.Database.Driver != repo.DriverPostgres {
+		log.Fatalf("nothing to normalize with the %s database driver", cfg.Database.Driver)
+	}
+
+	if err := repo.Wait(ctx, log, cfg.Database); err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+
+	pool, err := repo.NewConnection(ctx, cfg.Database)
+	if err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+
+	defer pool.Close()
+
+	db := repo.NewDB(pool, nil, cfg.Database)
+
+	report, err := identities.New(log, users.NewRepo(db, db)).Normalize(ctx, *dryRun)
+	if err != nil {
+		log.Fatalf("failed to normalize identities: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	if err = encoder.Encode(report); err != nil {
+		log.Fatalf("failed to write report: %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package httpsrv
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/extractor"
+	cerrors "github.com/0x16F/cloud-users/internal/usecase/errors"
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	ErrorFormatJSON    = "json"
+	ErrorFormatProblem = "problem"
+
+	MIMEApplicationProblemJSON = "application/problem+json"
+
+	// problemCodePlaceholder is replaced by the code of the error in the problem type
+	problemCodePlaceholder = "{code}"
+)
+
+// Problem is an RFC 7807 problem details object. Code and Fields extend it with the
+// details of the catalog error.
+type Problem struct {
+	Type     string               `json:"type"`
+	Title    string               `json:"title"`
+	Status   int                  `json:"status"`
+	Detail   string               `json:"detail,omitempty"`
+	Instance string               `json:"instance"`
+	TraceID  string               `json:"trace_id"`
+	Code     int                  `json:"code,omitempty"`
+	Fields   []cerrors.FieldError `json:"fields,omitempty"`
+}
+
+// errorHandler answers with the catalog error as is, or with problem details when
+// they are the configured format or the client asks for them in Accept. A client
+// can still ask for plain JSON when problem details are the default. Catalog errors
+// are translated to the locale the client prefers.
+func errorHandler(cfg Config, errorsService ErrorsService) fiber.ErrorHandler {
+	offers := []string{fiber.MIMEApplicationJSON, MIMEApplicationProblemJSON}
+	if cfg.ErrorFormat == ErrorFormatProblem {
+		offers = []string{MIMEApplicationProblemJSON, fiber.MIMEApplicationJSON}
+	}
+
+	return func(c *fiber.Ctx, err error) error {
+		status := fiber.StatusInternalServerError
+
+		var (
+			e  *cerrors.Error
+			fe *fiber.Error
+		)
+
+		switch {
+		case errors.As(err, &e):
+			if e.HttpCode != 0 {
+				status = e.HttpCode
+			}
+
+			e = localize(c, errorsService, e)
+			err = e
+		case errors.As(err, &fe):
+			status = fe.Code
+		}
+
+		if c.Accepts(offers...) == MIMEApplicationProblemJSON {
+			problem := newProblem(cfg, c, status, e, fe)
+
+			encoded, _ := json.Marshal(problem)
+
+			c.Set(fiber.HeaderContentType, MIMEApplicationProblemJSON)
+
+			return c.Status(status).Send(encoded)
+		}
+
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+
+		return c.Status(status).SendString(err.Error())
+	}
+}
+
+// newProblem describes the error of the catalog, or the error of fiber, as problem
+// details. Errors without a code keep their detail.
+func newProblem(cfg Config, c *fiber.Ctx, status int, e *cerrors.Error, fe *fiber.Error) Problem {
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Instance: c.Path(),
+		TraceID:  extractor.TraceID(c),
+	}
+
+	switch {
+	case e != nil && e.Code != 0:
+		problem.Type = strings.ReplaceAll(cfg.ProblemType, problemCodePlaceholder, strconv.Itoa(e.Code))
+		problem.Title = e.Message
+		problem.Detail = e.Description
+		problem.Code = e.Code
+		problem.Fields = e.Fields
+	case e != nil:
+		problem.Detail = e.Description
+		problem.Fields = e.Fields
+	case fe != nil:
+		problem.Detail = fe.Message
+	}
+
+	return problem
+}
+
+func localize(c *fiber.Ctx, errorsService ErrorsService, e *cerrors.Error) *cerrors.Error {
+	if e.Code == 0 {
+		return e
+	}
+
+	localized, ok := errorsService.GetErrorContext(c.Context(), e.Code).(*cerrors.Error)
+	if !ok {
+		return e
+	}
+
+	localized.Fields = e.Fields
+
+	return localized
+}
@@ -0,0 +1,126 @@
+package httpsrv
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	cerrors "github.com/0x16F/cloud-users/internal/usecase/errors"
+	"github.com/0x16F/cloud-users/pkg/codes"
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+)
+
+// the status the clients get for each code, a change here breaks them
+var statuses = map[int]int{
+	codes.InvalidBody:                fiber.StatusBadRequest,
+	codes.InvalidID:                  fiber.StatusBadRequest,
+	codes.InvalidEmail:               fiber.StatusBadRequest,
+	codes.InvalidUsername:            fiber.StatusBadRequest,
+	codes.InvalidPassword:            fiber.StatusBadRequest,
+	codes.InvalidOldPassword:         fiber.StatusBadRequest,
+	codes.InvalidNewPassword:         fiber.StatusBadRequest,
+	codes.InternalError:              fiber.StatusInternalServerError,
+	codes.InvalidQuery:               fiber.StatusBadRequest,
+	codes.UserNotFound:               fiber.StatusNotFound,
+	codes.EmailAlreadyExists:         fiber.StatusConflict,
+	codes.UsernameAlreadyExists:      fiber.StatusConflict,
+	codes.FeatureIsDisabled:          fiber.StatusForbidden,
+	codes.InvalidCredentials:         fiber.StatusUnauthorized,
+	codes.InvalidPasswordHash:        fiber.StatusBadRequest,
+	codes.InvalidToken:               fiber.StatusUnauthorized,
+	codes.Unauthorized:               fiber.StatusUnauthorized,
+	codes.InvalidRefreshToken:        fiber.StatusUnauthorized,
+	codes.SessionNotFound:            fiber.StatusNotFound,
+	codes.InvalidOTPCode:             fiber.StatusUnauthorized,
+	codes.TOTPAlreadyEnabled:         fiber.StatusConflict,
+	codes.TOTPNotEnabled:             fiber.StatusConflict,
+	codes.InvalidMFAToken:            fiber.StatusUnauthorized,
+	codes.InvalidWebAuthnCeremony:    fiber.StatusBadRequest,
+	codes.InvalidWebAuthnCredential:  fiber.StatusUnauthorized,
+	codes.WebAuthnCredentialNotFound: fiber.StatusNotFound,
+	codes.WebAuthnCredentialCloned:   fiber.StatusUnauthorized,
+	codes.WebAuthnNotEnabled:         fiber.StatusConflict,
+	codes.InvalidResetToken:          fiber.StatusBadRequest,
+	codes.EmailAlreadyVerified:       fiber.StatusConflict,
+	codes.InvalidVerificationToken:   fiber.StatusBadRequest,
+	codes.AccountLocked:              fiber.StatusForbidden,
+	codes.InvalidEmailChangeToken:    fiber.StatusBadRequest,
+	codes.ValidationFailed:           fiber.StatusBadRequest,
+	codes.TooManyAttempts:            fiber.StatusTooManyRequests,
+	codes.Forbidden:                  fiber.StatusForbidden,
+}
+
+// TestErrorStatus returns the error of every code from a handler and checks the
+// status of the response in both error formats.
+func TestErrorStatus(t *testing.T) {
+	errorsService, err := cerrors.New(logger.New("error"), "", "en")
+	if err != nil {
+		t.Fatalf("failed to load errors: %v", err)
+	}
+
+	cfg := Config{
+		ErrorFormat: ErrorFormatJSON,
+		ProblemType: "urn:cloud-users:error:{code}",
+	}
+
+	app := fiber.New(fiber.Config{
+		ErrorHandler: errorHandler(cfg, errorsService),
+	})
+
+	app.Get("/:code", func(c *fiber.Ctx) error {
+		code, _ := c.ParamsInt("code")
+
+		return errorsService.GetError(code)
+	})
+
+	for _, code := range codes.All() {
+		want, ok := statuses[code]
+		if !ok {
+			t.Errorf("code %d has no status to check", code)
+
+			continue
+		}
+
+		for _, accept := range []string{fiber.MIMEApplicationJSON, MIMEApplicationProblemJSON} {
+			req := httptest.NewRequest(fiber.MethodGet, "/"+strconv.Itoa(code), nil)
+			req.Header.Set(fiber.HeaderAccept, accept)
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("code %d: failed to send request: %v", code, err)
+			}
+
+			var body struct {
+				Code   int    `json:"code"`
+				Status int    `json:"status"`
+				Type   string `json:"type"`
+			}
+
+			err = json.NewDecoder(resp.Body).Decode(&body)
+
+			_ = resp.Body.Close()
+
+			if err != nil {
+				t.Fatalf("code %d: failed to decode %s body: %v", code, accept, err)
+			}
+
+			if resp.StatusCode != want {
+				t.Errorf("code %d: got status %d as %s, want %d", code, resp.StatusCode, accept, want)
+			}
+
+			if body.Code != code {
+				t.Errorf("code %d: got code %d in the %s body", code, body.Code, accept)
+			}
+
+			if accept == MIMEApplicationProblemJSON && body.Status != want {
+				t.Errorf("code %d: got status %d in the problem, want %d", code, body.Status, want)
+			}
+
+			if wantType := "urn:cloud-users:error:" + strconv.Itoa(code); accept == MIMEApplicationProblemJSON && body.Type != wantType {
+				t.Errorf("code %d: got type %q in the problem, want %q", code, body.Type, wantType)
+			}
+		}
+	}
+}
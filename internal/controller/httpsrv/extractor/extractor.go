@@ -5,12 +5,48 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
+const (
+	userDataKey = "user_data"
+	traceIDKey  = "trace_id"
+)
+
+// Store keeps the user data of a verified access token for the rest of the request.
+func Store(c *fiber.Ctx, data entity.UserData) {
+	c.Locals(userDataKey, data)
+}
+
+// Authenticated returns the user data of the verified access token, if any.
+func Authenticated(c *fiber.Ctx) (entity.UserData, bool) {
+	data, ok := c.Locals(userDataKey).(entity.UserData)
+
+	return data, ok
+}
+
+// Extract returns the user data of the verified access token, or the anonymous
+// user for requests without one. Headers are never trusted for the identity, a
+// client can send any of them.
 func Extract(c *fiber.Ctx) entity.UserData {
-	login := string(c.Request().Header.Peek("CD_USER_LOGIN"))
-	role := string(c.Request().Header.Peek("CD_USER_ROLE"))
+	data, _ := Authenticated(c)
 
-	return entity.UserData{
-		Login: login,
-		Role:  role,
+	return data
+}
+
+// Device describes the client that sent the request.
+func Device(c *fiber.Ctx) entity.Device {
+	return entity.Device{
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		IP:        c.IP(),
 	}
 }
+
+// StoreTraceID keeps the trace ID of the request for the rest of the request.
+func StoreTraceID(c *fiber.Ctx, traceID string) {
+	c.Locals(traceIDKey, traceID)
+}
+
+// TraceID returns the trace ID the request is logged and answered with.
+func TraceID(c *fiber.Ctx) string {
+	traceID, _ := c.Locals(traceIDKey).(string)
+
+	return traceID
+}
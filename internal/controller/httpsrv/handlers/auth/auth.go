@@ -0,0 +1,284 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/extractor"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/internal/usecase/tokens"
+	"github.com/0x16F/cloud-users/pkg/codes"
+	"github.com/gofiber/fiber/v2"
+)
+
+type UsersService interface {
+	Login(ctx context.Context, login string, password string, ip string) (entity.User, error)
+	GetUser(ctx context.Context, id uint64) (entity.User, error)
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token string, password string) error
+}
+
+type MFAService interface {
+	Methods(ctx context.Context, userID uint64) ([]string, error)
+	Verify(ctx context.Context, challenge entity.MFAChallenge, code string) error
+}
+
+type SessionsService interface {
+	CreateSession(ctx context.Context, user entity.User, device entity.Device) (entity.TokenPair, error)
+	Refresh(ctx context.Context, refreshToken string, device entity.Device) (entity.TokenPair, error)
+}
+
+type TokensService interface {
+	IssueChallenge(user entity.User) (entity.AccessToken, error)
+	ParseChallenge(token string) (entity.MFAChallenge, error)
+	JWKS() tokens.JWKS
+}
+
+type ErrorsService interface {
+	GetError(code int) error
+}
+
+type FeaturesService interface {
+	IsFeatureEnabled(c *fiber.Ctx, log logger.Logger, handlerName string) error
+}
+
+type ValidationService interface {
+	Validate(req any) error
+}
+
+type Handler struct {
+	log               logger.Logger
+	usersService      UsersService
+	sessionsService   SessionsService
+	mfaService        MFAService
+	tokensService     TokensService
+	errorsService     ErrorsService
+	featuresService   FeaturesService
+	validationService ValidationService
+}
+
+func NewHandler(
+	log logger.Logger,
+	usersService UsersService,
+	sessionsService SessionsService,
+	mfaService MFAService,
+	tokensService TokensService,
+	errorsService ErrorsService,
+	featuresService FeaturesService,
+	validationService ValidationService,
+) *Handler {
+	return &Handler{
+		log:               log,
+		usersService:      usersService,
+		sessionsService:   sessionsService,
+		mfaService:        mfaService,
+		tokensService:     tokensService,
+		errorsService:     errorsService,
+		featuresService:   featuresService,
+		validationService: validationService,
+	}
+}
+
+func (h *Handler) Login(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "Login",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "login"); err != nil {
+		return err
+	}
+
+	var req LoginReq
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Errorf("failed to parse request body: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidBody)
+	}
+
+	user, err := h.usersService.Login(c.Context(), req.Login, req.Password, c.IP())
+	if err != nil {
+		log.Errorf("failed to login: %v", err)
+
+		return err
+	}
+
+	mfaMethods, err := h.mfaService.Methods(c.Context(), user.ID)
+	if err != nil {
+		log.Errorf("failed to check two-factor authentication: %v", err)
+
+		return err
+	}
+
+	if len(mfaMethods) != 0 {
+		challenge, err := h.tokensService.IssueChallenge(user)
+		if err != nil {
+			log.Errorf("failed to issue mfa token: %v", err)
+
+			return h.errorsService.GetError(codes.InternalError)
+		}
+
+		return c.JSON(MFARequiredResp{
+			MFARequired: true,
+			MFAToken:    challenge.Token,
+			MFAMethods:  mfaMethods,
+			ExpiresIn:   int64(time.Until(challenge.ExpiresAt).Seconds()),
+		})
+	}
+
+	pair, err := h.sessionsService.CreateSession(c.Context(), user, extractor.Device(c))
+	if err != nil {
+		log.Errorf("failed to create session: %v", err)
+
+		return err
+	}
+
+	return c.JSON(LoginResp{
+		User:       entity.NewUserAccountDTO(user),
+		TokensResp: NewTokensResp(pair),
+	})
+}
+
+// LoginMFA completes a login that requires a second factor.
+func (h *Handler) LoginMFA(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "LoginMFA",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "login_mfa"); err != nil {
+		return err
+	}
+
+	var req LoginMFAReq
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Errorf("failed to parse request body: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidBody)
+	}
+
+	challenge, err := h.tokensService.ParseChallenge(req.MFAToken)
+	if err != nil {
+		log.Warnf("failed to parse mfa token: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidMFAToken)
+	}
+
+	if err = h.mfaService.Verify(c.Context(), challenge, req.Code); err != nil {
+		log.Errorf("failed to verify second factor: %v", err)
+
+		return err
+	}
+
+	user, err := h.usersService.GetUser(c.Context(), challenge.UserID)
+	if err != nil {
+		log.Errorf("failed to get user: %v", err)
+
+		return err
+	}
+
+	pair, err := h.sessionsService.CreateSession(c.Context(), user, extractor.Device(c))
+	if err != nil {
+		log.Errorf("failed to create session: %v", err)
+
+		return err
+	}
+
+	return c.JSON(LoginResp{
+		User:       entity.NewUserAccountDTO(user),
+		TokensResp: NewTokensResp(pair),
+	})
+}
+
+func (h *Handler) Refresh(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "Refresh",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "refresh"); err != nil {
+		return err
+	}
+
+	var req RefreshReq
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Errorf("failed to parse request body: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidBody)
+	}
+
+	pair, err := h.sessionsService.Refresh(c.Context(), req.RefreshToken, extractor.Device(c))
+	if err != nil {
+		log.Errorf("failed to refresh session: %v", err)
+
+		return err
+	}
+
+	return c.JSON(NewTokensResp(pair))
+}
+
+// RequestPasswordReset answers the same way whether the email is registered or not.
+func (h *Handler) RequestPasswordReset(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "RequestPasswordReset",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "request_password_reset"); err != nil {
+		return err
+	}
+
+	var req PasswordResetRequestReq
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Errorf("failed to parse request body: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidBody)
+	}
+
+	if err := h.validationService.Validate(req); err != nil {
+		return err
+	}
+
+	if err := h.usersService.RequestPasswordReset(c.Context(), req.Email); err != nil {
+		log.Errorf("failed to request password reset: %v", err)
+
+		return err
+	}
+
+	return nil
+}
+
+func (h *Handler) ResetPassword(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "ResetPassword",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "reset_password"); err != nil {
+		return err
+	}
+
+	var req PasswordResetReq
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Errorf("failed to parse request body: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidBody)
+	}
+
+	if err := h.validationService.Validate(req); err != nil {
+		return err
+	}
+
+	if err := h.usersService.ResetPassword(c.Context(), req.Token, req.Password); err != nil {
+		log.Errorf("failed to reset password: %v", err)
+
+		return err
+	}
+
+	return nil
+}
+
+func (h *Handler) JWKS(c *fiber.Ctx) error {
+	return c.JSON(h.tokensService.JWKS())
+}
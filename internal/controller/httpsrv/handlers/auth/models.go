@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/0x16F/cloud-users/internal/entity"
+)
+
+type LoginReq struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+type LoginMFAReq struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type RefreshReq struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type PasswordResetRequestReq struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type PasswordResetReq struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,password"`
+}
+
+type TokensResp struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type LoginResp struct {
+	TokensResp
+	User entity.UserAccountDTO `json:"user"`
+}
+
+type MFARequiredResp struct {
+	MFARequired bool     `json:"mfa_required"`
+	MFAToken    string   `json:"mfa_token"`
+	MFAMethods  []string `json:"mfa_methods"`
+	ExpiresIn   int64    `json:"expires_in"`
+}
+
+func NewTokensResp(pair entity.TokenPair) TokensResp {
+	return TokensResp{
+		AccessToken:  pair.AccessToken.Token,
+		RefreshToken: pair.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(time.Until(pair.AccessToken.ExpiresAt).Seconds()),
+	}
+}
@@ -0,0 +1,44 @@
+package catalog
+
+import (
+	"context"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	cerrors "github.com/0x16F/cloud-users/internal/usecase/errors"
+	"github.com/gofiber/fiber/v2"
+)
+
+type ErrorsService interface {
+	Catalog(ctx context.Context) []cerrors.Entry
+}
+
+type FeaturesService interface {
+	IsFeatureEnabled(c *fiber.Ctx, log logger.Logger, handlerName string) error
+}
+
+type Handler struct {
+	log             logger.Logger
+	errorsService   ErrorsService
+	featuresService FeaturesService
+}
+
+func NewHandler(log logger.Logger, errorsService ErrorsService, featuresService FeaturesService) *Handler {
+	return &Handler{
+		log:             log,
+		errorsService:   errorsService,
+		featuresService: featuresService,
+	}
+}
+
+// GetErrors returns the effective errors catalog, in the locale of Accept-Language.
+func (h *Handler) GetErrors(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "GetErrors",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "get_errors"); err != nil {
+		return err
+	}
+
+	return c.JSON(h.errorsService.Catalog(c.Context()))
+}
@@ -0,0 +1,121 @@
+package lockouts
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/extractor"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/pkg/codes"
+	"github.com/gofiber/fiber/v2"
+)
+
+type ThrottleService interface {
+	UnlockUser(ctx context.Context, userID uint64) error
+	UnlockIP(ctx context.Context, ip string) error
+}
+
+type ErrorsService interface {
+	GetError(code int) error
+}
+
+type FeaturesService interface {
+	IsFeatureEnabled(c *fiber.Ctx, log logger.Logger, handlerName string) error
+}
+
+type Handler struct {
+	log             logger.Logger
+	throttleService ThrottleService
+	errorsService   ErrorsService
+	featuresService FeaturesService
+}
+
+func NewHandler(
+	log logger.Logger,
+	throttleService ThrottleService,
+	errorsService ErrorsService,
+	featuresService FeaturesService,
+) *Handler {
+	return &Handler{
+		log:             log,
+		throttleService: throttleService,
+		errorsService:   errorsService,
+		featuresService: featuresService,
+	}
+}
+
+// UnlockUser clears the failed attempts and the lockout of an account.
+func (h *Handler) UnlockUser(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "UnlockUser",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "unlock_user_lockout"); err != nil {
+		return err
+	}
+
+	userData, ok := extractor.Authenticated(c)
+	if !ok {
+		return h.errorsService.GetError(codes.Unauthorized)
+	}
+
+	if userData.Role != entity.RoleAdmin {
+		log.Warnf("user %d with role %s is not allowed to unlock accounts", userData.ID, userData.Role)
+
+		return h.errorsService.GetError(codes.Forbidden)
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		log.Errorf("failed to parse id: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidID)
+	}
+
+	if err = h.throttleService.UnlockUser(c.Context(), id); err != nil {
+		log.Errorf("failed to unlock user: %v", err)
+
+		return err
+	}
+
+	return nil
+}
+
+// UnlockIP clears the failed attempts and the lockout of a client IP.
+func (h *Handler) UnlockIP(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "UnlockIP",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "unlock_ip_lockout"); err != nil {
+		return err
+	}
+
+	userData, ok := extractor.Authenticated(c)
+	if !ok {
+		return h.errorsService.GetError(codes.Unauthorized)
+	}
+
+	if userData.Role != entity.RoleAdmin {
+		log.Warnf("user %d with role %s is not allowed to unlock IPs", userData.ID, userData.Role)
+
+		return h.errorsService.GetError(codes.Forbidden)
+	}
+
+	ip := net.ParseIP(c.Params("ip"))
+	if ip == nil {
+		log.Errorf("failed to parse ip %q", c.Params("ip"))
+
+		return h.errorsService.GetError(codes.InvalidQuery)
+	}
+
+	if err := h.throttleService.UnlockIP(c.Context(), ip.String()); err != nil {
+		log.Errorf("failed to unlock ip: %v", err)
+
+		return err
+	}
+
+	return nil
+}
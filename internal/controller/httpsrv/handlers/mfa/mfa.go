@@ -0,0 +1,170 @@
+package mfa
+
+import (
+	"context"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/extractor"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/pkg/codes"
+	"github.com/gofiber/fiber/v2"
+)
+
+type MFAService interface {
+	EnrollTOTP(ctx context.Context, userID uint64) (entity.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, userID uint64, code string) ([]string, error)
+	RegenerateRecoveryCodes(ctx context.Context, userID uint64, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, userID uint64, password string, ip string) error
+}
+
+type ErrorsService interface {
+	GetError(code int) error
+}
+
+type FeaturesService interface {
+	IsFeatureEnabled(c *fiber.Ctx, log logger.Logger, handlerName string) error
+}
+
+type Handler struct {
+	log             logger.Logger
+	mfaService      MFAService
+	errorsService   ErrorsService
+	featuresService FeaturesService
+}
+
+func NewHandler(
+	log logger.Logger,
+	mfaService MFAService,
+	errorsService ErrorsService,
+	featuresService FeaturesService,
+) *Handler {
+	return &Handler{
+		log:             log,
+		mfaService:      mfaService,
+		errorsService:   errorsService,
+		featuresService: featuresService,
+	}
+}
+
+func (h *Handler) EnrollTOTP(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "EnrollTOTP",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "enroll_totp"); err != nil {
+		return err
+	}
+
+	userData, ok := extractor.Authenticated(c)
+	if !ok {
+		return h.errorsService.GetError(codes.Unauthorized)
+	}
+
+	enrollment, err := h.mfaService.EnrollTOTP(c.Context(), userData.ID)
+	if err != nil {
+		log.Errorf("failed to enroll totp: %v", err)
+
+		return err
+	}
+
+	return c.JSON(enrollment)
+}
+
+func (h *Handler) ConfirmTOTP(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "ConfirmTOTP",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "confirm_totp"); err != nil {
+		return err
+	}
+
+	userData, ok := extractor.Authenticated(c)
+	if !ok {
+		return h.errorsService.GetError(codes.Unauthorized)
+	}
+
+	var req CodeReq
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Errorf("failed to parse request body: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidBody)
+	}
+
+	recoveryCodes, err := h.mfaService.ConfirmTOTP(c.Context(), userData.ID, req.Code)
+	if err != nil {
+		log.Errorf("failed to confirm totp: %v", err)
+
+		return err
+	}
+
+	return c.JSON(RecoveryCodesResp{
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+func (h *Handler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "RegenerateRecoveryCodes",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "regenerate_recovery_codes"); err != nil {
+		return err
+	}
+
+	userData, ok := extractor.Authenticated(c)
+	if !ok {
+		return h.errorsService.GetError(codes.Unauthorized)
+	}
+
+	var req CodeReq
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Errorf("failed to parse request body: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidBody)
+	}
+
+	recoveryCodes, err := h.mfaService.RegenerateRecoveryCodes(c.Context(), userData.ID, req.Code)
+	if err != nil {
+		log.Errorf("failed to regenerate recovery codes: %v", err)
+
+		return err
+	}
+
+	return c.JSON(RecoveryCodesResp{
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+func (h *Handler) DisableTOTP(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "DisableTOTP",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "disable_totp"); err != nil {
+		return err
+	}
+
+	userData, ok := extractor.Authenticated(c)
+	if !ok {
+		return h.errorsService.GetError(codes.Unauthorized)
+	}
+
+	var req DisableTOTPReq
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Errorf("failed to parse request body: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidBody)
+	}
+
+	if err := h.mfaService.DisableTOTP(c.Context(), userData.ID, req.Password, c.IP()); err != nil {
+		log.Errorf("failed to disable totp: %v", err)
+
+		return err
+	}
+
+	return nil
+}
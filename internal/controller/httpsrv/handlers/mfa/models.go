@@ -0,0 +1,13 @@
+package mfa
+
+type CodeReq struct {
+	Code string `json:"code"`
+}
+
+type DisableTOTPReq struct {
+	Password string `json:"password"`
+}
+
+type RecoveryCodesResp struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
@@ -0,0 +1,32 @@
+package passkeys
+
+import (
+	"encoding/json"
+
+	"github.com/0x16F/cloud-users/internal/entity"
+)
+
+type FinishRegistrationReq struct {
+	CeremonyID string          `json:"ceremony_id"`
+	Name       string          `json:"name"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+type FinishLoginReq struct {
+	CeremonyID string          `json:"ceremony_id"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+type BeginMFAReq struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+type FinishMFAReq struct {
+	MFAToken   string          `json:"mfa_token"`
+	CeremonyID string          `json:"ceremony_id"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+type GetCredentialsResp struct {
+	Credentials []entity.WebAuthnCredential `json:"credentials"`
+}
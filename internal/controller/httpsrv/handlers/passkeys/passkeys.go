@@ -0,0 +1,334 @@
+package passkeys
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/extractor"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/handlers/auth"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/pkg/codes"
+	"github.com/gofiber/fiber/v2"
+)
+
+type PasskeysService interface {
+	BeginRegistration(ctx context.Context, userID uint64) (entity.WebAuthnChallenge, error)
+	FinishRegistration(
+		ctx context.Context,
+		userID uint64,
+		ceremonyID string,
+		name string,
+		response []byte,
+	) (entity.WebAuthnCredential, error)
+	BeginLogin(ctx context.Context) (entity.WebAuthnChallenge, error)
+	FinishLogin(ctx context.Context, ceremonyID string, response []byte) (entity.User, error)
+	BeginMFA(ctx context.Context, userID uint64) (entity.WebAuthnChallenge, error)
+	FinishMFA(ctx context.Context, userID uint64, ceremonyID string, response []byte) error
+	GetCredentials(ctx context.Context, userID uint64) ([]entity.WebAuthnCredential, error)
+	DeleteCredential(ctx context.Context, userID uint64, id uint64) error
+}
+
+type UsersService interface {
+	GetUser(ctx context.Context, id uint64) (entity.User, error)
+}
+
+type SessionsService interface {
+	CreateSession(ctx context.Context, user entity.User, device entity.Device) (entity.TokenPair, error)
+}
+
+type TokensService interface {
+	ParseChallenge(token string) (entity.MFAChallenge, error)
+}
+
+type ErrorsService interface {
+	GetError(code int) error
+}
+
+type FeaturesService interface {
+	IsFeatureEnabled(c *fiber.Ctx, log logger.Logger, handlerName string) error
+}
+
+type Handler struct {
+	log             logger.Logger
+	passkeysService PasskeysService
+	usersService    UsersService
+	sessionsService SessionsService
+	tokensService   TokensService
+	errorsService   ErrorsService
+	featuresService FeaturesService
+}
+
+func NewHandler(
+	log logger.Logger,
+	passkeysService PasskeysService,
+	usersService UsersService,
+	sessionsService SessionsService,
+	tokensService TokensService,
+	errorsService ErrorsService,
+	featuresService FeaturesService,
+) *Handler {
+	return &Handler{
+		log:             log,
+		passkeysService: passkeysService,
+		usersService:    usersService,
+		sessionsService: sessionsService,
+		tokensService:   tokensService,
+		errorsService:   errorsService,
+		featuresService: featuresService,
+	}
+}
+
+func (h *Handler) BeginRegistration(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "BeginRegistration",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "webauthn_begin_registration"); err != nil {
+		return err
+	}
+
+	userData, ok := extractor.Authenticated(c)
+	if !ok {
+		return h.errorsService.GetError(codes.Unauthorized)
+	}
+
+	challenge, err := h.passkeysService.BeginRegistration(c.Context(), userData.ID)
+	if err != nil {
+		log.Errorf("failed to begin registration: %v", err)
+
+		return err
+	}
+
+	return c.JSON(challenge)
+}
+
+func (h *Handler) FinishRegistration(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "FinishRegistration",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "webauthn_finish_registration"); err != nil {
+		return err
+	}
+
+	userData, ok := extractor.Authenticated(c)
+	if !ok {
+		return h.errorsService.GetError(codes.Unauthorized)
+	}
+
+	var req FinishRegistrationReq
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Errorf("failed to parse request body: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidBody)
+	}
+
+	credential, err := h.passkeysService.FinishRegistration(
+		c.Context(),
+		userData.ID,
+		req.CeremonyID,
+		req.Name,
+		req.Credential,
+	)
+	if err != nil {
+		log.Errorf("failed to finish registration: %v", err)
+
+		return err
+	}
+
+	return c.JSON(credential)
+}
+
+// BeginLogin starts a passwordless login with a passkey.
+func (h *Handler) BeginLogin(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "BeginLogin",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "webauthn_begin_login"); err != nil {
+		return err
+	}
+
+	challenge, err := h.passkeysService.BeginLogin(c.Context())
+	if err != nil {
+		log.Errorf("failed to begin login: %v", err)
+
+		return err
+	}
+
+	return c.JSON(challenge)
+}
+
+func (h *Handler) FinishLogin(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "FinishLogin",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "webauthn_finish_login"); err != nil {
+		return err
+	}
+
+	var req FinishLoginReq
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Errorf("failed to parse request body: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidBody)
+	}
+
+	user, err := h.passkeysService.FinishLogin(c.Context(), req.CeremonyID, req.Credential)
+	if err != nil {
+		log.Errorf("failed to finish login: %v", err)
+
+		return err
+	}
+
+	return h.createSession(c, log, user)
+}
+
+// BeginMFA starts the assertion that completes a login requiring a second factor.
+func (h *Handler) BeginMFA(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "BeginMFA",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "webauthn_begin_mfa"); err != nil {
+		return err
+	}
+
+	var req BeginMFAReq
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Errorf("failed to parse request body: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidBody)
+	}
+
+	mfaChallenge, err := h.tokensService.ParseChallenge(req.MFAToken)
+	if err != nil {
+		log.Warnf("failed to parse mfa token: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidMFAToken)
+	}
+
+	challenge, err := h.passkeysService.BeginMFA(c.Context(), mfaChallenge.UserID)
+	if err != nil {
+		log.Errorf("failed to begin mfa: %v", err)
+
+		return err
+	}
+
+	return c.JSON(challenge)
+}
+
+func (h *Handler) FinishMFA(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "FinishMFA",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "webauthn_finish_mfa"); err != nil {
+		return err
+	}
+
+	var req FinishMFAReq
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Errorf("failed to parse request body: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidBody)
+	}
+
+	mfaChallenge, err := h.tokensService.ParseChallenge(req.MFAToken)
+	if err != nil {
+		log.Warnf("failed to parse mfa token: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidMFAToken)
+	}
+
+	if err = h.passkeysService.FinishMFA(c.Context(), mfaChallenge.UserID, req.CeremonyID, req.Credential); err != nil {
+		log.Errorf("failed to finish mfa: %v", err)
+
+		return err
+	}
+
+	user, err := h.usersService.GetUser(c.Context(), mfaChallenge.UserID)
+	if err != nil {
+		log.Errorf("failed to get user: %v", err)
+
+		return err
+	}
+
+	return h.createSession(c, log, user)
+}
+
+func (h *Handler) GetCredentials(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "GetCredentials",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "get_webauthn_credentials"); err != nil {
+		return err
+	}
+
+	userData, ok := extractor.Authenticated(c)
+	if !ok {
+		return h.errorsService.GetError(codes.Unauthorized)
+	}
+
+	credentials, err := h.passkeysService.GetCredentials(c.Context(), userData.ID)
+	if err != nil {
+		log.Errorf("failed to get credentials: %v", err)
+
+		return err
+	}
+
+	return c.JSON(GetCredentialsResp{
+		Credentials: credentials,
+	})
+}
+
+func (h *Handler) DeleteCredential(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "DeleteCredential",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "delete_webauthn_credential"); err != nil {
+		return err
+	}
+
+	userData, ok := extractor.Authenticated(c)
+	if !ok {
+		return h.errorsService.GetError(codes.Unauthorized)
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		log.Errorf("failed to parse id: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidID)
+	}
+
+	if err = h.passkeysService.DeleteCredential(c.Context(), userData.ID, id); err != nil {
+		log.Errorf("failed to delete credential: %v", err)
+
+		return err
+	}
+
+	return nil
+}
+
+func (h *Handler) createSession(c *fiber.Ctx, log logger.Logger, user entity.User) error {
+	pair, err := h.sessionsService.CreateSession(c.Context(), user, extractor.Device(c))
+	if err != nil {
+		log.Errorf("failed to create session: %v", err)
+
+		return err
+	}
+
+	return c.JSON(auth.LoginResp{
+		User:       entity.NewUserAccountDTO(user),
+		TokensResp: auth.NewTokensResp(pair),
+	})
+}
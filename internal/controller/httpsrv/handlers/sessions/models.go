@@ -0,0 +1,12 @@
+package sessions
+
+import "github.com/0x16F/cloud-users/internal/entity"
+
+type SessionResp struct {
+	entity.Session
+	Current bool `json:"current"`
+}
+
+type GetSessionsResp struct {
+	Sessions []SessionResp `json:"sessions"`
+}
@@ -0,0 +1,135 @@
+package sessions
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/extractor"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/pkg/codes"
+	"github.com/gofiber/fiber/v2"
+)
+
+type SessionsService interface {
+	GetSessions(ctx context.Context, userID uint64) ([]entity.Session, error)
+	RevokeSession(ctx context.Context, userID uint64, id uint64) error
+	RevokeSessions(ctx context.Context, userID uint64) error
+}
+
+type ErrorsService interface {
+	GetError(code int) error
+}
+
+type FeaturesService interface {
+	IsFeatureEnabled(c *fiber.Ctx, log logger.Logger, handlerName string) error
+}
+
+type Handler struct {
+	log             logger.Logger
+	sessionsService SessionsService
+	errorsService   ErrorsService
+	featuresService FeaturesService
+}
+
+func NewHandler(
+	log logger.Logger,
+	sessionsService SessionsService,
+	errorsService ErrorsService,
+	featuresService FeaturesService,
+) *Handler {
+	return &Handler{
+		log:             log,
+		sessionsService: sessionsService,
+		errorsService:   errorsService,
+		featuresService: featuresService,
+	}
+}
+
+func (h *Handler) GetSessions(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "GetSessions",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "get_sessions"); err != nil {
+		return err
+	}
+
+	userData, ok := extractor.Authenticated(c)
+	if !ok {
+		return h.errorsService.GetError(codes.Unauthorized)
+	}
+
+	sessions, err := h.sessionsService.GetSessions(c.Context(), userData.ID)
+	if err != nil {
+		log.Errorf("failed to get sessions: %v", err)
+
+		return err
+	}
+
+	resp := GetSessionsResp{
+		Sessions: make([]SessionResp, 0, len(sessions)),
+	}
+
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, SessionResp{
+			Session: session,
+			Current: session.ID == userData.SessionID,
+		})
+	}
+
+	return c.JSON(resp)
+}
+
+func (h *Handler) RevokeSession(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "RevokeSession",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "revoke_session"); err != nil {
+		return err
+	}
+
+	userData, ok := extractor.Authenticated(c)
+	if !ok {
+		return h.errorsService.GetError(codes.Unauthorized)
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		log.Errorf("failed to parse id: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidID)
+	}
+
+	if err = h.sessionsService.RevokeSession(c.Context(), userData.ID, id); err != nil {
+		log.Errorf("failed to revoke session: %v", err)
+
+		return err
+	}
+
+	return nil
+}
+
+func (h *Handler) RevokeSessions(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "RevokeSessions",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "revoke_sessions"); err != nil {
+		return err
+	}
+
+	userData, ok := extractor.Authenticated(c)
+	if !ok {
+		return h.errorsService.GetError(codes.Unauthorized)
+	}
+
+	if err := h.sessionsService.RevokeSessions(c.Context(), userData.ID); err != nil {
+		log.Errorf("failed to revoke sessions: %v", err)
+
+		return err
+	}
+
+	return nil
+}
@@ -4,24 +4,43 @@ import "github.com/0x16F/cloud-users/internal/entity"
 
 type UpdatePasswordReq struct {
 	OldPassword string `json:"old_password"`
-	NewPassword string `json:"new_password"`
+	NewPassword string `json:"new_password" validate:"required,new_password"`
 }
 
 type UpdateUsernameReq struct {
-	Username string `json:"username"`
+	Username string `json:"username" validate:"required,username"`
 }
 
 type UpdateEmailReq struct {
-	Email string `json:"email"`
+	Email string `json:"email" validate:"required,email"`
+}
+
+type GetUserReq struct {
+	IncludeDeleted bool `query:"include_deleted"`
 }
 
 type GetUsersReq struct {
-	Limit    int    `query:"limit"`
-	LastID   uint64 `query:"last_id"`
-	Username string `query:"username"`
-	Email    string `query:"email"`
+	Limit          int    `query:"limit"`
+	LastID         uint64 `query:"last_id"`
+	Username       string `query:"username"`
+	Email          string `query:"email"`
+	EmailVerified  *bool  `query:"email_verified"`
+	IncludeDeleted bool   `query:"include_deleted"`
+}
+
+type TokenReq struct {
+	Token string `json:"token"`
 }
 
 type GetUsersResp struct {
 	Users []entity.User `json:"users"`
 }
+
+// GetUserAccountsResp lists the users for admins.
+type GetUserAccountsResp struct {
+	Users []entity.UserAccountDTO `json:"users"`
+}
+
+type ImportUsersResp struct {
+	Users []entity.UserImportResult `json:"users"`
+}
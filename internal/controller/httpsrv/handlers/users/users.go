@@ -5,6 +5,7 @@ import (
 	"strconv"
 
 	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/extractor"
 	"github.com/0x16F/cloud-users/internal/entity"
 	"github.com/0x16F/cloud-users/pkg/codes"
 	"github.com/gofiber/fiber/v2"
@@ -12,12 +13,19 @@ import (
 
 type UsersService interface {
 	CreateUser(ctx context.Context, dto entity.UserCreateDTO) (entity.User, error)
-	GetUser(ctx context.Context, id uint64) (entity.User, error)
+	GetUserProfile(ctx context.Context, id uint64) (entity.User, error)
+	GetUserWithDeleted(ctx context.Context, id uint64) (entity.User, error)
 	GetUsers(ctx context.Context, params entity.GetUsersParams) ([]entity.User, error)
 	UpdateEmail(ctx context.Context, id uint64, email string) error
 	UpdateUsername(ctx context.Context, id uint64, username string) error
-	UpdatePassword(ctx context.Context, id uint64, oldPassword, newPassword string) error
+	UpdatePassword(ctx context.Context, id uint64, oldPassword, newPassword string, sessionID uint64, ip string) error
 	DeleteUser(ctx context.Context, id uint64) error
+	RestoreUser(ctx context.Context, id uint64) (entity.User, error)
+	ImportUsers(ctx context.Context, dto entity.UsersImportDTO) ([]entity.UserImportResult, error)
+	SendVerificationEmail(ctx context.Context, id uint64) error
+	VerifyEmail(ctx context.Context, token string) error
+	ConfirmEmailChange(ctx context.Context, token string) error
+	RevertEmailChange(ctx context.Context, token string) error
 }
 
 type ErrorsService interface {
@@ -28,11 +36,16 @@ type FeaturesService interface {
 	IsFeatureEnabled(c *fiber.Ctx, log logger.Logger, handlerName string) error
 }
 
+type ValidationService interface {
+	Validate(req any) error
+}
+
 type Handler struct {
-	log             logger.Logger
-	usersService    UsersService
-	errorsService   ErrorsService
-	featuresService FeaturesService
+	log               logger.Logger
+	usersService      UsersService
+	errorsService     ErrorsService
+	featuresService   FeaturesService
+	validationService ValidationService
 }
 
 func NewHandler(
@@ -40,12 +53,14 @@ func NewHandler(
 	usersService UsersService,
 	errorsService ErrorsService,
 	featuresService FeaturesService,
+	validationService ValidationService,
 ) *Handler {
 	return &Handler{
-		log:             log,
-		usersService:    usersService,
-		errorsService:   errorsService,
-		featuresService: featuresService,
+		log:               log,
+		usersService:      usersService,
+		errorsService:     errorsService,
+		featuresService:   featuresService,
+		validationService: validationService,
 	}
 }
 
@@ -66,6 +81,10 @@ func (h *Handler) CreateUser(c *fiber.Ctx) error {
 		return h.errorsService.GetError(codes.InvalidBody)
 	}
 
+	if err := h.validationService.Validate(req); err != nil {
+		return err
+	}
+
 	user, err := h.usersService.CreateUser(c.Context(), req)
 	if err != nil {
 		log.Errorf("failed to create user: %v", err)
@@ -73,7 +92,7 @@ func (h *Handler) CreateUser(c *fiber.Ctx) error {
 		return err
 	}
 
-	return c.JSON(user)
+	return c.JSON(entity.NewUserAccountDTO(user))
 }
 
 func (h *Handler) GetUser(c *fiber.Ctx) error {
@@ -92,13 +111,36 @@ func (h *Handler) GetUser(c *fiber.Ctx) error {
 		return h.errorsService.GetError(codes.InvalidID)
 	}
 
-	user, err := h.usersService.GetUser(c.Context(), id)
+	var req GetUserReq
+
+	if err = c.QueryParser(&req); err != nil {
+		log.Errorf("failed to parse query params: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidQuery)
+	}
+
+	getUser := h.usersService.GetUserProfile
+
+	// only admins see deleted users, the flag is ignored for everyone else
+	if req.IncludeDeleted && extractor.Extract(c).Role == entity.RoleAdmin {
+		if err = h.featuresService.IsFeatureEnabled(c, log, "get_deleted_users"); err != nil {
+			return err
+		}
+
+		getUser = h.usersService.GetUserWithDeleted
+	}
+
+	user, err := getUser(c.Context(), id)
 	if err != nil {
 		log.Errorf("failed to get user: %v", err)
 
 		return err
 	}
 
+	if extractor.Extract(c).CanManage(id) {
+		return c.JSON(entity.NewUserAccountDTO(user))
+	}
+
 	return c.JSON(user)
 }
 
@@ -119,11 +161,24 @@ func (h *Handler) GetUsers(c *fiber.Ctx) error {
 		return h.errorsService.GetError(codes.InvalidQuery)
 	}
 
+	// only admins see deleted users, the flag is ignored for everyone else
+	if req.IncludeDeleted && extractor.Extract(c).Role != entity.RoleAdmin {
+		req.IncludeDeleted = false
+	}
+
+	if req.IncludeDeleted {
+		if err := h.featuresService.IsFeatureEnabled(c, log, "get_deleted_users"); err != nil {
+			return err
+		}
+	}
+
 	params := entity.GetUsersParams{
-		Limit:    req.Limit,
-		LastID:   req.LastID,
-		Username: req.Username,
-		Email:    req.Email,
+		Limit:          req.Limit,
+		LastID:         req.LastID,
+		Username:       req.Username,
+		Email:          req.Email,
+		EmailVerified:  req.EmailVerified,
+		IncludeDeleted: req.IncludeDeleted,
 	}
 
 	users, err := h.usersService.GetUsers(c.Context(), params)
@@ -133,6 +188,18 @@ func (h *Handler) GetUsers(c *fiber.Ctx) error {
 		return err
 	}
 
+	if extractor.Extract(c).Role == entity.RoleAdmin {
+		accounts := make([]entity.UserAccountDTO, 0, len(users))
+
+		for _, user := range users {
+			accounts = append(accounts, entity.NewUserAccountDTO(user))
+		}
+
+		return c.JSON(GetUserAccountsResp{
+			Users: accounts,
+		})
+	}
+
 	return c.JSON(GetUsersResp{
 		Users: users,
 	})
@@ -154,6 +221,17 @@ func (h *Handler) UpdateEmail(c *fiber.Ctx) error {
 		return h.errorsService.GetError(codes.InvalidID)
 	}
 
+	userData, ok := extractor.Authenticated(c)
+	if !ok {
+		return h.errorsService.GetError(codes.Unauthorized)
+	}
+
+	if !userData.CanManage(id) {
+		log.Warnf("user %d is not allowed to change the email of user %d", userData.ID, id)
+
+		return h.errorsService.GetError(codes.Forbidden)
+	}
+
 	var req UpdateEmailReq
 
 	if err = c.BodyParser(&req); err != nil {
@@ -162,6 +240,10 @@ func (h *Handler) UpdateEmail(c *fiber.Ctx) error {
 		return h.errorsService.GetError(codes.InvalidBody)
 	}
 
+	if err = h.validationService.Validate(req); err != nil {
+		return err
+	}
+
 	if err = h.usersService.UpdateEmail(c.Context(), id, req.Email); err != nil {
 		log.Errorf("failed to update email: %v", err)
 
@@ -195,6 +277,10 @@ func (h *Handler) UpdateUsername(c *fiber.Ctx) error {
 		return h.errorsService.GetError(codes.InvalidBody)
 	}
 
+	if err = h.validationService.Validate(req); err != nil {
+		return err
+	}
+
 	if err = h.usersService.UpdateUsername(c.Context(), id, req.Username); err != nil {
 		log.Errorf("failed to update username: %v", err)
 
@@ -217,18 +303,25 @@ func (h *Handler) UpdatePassword(c *fiber.Ctx) error {
 	if err != nil {
 		log.Errorf("failed to parse id: %v", err)
 
-		return err
+		return h.errorsService.GetError(codes.InvalidID)
 	}
 
 	var req UpdatePasswordReq
 
-	if err := c.BodyParser(&req); err != nil {
+	if err = c.BodyParser(&req); err != nil {
 		log.Errorf("failed to parse request body: %v", err)
 
+		return h.errorsService.GetError(codes.InvalidBody)
+	}
+
+	if err = h.validationService.Validate(req); err != nil {
 		return err
 	}
 
-	if err = h.usersService.UpdatePassword(c.Context(), id, req.OldPassword, req.NewPassword); err != nil {
+	sessionID := extractor.Extract(c).SessionID
+
+	err = h.usersService.UpdatePassword(c.Context(), id, req.OldPassword, req.NewPassword, sessionID, c.IP())
+	if err != nil {
 		log.Errorf("failed to update password: %v", err)
 
 		return err
@@ -261,3 +354,198 @@ func (h *Handler) DeleteUser(c *fiber.Ctx) error {
 
 	return nil
 }
+
+// RestoreUser undoes the deletion of a user that was not purged yet.
+func (h *Handler) RestoreUser(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "RestoreUser",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "restore_user"); err != nil {
+		return err
+	}
+
+	userData, ok := extractor.Authenticated(c)
+	if !ok {
+		return h.errorsService.GetError(codes.Unauthorized)
+	}
+
+	if userData.Role != entity.RoleAdmin {
+		log.Warnf("user %d with role %s is not allowed to restore users", userData.ID, userData.Role)
+
+		return h.errorsService.GetError(codes.Forbidden)
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		log.Errorf("failed to parse id: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidID)
+	}
+
+	user, err := h.usersService.RestoreUser(c.Context(), id)
+	if err != nil {
+		log.Errorf("failed to restore user: %v", err)
+
+		return err
+	}
+
+	return c.JSON(entity.NewUserAccountDTO(user))
+}
+
+func (h *Handler) ImportUsers(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "ImportUsers",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "import_users"); err != nil {
+		return err
+	}
+
+	userData, ok := extractor.Authenticated(c)
+	if !ok {
+		return h.errorsService.GetError(codes.Unauthorized)
+	}
+
+	// the hashes of the import decide what every later login with them costs
+	if userData.Role != entity.RoleAdmin {
+		log.Warnf("user %d with role %s is not allowed to import users", userData.ID, userData.Role)
+
+		return h.errorsService.GetError(codes.Forbidden)
+	}
+
+	var req entity.UsersImportDTO
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Errorf("failed to parse request body: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidBody)
+	}
+
+	results, err := h.usersService.ImportUsers(c.Context(), req)
+	if err != nil {
+		log.Errorf("failed to import users: %v", err)
+
+		return err
+	}
+
+	return c.JSON(ImportUsersResp{
+		Users: results,
+	})
+}
+
+// SendVerificationEmail sends the verification email again, invalidating earlier links.
+func (h *Handler) SendVerificationEmail(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "SendVerificationEmail",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "send_verification_email"); err != nil {
+		return err
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		log.Errorf("failed to parse id: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidID)
+	}
+
+	userData, ok := extractor.Authenticated(c)
+	if !ok {
+		return h.errorsService.GetError(codes.Unauthorized)
+	}
+
+	if !userData.CanManage(id) {
+		log.Warnf("user %d is not allowed to send the verification email of user %d", userData.ID, id)
+
+		return h.errorsService.GetError(codes.Forbidden)
+	}
+
+	if err = h.usersService.SendVerificationEmail(c.Context(), id); err != nil {
+		log.Errorf("failed to send verification email: %v", err)
+
+		return err
+	}
+
+	return nil
+}
+
+func (h *Handler) VerifyEmail(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "VerifyEmail",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "verify_email"); err != nil {
+		return err
+	}
+
+	var req TokenReq
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Errorf("failed to parse request body: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidBody)
+	}
+
+	if err := h.usersService.VerifyEmail(c.Context(), req.Token); err != nil {
+		log.Errorf("failed to verify email: %v", err)
+
+		return err
+	}
+
+	return nil
+}
+
+func (h *Handler) ConfirmEmailChange(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "ConfirmEmailChange",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "confirm_email_change"); err != nil {
+		return err
+	}
+
+	var req TokenReq
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Errorf("failed to parse request body: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidBody)
+	}
+
+	if err := h.usersService.ConfirmEmailChange(c.Context(), req.Token); err != nil {
+		log.Errorf("failed to confirm email change: %v", err)
+
+		return err
+	}
+
+	return nil
+}
+
+// RevertEmailChange handles the link mailed to the previous address after a change.
+func (h *Handler) RevertEmailChange(c *fiber.Ctx) error {
+	log := h.log.WithFields(logger.Fields{
+		"method": "RevertEmailChange",
+	})
+
+	if err := h.featuresService.IsFeatureEnabled(c, log, "revert_email_change"); err != nil {
+		return err
+	}
+
+	var req TokenReq
+
+	if err := c.BodyParser(&req); err != nil {
+		log.Errorf("failed to parse request body: %v", err)
+
+		return h.errorsService.GetError(codes.InvalidBody)
+	}
+
+	if err := h.usersService.RevertEmailChange(c.Context(), req.Token); err != nil {
+		log.Errorf("failed to revert email change: %v", err)
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,256 @@
+package httpsrv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/extractor"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/handlers/auth"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/handlers/lockouts"
+	usersHandler "github.com/0x16F/cloud-users/internal/controller/httpsrv/handlers/users"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo/attempts"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo/memory"
+	cerrors "github.com/0x16F/cloud-users/internal/usecase/errors"
+	"github.com/0x16F/cloud-users/internal/usecase/throttle"
+	"github.com/0x16F/cloud-users/internal/usecase/users"
+	"github.com/0x16F/cloud-users/pkg/codes"
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+)
+
+// the failed logins after which an account has to wait
+const delayAfter = 3
+
+type plainPasswords struct{}
+
+func (plainPasswords) Hash(password string) (string, error) {
+	return "plain:" + password, nil
+}
+
+func (plainPasswords) Verify(password string, user entity.User) (bool, bool, error) {
+	return user.Password == "plain:"+password, false, nil
+}
+
+func (plainPasswords) Normalize(cfg entity.PasswordHashConfig, hash string, salt string) (string, error) {
+	return hash, nil
+}
+
+type allowPasswords struct{}
+
+func (allowPasswords) Check(ctx context.Context, user entity.User, password string) error {
+	return nil
+}
+
+func (allowPasswords) Remember(ctx context.Context, user entity.User) error {
+	return nil
+}
+
+type discardMailer struct{}
+
+func (discardMailer) Send(ctx context.Context, mail entity.Mail) error {
+	return nil
+}
+
+type enabledFeatures struct{}
+
+func (enabledFeatures) IsFeatureEnabled(c *fiber.Ctx, log logger.Logger, handlerName string) error {
+	return nil
+}
+
+type acceptAll struct{}
+
+func (acceptAll) Validate(req any) error {
+	return nil
+}
+
+// newTestServer serves the handlers on the services of a memory store, with alice
+// as the only user. Requests are made as the given user, anonymously if nil.
+func newTestServer(t *testing.T, as *entity.UserData) *Server {
+	t.Helper()
+
+	log := logger.New("error")
+
+	errorsService, err := cerrors.New(log, "", "en")
+	if err != nil {
+		t.Fatalf("failed to load errors: %v", err)
+	}
+
+	db := memory.NewDB()
+
+	throttleService := throttle.New(log, throttle.Config{
+		Window:              time.Hour,
+		BaseDelay:           time.Minute,
+		MaxDelay:            time.Hour,
+		LockoutDuration:     time.Hour,
+		AccountDelayAfter:   delayAfter,
+		AccountLockoutAfter: 10,
+		IPDelayAfter:        100,
+		IPLockoutAfter:      1000,
+	}, attempts.NewMemory(), errorsService)
+
+	usersService := users.New(
+		log,
+		users.Config{EmailChangeTTL: time.Hour},
+		db,
+		db,
+		db,
+		errorsService,
+		plainPasswords{},
+		allowPasswords{},
+		throttleService,
+		discardMailer{},
+	)
+
+	if _, err = usersService.CreateUser(context.Background(), entity.UserCreateDTO{
+		Email:    "alice@example.com",
+		Username: "alice",
+		Password: "password",
+	}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	server := NewServer(Config{ErrorFormat: ErrorFormatJSON}, errorsService)
+
+	server.App.Use(func(c *fiber.Ctx) error {
+		if as != nil {
+			extractor.Store(c, *as)
+		}
+
+		return c.Next()
+	})
+
+	usersHandlers := usersHandler.NewHandler(log, usersService, errorsService, enabledFeatures{}, acceptAll{})
+	authHandlers := auth.NewHandler(log, usersService, nil, nil, nil, errorsService, enabledFeatures{}, acceptAll{})
+	lockoutsHandlers := lockouts.NewHandler(log, throttleService, errorsService, enabledFeatures{})
+
+	server.App.Get("/users/:id", usersHandlers.GetUser)
+	server.App.Patch("/users/:id/email", usersHandlers.UpdateEmail)
+	server.App.Post("/users/:id/restore", usersHandlers.RestoreUser)
+	server.App.Post("/auth/login", authHandlers.Login)
+	server.App.Delete("/lockouts/users/:id", lockoutsHandlers.UnlockUser)
+
+	return server
+}
+
+// TestHandlerStatus sends requests to the handlers and checks the status and the
+// code their errors are answered with.
+func TestHandlerStatus(t *testing.T) {
+	const wrongLogin = `{"login":"alice","password":"wrong"}`
+
+	user := &entity.UserData{ID: 2, Role: entity.RoleUser}
+
+	tests := []struct {
+		name   string
+		as     *entity.UserData
+		method string
+		path   string
+		body   string
+		// the requests sent before, whatever they are answered with
+		before     int
+		wantStatus int
+		wantCode   int
+	}{
+		{
+			name:       "missing user",
+			method:     fiber.MethodGet,
+			path:       "/users/42",
+			wantStatus: fiber.StatusNotFound,
+			wantCode:   codes.UserNotFound,
+		},
+		{
+			name:       "unknown login",
+			method:     fiber.MethodPost,
+			path:       "/auth/login",
+			body:       `{"login":"bob","password":"password"}`,
+			wantStatus: fiber.StatusUnauthorized,
+			wantCode:   codes.InvalidCredentials,
+		},
+		{
+			name:       "wrong password",
+			method:     fiber.MethodPost,
+			path:       "/auth/login",
+			body:       wrongLogin,
+			wantStatus: fiber.StatusUnauthorized,
+			wantCode:   codes.InvalidCredentials,
+		},
+		{
+			name:       "throttled login",
+			method:     fiber.MethodPost,
+			path:       "/auth/login",
+			body:       wrongLogin,
+			before:     delayAfter,
+			wantStatus: fiber.StatusTooManyRequests,
+			wantCode:   codes.TooManyAttempts,
+		},
+		{
+			name:       "email of another user",
+			as:         user,
+			method:     fiber.MethodPatch,
+			path:       "/users/1/email",
+			body:       `{"email":"mallory@example.com"}`,
+			wantStatus: fiber.StatusForbidden,
+			wantCode:   codes.Forbidden,
+		},
+		{
+			name:       "restore as a user",
+			as:         user,
+			method:     fiber.MethodPost,
+			path:       "/users/1/restore",
+			wantStatus: fiber.StatusForbidden,
+			wantCode:   codes.Forbidden,
+		},
+		{
+			name:       "anonymous unlock",
+			method:     fiber.MethodDelete,
+			path:       "/lockouts/users/1",
+			wantStatus: fiber.StatusUnauthorized,
+			wantCode:   codes.Unauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, tt.as)
+
+			for range tt.before {
+				resp := send(t, server, tt.method, tt.path, tt.body)
+				_ = resp.Body.Close()
+			}
+
+			resp := send(t, server, tt.method, tt.path, tt.body)
+			defer resp.Body.Close()
+
+			var body struct {
+				Code int `json:"code"`
+			}
+
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode body: %v", err)
+			}
+
+			if resp.StatusCode != tt.wantStatus || body.Code != tt.wantCode {
+				t.Errorf("got status %d with code %d, want %d with code %d", resp.StatusCode, body.Code, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
+
+func send(t *testing.T, server *Server, method string, path string, body string) *http.Response {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+	resp, err := server.App.Test(req)
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+
+	return resp
+}
@@ -1,47 +1,64 @@
 package httpsrv
 
 import (
-	"errors"
+	"context"
 	"fmt"
 
-	cerrors "github.com/0x16F/cloud-users/internal/usecase/errors"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/middleware"
 	"github.com/goccy/go-json"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 )
 
-type Server struct {
-	*fiber.App
-}
+type Config struct {
+	ErrorFormat string `env:"HTTP_ERROR_FORMAT" env-default:"json"`
+	// the type of the problem details of an error, {code} is replaced by its code
+	ProblemType string `env:"HTTP_PROBLEM_TYPE" env-default:"urn:cloud-users:error:{code}"`
 
-func errorHandler(c *fiber.Ctx, err error) error {
-	code := fiber.StatusInternalServerError
+	// a request with the header set to true or with the cookie reads from the
+	// primary database, see middleware.Consistency
+	PrimaryHeader string `env:"HTTP_PRIMARY_HEADER" env-default:"X-Read-Primary"`
+	PrimaryCookie string `env:"HTTP_PRIMARY_COOKIE" env-default:"read_primary"`
 
-	var e *cerrors.Error
-
-	if errors.As(err, &e) {
-		code = e.HttpCode
-	}
+	// the client IP, which the attempts are throttled by, is taken from the header
+	// only for requests from the trusted proxies, which have to overwrite it with
+	// the address they received the request from. Without trusted proxies it is
+	// the address of the connection.
+	ProxyHeader    string   `env:"HTTP_PROXY_HEADER" env-default:"X-Real-IP"`
+	TrustedProxies []string `env:"HTTP_TRUSTED_PROXIES" env-separator:","`
+}
 
-	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+type ErrorsService interface {
+	GetErrorContext(ctx context.Context, code int) error
+}
 
-	return c.Status(code).SendString(err.Error())
+type Server struct {
+	*fiber.App
 }
 
-func NewServer() *Server {
+func NewServer(cfg Config, errorsService ErrorsService) *Server {
 	app := fiber.New(fiber.Config{
 		JSONEncoder:  json.Marshal,
 		JSONDecoder:  json.Unmarshal,
-		ErrorHandler: errorHandler,
+		ErrorHandler: errorHandler(cfg, errorsService),
+
+		ProxyHeader:             cfg.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.TrustedProxies,
+		EnableIPValidation:      true,
 	})
 
+	app.Use(middleware.Trace(), middleware.Locale())
+
 	return &Server{
 		App: app,
 	}
 }
 
 func (s *Server) Start(port uint16) error {
-	s.App.Use(logger.New())
+	s.App.Use(logger.New(logger.Config{
+		Format: "[${time}] ${status} - ${latency} ${method} ${path} trace_id=${locals:trace_id}\n",
+	}))
 
 	return s.App.Listen(fmt.Sprintf(":%d", port))
 }
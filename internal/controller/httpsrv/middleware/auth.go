@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/extractor"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/pkg/codes"
+	"github.com/gofiber/fiber/v2"
+)
+
+type TokensService interface {
+	Parse(token string) (entity.UserData, error)
+}
+
+type ErrorsService interface {
+	GetError(code int) error
+}
+
+// Auth verifies the bearer access token when the request carries one and makes
+// its claims available through extractor.Extract.
+func Auth(log logger.Logger, tokensService TokensService, errorsService ErrorsService) fiber.Handler {
+	log = log.WithFields(logger.Fields{
+		"middleware": "Auth",
+	})
+
+	return func(c *fiber.Ctx) error {
+		header := c.Get(fiber.HeaderAuthorization)
+		if header == "" {
+			return c.Next()
+		}
+
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			return errorsService.GetError(codes.InvalidToken)
+		}
+
+		userData, err := tokensService.Parse(token)
+		if err != nil {
+			log.Warnf("failed to parse access token: %v", err)
+
+			return errorsService.GetError(codes.InvalidToken)
+		}
+
+		extractor.Store(c, userData)
+
+		return c.Next()
+	}
+}
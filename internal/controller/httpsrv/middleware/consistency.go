@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Consistency lets a client read its own writes while the replicas catch up. A
+// request reads from the primary once it wrote, or from the start if it sends the
+// header with a true value or the cookie. A request that wrote sets the cookie for
+// window, the longest the replicas may lag behind.
+func Consistency(header string, cookie string, window time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		primary, _ := strconv.ParseBool(c.Get(header))
+		if c.Cookies(cookie) != "" {
+			primary = true
+		}
+
+		consistency := repo.NewConsistency(primary)
+		c.Locals(repo.ConsistencyKey, consistency)
+
+		err := c.Next()
+
+		if consistency.Wrote() && window > 0 {
+			c.Cookie(&fiber.Cookie{
+				Name:     cookie,
+				Value:    "1",
+				MaxAge:   int(math.Ceil(window.Seconds())),
+				HTTPOnly: true,
+				SameSite: fiber.CookieSameSiteLaxMode,
+			})
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	cerrors "github.com/0x16F/cloud-users/internal/usecase/errors"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Locale makes the locales of the Accept-Language header the preferred locales of
+// the request context, see cerrors.GetErrorContext.
+func Locale() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if header := c.Get(fiber.HeaderAcceptLanguage); header != "" {
+			c.Locals(cerrors.LocalesKey, cerrors.ParseAcceptLanguage(header))
+		}
+
+		return c.Next()
+	}
+}
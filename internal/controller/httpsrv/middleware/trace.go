@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/extractor"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	HeaderTraceParent = "traceparent"
+	traceIDLength     = 32
+)
+
+// Trace assigns every request a trace ID: the one of a W3C traceparent header, the
+// request ID set by the gateway, or a new random one. It is echoed in the
+// X-Request-ID response header and available through extractor.TraceID.
+func Trace() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		traceID := parseTraceParent(c.Get(HeaderTraceParent))
+
+		if traceID == "" {
+			traceID = c.Get(fiber.HeaderXRequestID)
+		}
+
+		if traceID == "" {
+			traceID = newTraceID()
+		}
+
+		extractor.StoreTraceID(c, traceID)
+		c.Set(fiber.HeaderXRequestID, traceID)
+
+		return c.Next()
+	}
+}
+
+// parseTraceParent returns the trace ID of a version-traceid-parentid-flags header,
+// or an empty string if the header is missing or malformed.
+func parseTraceParent(header string) string {
+	parts := strings.Split(header, "-")
+	if len(parts) != 4 || len(parts[1]) != traceIDLength {
+		return ""
+	}
+
+	if _, err := hex.DecodeString(parts[1]); err != nil || strings.Trim(parts[1], "0") == "" {
+		return ""
+	}
+
+	return parts[1]
+}
+
+func newTraceID() string {
+	id := make([]byte, traceIDLength/2)
+
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
@@ -2,15 +2,23 @@ package definitions
 
 import (
 	"context"
+	"fmt"
+	"path/filepath"
 
 	"github.com/0x16F/cloud-users/internal/infrastructure/repo"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo/memory"
 	"github.com/0x16F/cloud-users/internal/usecase/config"
 	"github.com/0x16F/cloud-users/internal/usecase/migrations"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/sarulabs/di"
 )
 
 const (
-	DatabaseDef = "database"
+	DatabaseDef   = "database"
+	DBDef         = "db"
+	MemoryDBDef   = "memory_db"
+	TransactorDef = "transactor"
 )
 
 func getDatabaseDef() di.Def {
@@ -21,16 +29,124 @@ func getDatabaseDef() di.Def {
 			ctx, _ := ctn.Get(ContextDef).(context.Context)
 			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
 
+			migrationsPath := filepath.Join(cfg.App.MigrationsPath, cfg.Database.Driver)
+
+			if cfg.Database.Driver == repo.DriverSQLite {
+				db, err := repo.NewSQLiteDB(ctx, cfg.Database)
+				if err != nil {
+					return nil, err
+				}
+
+				if err := migrations.Up(db.DB(), db.Dialect(), migrationsPath); err != nil {
+					_ = db.Close()
+
+					return nil, err
+				}
+
+				return db, nil
+			}
+
 			pool, err := repo.NewConnection(ctx, cfg.Database)
 			if err != nil {
 				return nil, err
 			}
 
-			if err := migrations.Up(pool, cfg.App.MigrationsPath); err != nil {
+			if err := migrations.Up(stdlib.OpenDBFromPool(pool), repo.DialectPostgres, migrationsPath); err != nil {
 				return nil, err
 			}
 
 			return pool, nil
 		},
+		Close: func(obj interface{}) error {
+			switch db := obj.(type) {
+			case *pgxpool.Pool:
+				db.Close()
+			case *repo.SQLiteDB:
+				return db.Close()
+			}
+
+			return nil
+		},
+	}
+}
+
+// getDBDef returns the database the repositories run their queries on.
+func getDBDef() di.Def {
+	return di.Def{
+		Name:  DBDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			ctx, _ := ctn.Get(ContextDef).(context.Context)
+			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
+
+			// SQLite is a single file, it has no replicas to route reads to
+			if cfg.Database.Driver == repo.DriverSQLite {
+				return ctn.Get(DatabaseDef), nil
+			}
+
+			pool, _ := ctn.Get(DatabaseDef).(*pgxpool.Pool)
+
+			replicas, err := repo.NewReplicas(ctx, cfg.Database)
+			if err != nil {
+				return nil, err
+			}
+
+			db := repo.NewDB(pool, replicas, cfg.Database)
+			db.CheckReplicas()
+
+			return db, nil
+		},
+		Close: func(obj interface{}) error {
+			if db, ok := obj.(*repo.DB); ok {
+				db.Close()
+			}
+
+			return nil
+		},
+	}
+}
+
+func getMemoryDBDef() di.Def {
+	return di.Def{
+		Name:  MemoryDBDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			return memory.NewDB(), nil
+		},
+	}
+}
+
+// getTransactorDef returns the store that runs the transactions of the services.
+func getTransactorDef() di.Def {
+	return di.Def{
+		Name:  TransactorDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
+
+			inMemory, err := isMemoryDriver(cfg)
+			if err != nil {
+				return nil, err
+			}
+
+			if inMemory {
+				return ctn.Get(MemoryDBDef), nil
+			}
+
+			return ctn.Get(DBDef), nil
+		},
 	}
 }
+
+// isMemoryDriver reports whether the repositories keep their data in the process
+// instead of the database.
+func isMemoryDriver(cfg *config.Config) (bool, error) {
+	switch cfg.Database.Driver {
+	case repo.DriverPostgres, repo.DriverSQLite:
+		return false, nil
+	case repo.DriverMemory:
+		return true, nil
+	}
+
+	return false, fmt.Errorf("unknown database driver %q", cfg.Database.Driver)
+}
@@ -19,14 +19,36 @@ func New() (di.Container, error) {
 		getFFlagsClientDef(),
 
 		getDatabaseDef(),
+		getDBDef(),
+		getMemoryDBDef(),
+		getTransactorDef(),
 		getUsersRepoDef(),
+		getSessionsRepoDef(),
+		getMFARepoDef(),
+		getAttemptsRepoDef(),
+		getMailerDef(),
 
 		getErrorsServiceDef(),
+		getPasswordsServiceDef(),
+		getTokensServiceDef(),
+		getSessionsServiceDef(),
+		getMFAServiceDef(),
+		getPasskeysServiceDef(),
+		getValidationServiceDef(),
+		getPasswordPolicyDef(),
+		getThrottleServiceDef(),
+		getPurgeJobDef(),
 		getUsersServiceDef(),
 		getFFlagsServiceDef(),
 
 		getHTTPServerDef(),
 		getUsersHandlerDef(),
+		getAuthHandlerDef(),
+		getSessionsHandlerDef(),
+		getMFAHandlerDef(),
+		getPasskeysHandlerDef(),
+		getLockoutsHandlerDef(),
+		getCatalogHandlerDef(),
 		getFeaturesServiceDef(),
 	}...); err != nil {
 		return nil, err
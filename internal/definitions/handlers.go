@@ -3,15 +3,33 @@ package definitions
 import (
 	"github.com/0x16F/cloud-common/pkg/logger"
 	"github.com/0x16F/cloud-users/internal/controller/httpsrv/features"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/handlers/auth"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/handlers/catalog"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/handlers/lockouts"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/handlers/mfa"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/handlers/passkeys"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/handlers/sessions"
 	"github.com/0x16F/cloud-users/internal/controller/httpsrv/handlers/users"
 	"github.com/0x16F/cloud-users/internal/usecase/errors"
 	"github.com/0x16F/cloud-users/internal/usecase/fflags"
+	mfaService "github.com/0x16F/cloud-users/internal/usecase/mfa"
+	passkeysService "github.com/0x16F/cloud-users/internal/usecase/passkeys"
+	sessionsService "github.com/0x16F/cloud-users/internal/usecase/sessions"
+	"github.com/0x16F/cloud-users/internal/usecase/throttle"
+	"github.com/0x16F/cloud-users/internal/usecase/tokens"
 	usersService "github.com/0x16F/cloud-users/internal/usecase/users"
+	"github.com/0x16F/cloud-users/internal/usecase/validation"
 	"github.com/sarulabs/di"
 )
 
 const (
 	UsersHandlerDef    = "users_handler"
+	AuthHandlerDef     = "auth_handler"
+	SessionsHandlerDef = "sessions_handler"
+	MFAHandlerDef      = "mfa_handler"
+	PasskeysHandlerDef = "passkeys_handler"
+	LockoutsHandlerDef = "lockouts_handler"
+	CatalogHandlerDef  = "catalog_handler"
 	FeaturesServiceDef = "features_service"
 )
 
@@ -24,8 +42,81 @@ func getUsersHandlerDef() di.Def {
 			usersService, _ := ctn.Get(UsersServiceDef).(*usersService.Service)
 			errorsService, _ := ctn.Get(ErrorsServiceDef).(errors.Errors)
 			featuresService, _ := ctn.Get(FeaturesServiceDef).(*features.Service)
+			validationService, _ := ctn.Get(ValidationServiceDef).(*validation.Service)
 
-			return users.NewHandler(log, usersService, errorsService, featuresService), nil
+			return users.NewHandler(log, usersService, errorsService, featuresService, validationService), nil
+		},
+	}
+}
+
+func getAuthHandlerDef() di.Def {
+	return di.Def{
+		Name:  AuthHandlerDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			log, _ := ctn.Get(LoggerDef).(logger.Logger)
+			usersService, _ := ctn.Get(UsersServiceDef).(*usersService.Service)
+			sessionsService, _ := ctn.Get(SessionsServiceDef).(*sessionsService.Service)
+			mfaService, _ := ctn.Get(MFAServiceDef).(*mfaService.Service)
+			tokensService, _ := ctn.Get(TokensServiceDef).(*tokens.Service)
+			errorsService, _ := ctn.Get(ErrorsServiceDef).(errors.Errors)
+			featuresService, _ := ctn.Get(FeaturesServiceDef).(*features.Service)
+			validationService, _ := ctn.Get(ValidationServiceDef).(*validation.Service)
+
+			return auth.NewHandler(
+				log,
+				usersService,
+				sessionsService,
+				mfaService,
+				tokensService,
+				errorsService,
+				featuresService,
+				validationService,
+			), nil
+		},
+	}
+}
+
+func getSessionsHandlerDef() di.Def {
+	return di.Def{
+		Name:  SessionsHandlerDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			log, _ := ctn.Get(LoggerDef).(logger.Logger)
+			sessionsService, _ := ctn.Get(SessionsServiceDef).(*sessionsService.Service)
+			errorsService, _ := ctn.Get(ErrorsServiceDef).(errors.Errors)
+			featuresService, _ := ctn.Get(FeaturesServiceDef).(*features.Service)
+
+			return sessions.NewHandler(log, sessionsService, errorsService, featuresService), nil
+		},
+	}
+}
+
+func getLockoutsHandlerDef() di.Def {
+	return di.Def{
+		Name:  LockoutsHandlerDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			log, _ := ctn.Get(LoggerDef).(logger.Logger)
+			throttleService, _ := ctn.Get(ThrottleServiceDef).(*throttle.Service)
+			errorsService, _ := ctn.Get(ErrorsServiceDef).(errors.Errors)
+			featuresService, _ := ctn.Get(FeaturesServiceDef).(*features.Service)
+
+			return lockouts.NewHandler(log, throttleService, errorsService, featuresService), nil
+		},
+	}
+}
+
+func getCatalogHandlerDef() di.Def {
+	return di.Def{
+		Name:  CatalogHandlerDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			log, _ := ctn.Get(LoggerDef).(logger.Logger)
+			errorsService, _ := ctn.Get(ErrorsServiceDef).(errors.Errors)
+			featuresService, _ := ctn.Get(FeaturesServiceDef).(*features.Service)
+
+			return catalog.NewHandler(log, errorsService, featuresService), nil
 		},
 	}
 }
@@ -42,3 +133,44 @@ func getFeaturesServiceDef() di.Def {
 		},
 	}
 }
+
+func getMFAHandlerDef() di.Def {
+	return di.Def{
+		Name:  MFAHandlerDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			log, _ := ctn.Get(LoggerDef).(logger.Logger)
+			mfaService, _ := ctn.Get(MFAServiceDef).(*mfaService.Service)
+			errorsService, _ := ctn.Get(ErrorsServiceDef).(errors.Errors)
+			featuresService, _ := ctn.Get(FeaturesServiceDef).(*features.Service)
+
+			return mfa.NewHandler(log, mfaService, errorsService, featuresService), nil
+		},
+	}
+}
+
+func getPasskeysHandlerDef() di.Def {
+	return di.Def{
+		Name:  PasskeysHandlerDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			log, _ := ctn.Get(LoggerDef).(logger.Logger)
+			passkeysService, _ := ctn.Get(PasskeysServiceDef).(*passkeysService.Service)
+			usersService, _ := ctn.Get(UsersServiceDef).(*usersService.Service)
+			sessionsService, _ := ctn.Get(SessionsServiceDef).(*sessionsService.Service)
+			tokensService, _ := ctn.Get(TokensServiceDef).(*tokens.Service)
+			errorsService, _ := ctn.Get(ErrorsServiceDef).(errors.Errors)
+			featuresService, _ := ctn.Get(FeaturesServiceDef).(*features.Service)
+
+			return passkeys.NewHandler(
+				log,
+				passkeysService,
+				usersService,
+				sessionsService,
+				tokensService,
+				errorsService,
+				featuresService,
+			), nil
+		},
+	}
+}
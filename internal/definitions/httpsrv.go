@@ -1,8 +1,19 @@
 package definitions
 
 import (
+	"github.com/0x16F/cloud-common/pkg/logger"
 	"github.com/0x16F/cloud-users/internal/controller/httpsrv"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/handlers/auth"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/handlers/catalog"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/handlers/lockouts"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/handlers/mfa"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/handlers/passkeys"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/handlers/sessions"
 	"github.com/0x16F/cloud-users/internal/controller/httpsrv/handlers/users"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv/middleware"
+	"github.com/0x16F/cloud-users/internal/usecase/config"
+	"github.com/0x16F/cloud-users/internal/usecase/errors"
+	"github.com/0x16F/cloud-users/internal/usecase/tokens"
 	"github.com/sarulabs/di"
 )
 
@@ -16,20 +27,90 @@ func getHTTPServerDef() di.Def {
 		Scope: di.App,
 		Build: func(ctn di.Container) (interface{}, error) {
 			usersHandler, _ := ctn.Get(UsersHandlerDef).(*users.Handler)
+			authHandler, _ := ctn.Get(AuthHandlerDef).(*auth.Handler)
+			sessionsHandler, _ := ctn.Get(SessionsHandlerDef).(*sessions.Handler)
+			mfaHandler, _ := ctn.Get(MFAHandlerDef).(*mfa.Handler)
+			passkeysHandler, _ := ctn.Get(PasskeysHandlerDef).(*passkeys.Handler)
+			lockoutsHandler, _ := ctn.Get(LockoutsHandlerDef).(*lockouts.Handler)
+			catalogHandler, _ := ctn.Get(CatalogHandlerDef).(*catalog.Handler)
+			log, _ := ctn.Get(LoggerDef).(logger.Logger)
+			tokensService, _ := ctn.Get(TokensServiceDef).(*tokens.Service)
+			errorsService, _ := ctn.Get(ErrorsServiceDef).(errors.Errors)
+			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
 
-			server := httpsrv.NewServer()
+			server := httpsrv.NewServer(cfg.HTTP, errorsService)
 
-			v1 := server.App.Group("/api/v1")
+			if len(cfg.Database.ReplicaDSNs) != 0 {
+				server.App.Use(middleware.Consistency(
+					cfg.HTTP.PrimaryHeader,
+					cfg.HTTP.PrimaryCookie,
+					cfg.Database.ReplicaMaxLag,
+				))
+			}
+
+			server.App.Get("/.well-known/jwks.json", authHandler.JWKS)
+
+			v1 := server.App.Group("/api/v1", middleware.Auth(log, tokensService, errorsService))
 			{
 				users := v1.Group("/users")
 				{
 					users.Get("/", usersHandler.GetUsers)
 					users.Get("/:id", usersHandler.GetUser)
 					users.Post("/", usersHandler.CreateUser)
+					users.Post("/import", usersHandler.ImportUsers)
+					users.Post("/email/verify", usersHandler.VerifyEmail)
+					users.Post("/email/confirm", usersHandler.ConfirmEmailChange)
+					users.Post("/email/revert", usersHandler.RevertEmailChange)
+					users.Post("/:id/email/verification", usersHandler.SendVerificationEmail)
 					users.Patch("/:id/email", usersHandler.UpdateEmail)
 					users.Patch("/:id/username", usersHandler.UpdateUsername)
 					users.Patch("/:id/password", usersHandler.UpdatePassword)
 					users.Delete("/:id", usersHandler.DeleteUser)
+					users.Post("/:id/restore", usersHandler.RestoreUser)
+				}
+
+				auth := v1.Group("/auth")
+				{
+					auth.Post("/login", authHandler.Login)
+					auth.Post("/login/mfa", authHandler.LoginMFA)
+					auth.Post("/refresh", authHandler.Refresh)
+					auth.Post("/password/forgot", authHandler.RequestPasswordReset)
+					auth.Post("/password/reset", authHandler.ResetPassword)
+				}
+
+				sessions := v1.Group("/sessions")
+				{
+					sessions.Get("/", sessionsHandler.GetSessions)
+					sessions.Delete("/", sessionsHandler.RevokeSessions)
+					sessions.Delete("/:id", sessionsHandler.RevokeSession)
+				}
+
+				mfa := v1.Group("/mfa")
+				{
+					mfa.Post("/totp", mfaHandler.EnrollTOTP)
+					mfa.Post("/totp/confirm", mfaHandler.ConfirmTOTP)
+					mfa.Delete("/totp", mfaHandler.DisableTOTP)
+					mfa.Post("/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
+				}
+
+				webauthn := v1.Group("/webauthn")
+				{
+					webauthn.Post("/register/begin", passkeysHandler.BeginRegistration)
+					webauthn.Post("/register/finish", passkeysHandler.FinishRegistration)
+					webauthn.Post("/login/begin", passkeysHandler.BeginLogin)
+					webauthn.Post("/login/finish", passkeysHandler.FinishLogin)
+					webauthn.Post("/mfa/begin", passkeysHandler.BeginMFA)
+					webauthn.Post("/mfa/finish", passkeysHandler.FinishMFA)
+					webauthn.Get("/credentials", passkeysHandler.GetCredentials)
+					webauthn.Delete("/credentials/:id", passkeysHandler.DeleteCredential)
+				}
+
+				v1.Get("/errors", catalogHandler.GetErrors)
+
+				lockouts := v1.Group("/lockouts")
+				{
+					lockouts.Delete("/users/:id", lockoutsHandler.UnlockUser)
+					lockouts.Delete("/ips/:ip", lockoutsHandler.UnlockIP)
 				}
 			}
 
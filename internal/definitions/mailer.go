@@ -0,0 +1,23 @@
+package definitions
+
+import (
+	"github.com/0x16F/cloud-users/internal/infrastructure/mailer"
+	"github.com/0x16F/cloud-users/internal/usecase/config"
+	"github.com/sarulabs/di"
+)
+
+const (
+	MailerDef = "mailer"
+)
+
+func getMailerDef() di.Def {
+	return di.Def{
+		Name:  MailerDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
+
+			return mailer.NewSMTP(cfg.Mailer), nil
+		},
+	}
+}
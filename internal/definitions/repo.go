@@ -1,15 +1,23 @@
 package definitions
 
 import (
-	"context"
+	"fmt"
 
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo/attempts"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo/mfa"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo/sessions"
 	"github.com/0x16F/cloud-users/internal/infrastructure/repo/users"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/0x16F/cloud-users/internal/usecase/config"
+	"github.com/0x16F/cloud-users/internal/usecase/throttle"
 	"github.com/sarulabs/di"
 )
 
 const (
-	UsersRepoDef = "users_repo"
+	UsersRepoDef    = "users_repo"
+	SessionsRepoDef = "sessions_repo"
+	MFARepoDef      = "mfa_repo"
+	AttemptsRepoDef = "attempts_repo"
 )
 
 func getUsersRepoDef() di.Def {
@@ -17,15 +25,101 @@ func getUsersRepoDef() di.Def {
 		Name:  UsersRepoDef,
 		Scope: di.App,
 		Build: func(ctn di.Container) (interface{}, error) {
-			pool, _ := ctn.Get(DatabaseDef).(*pgxpool.Pool)
-			ctx, _ := ctn.Get(ContextDef).(context.Context)
+			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
 
-			conn, err := pool.Acquire(ctx)
+			inMemory, err := isMemoryDriver(cfg)
 			if err != nil {
 				return nil, err
 			}
 
-			return users.NewRepo(conn), nil
+			if inMemory {
+				return ctn.Get(MemoryDBDef), nil
+			}
+
+			db, _ := ctn.Get(DBDef).(repo.DBTX)
+
+			// lookups go to the replicas where there are some
+			replica := db
+			if primary, ok := db.(*repo.DB); ok {
+				replica = primary.Replica()
+			}
+
+			return users.NewRepo(db, replica), nil
+		},
+	}
+}
+
+func getSessionsRepoDef() di.Def {
+	return di.Def{
+		Name:  SessionsRepoDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
+
+			inMemory, err := isMemoryDriver(cfg)
+			if err != nil {
+				return nil, err
+			}
+
+			if inMemory {
+				return ctn.Get(MemoryDBDef), nil
+			}
+
+			db, _ := ctn.Get(DBDef).(repo.DBTX)
+
+			return sessions.NewRepo(db), nil
+		},
+	}
+}
+
+func getMFARepoDef() di.Def {
+	return di.Def{
+		Name:  MFARepoDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
+
+			inMemory, err := isMemoryDriver(cfg)
+			if err != nil {
+				return nil, err
+			}
+
+			if inMemory {
+				return ctn.Get(MemoryDBDef), nil
+			}
+
+			db, _ := ctn.Get(DBDef).(repo.DBTX)
+
+			return mfa.NewRepo(db), nil
+		},
+	}
+}
+
+func getAttemptsRepoDef() di.Def {
+	return di.Def{
+		Name:  AttemptsRepoDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
+
+			inMemory, err := isMemoryDriver(cfg)
+			if err != nil {
+				return nil, err
+			}
+
+			// without a database the attempts can only be kept in the process
+			if inMemory || cfg.Throttle.Store == throttle.StoreMemory {
+				return attempts.NewMemory(), nil
+			}
+
+			// StorePostgres keeps the attempts in the database of the driver
+			if cfg.Throttle.Store != throttle.StorePostgres {
+				return nil, fmt.Errorf("unknown throttle store %q", cfg.Throttle.Store)
+			}
+
+			db, _ := ctn.Get(DBDef).(repo.DBTX)
+
+			return attempts.NewRepo(db), nil
 		},
 	}
 }
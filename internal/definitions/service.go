@@ -2,19 +2,37 @@ package definitions
 
 import (
 	"github.com/0x16F/cloud-common/pkg/logger"
-	"github.com/0x16F/cloud-users/internal/infrastructure/repo/users"
+	"github.com/0x16F/cloud-users/internal/infrastructure/mailer"
 	"github.com/0x16F/cloud-users/internal/usecase/config"
 	"github.com/0x16F/cloud-users/internal/usecase/errors"
 	"github.com/0x16F/cloud-users/internal/usecase/fflags"
+	mfaService "github.com/0x16F/cloud-users/internal/usecase/mfa"
+	"github.com/0x16F/cloud-users/internal/usecase/passkeys"
+	"github.com/0x16F/cloud-users/internal/usecase/passwords"
+	"github.com/0x16F/cloud-users/internal/usecase/policy"
+	"github.com/0x16F/cloud-users/internal/usecase/purge"
+	sessionsService "github.com/0x16F/cloud-users/internal/usecase/sessions"
+	"github.com/0x16F/cloud-users/internal/usecase/throttle"
+	"github.com/0x16F/cloud-users/internal/usecase/tokens"
 	usersService "github.com/0x16F/cloud-users/internal/usecase/users"
+	"github.com/0x16F/cloud-users/internal/usecase/validation"
 	"github.com/open-feature/go-sdk/openfeature"
 	"github.com/sarulabs/di"
 )
 
 const (
-	UsersServiceDef  = "users_service"
-	ErrorsServiceDef = "errors_service"
-	FFlagsServiceDef = "fflags_service"
+	UsersServiceDef      = "users_service"
+	ErrorsServiceDef     = "errors_service"
+	FFlagsServiceDef     = "fflags_service"
+	PasswordsServiceDef  = "passwords_service"
+	TokensServiceDef     = "tokens_service"
+	SessionsServiceDef   = "sessions_service"
+	MFAServiceDef        = "mfa_service"
+	PasskeysServiceDef   = "passkeys_service"
+	ValidationServiceDef = "validation_service"
+	PasswordPolicyDef    = "password_policy"
+	ThrottleServiceDef   = "throttle_service"
+	PurgeJobDef          = "purge_job"
 )
 
 func getUsersServiceDef() di.Def {
@@ -23,10 +41,28 @@ func getUsersServiceDef() di.Def {
 		Scope: di.App,
 		Build: func(ctn di.Container) (interface{}, error) {
 			log, _ := ctn.Get(LoggerDef).(logger.Logger)
-			usersRepo, _ := ctn.Get(UsersRepoDef).(*users.Repo)
+			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
+			usersRepo, _ := ctn.Get(UsersRepoDef).(usersService.UsersRepository)
+			sessionsRepo, _ := ctn.Get(SessionsRepoDef).(usersService.SessionsRepository)
+			transactor, _ := ctn.Get(TransactorDef).(usersService.Transactor)
 			errorsService, _ := ctn.Get(ErrorsServiceDef).(errors.Errors)
+			passwordsService, _ := ctn.Get(PasswordsServiceDef).(*passwords.Service)
+			passwordPolicy, _ := ctn.Get(PasswordPolicyDef).(*policy.Service)
+			throttleService, _ := ctn.Get(ThrottleServiceDef).(*throttle.Service)
+			smtp, _ := ctn.Get(MailerDef).(*mailer.SMTP)
 
-			return usersService.New(log, usersRepo, errorsService), nil
+			return usersService.New(
+				log,
+				cfg.Users,
+				usersRepo,
+				sessionsRepo,
+				transactor,
+				errorsService,
+				passwordsService,
+				passwordPolicy,
+				throttleService,
+				smtp,
+			), nil
 		},
 	}
 }
@@ -39,7 +75,18 @@ func getErrorsServiceDef() di.Def {
 			log, _ := ctn.Get(LoggerDef).(logger.Logger)
 			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
 
-			return errors.New(log, cfg.App.ErrorsPath), nil
+			service, err := errors.New(log, cfg.App.ErrorsPath, cfg.App.ErrorsLocale)
+			if err != nil {
+				return nil, err
+			}
+
+			service.Watch(cfg.App.ErrorsReload)
+
+			return service, nil
+		},
+		Close: func(obj interface{}) error {
+			service, _ := obj.(errors.Errors)
+			return service.Close()
 		},
 	}
 }
@@ -55,3 +102,162 @@ func getFFlagsServiceDef() di.Def {
 		},
 	}
 }
+
+func getPasswordsServiceDef() di.Def {
+	return di.Def{
+		Name:  PasswordsServiceDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
+
+			return passwords.New(cfg.Passwords)
+		},
+	}
+}
+
+func getTokensServiceDef() di.Def {
+	return di.Def{
+		Name:  TokensServiceDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			log, _ := ctn.Get(LoggerDef).(logger.Logger)
+			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
+
+			return tokens.New(log, cfg.Tokens)
+		},
+		Close: func(obj interface{}) error {
+			obj.(*tokens.Service).Close()
+			return nil
+		},
+	}
+}
+
+func getSessionsServiceDef() di.Def {
+	return di.Def{
+		Name:  SessionsServiceDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			log, _ := ctn.Get(LoggerDef).(logger.Logger)
+			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
+			sessionsRepo, _ := ctn.Get(SessionsRepoDef).(sessionsService.SessionsRepository)
+			usersRepo, _ := ctn.Get(UsersRepoDef).(sessionsService.UsersRepository)
+			transactor, _ := ctn.Get(TransactorDef).(sessionsService.Transactor)
+			tokensService, _ := ctn.Get(TokensServiceDef).(*tokens.Service)
+			errorsService, _ := ctn.Get(ErrorsServiceDef).(errors.Errors)
+
+			return sessionsService.New(
+				log,
+				cfg.Sessions,
+				sessionsRepo,
+				usersRepo,
+				transactor,
+				tokensService,
+				errorsService,
+			), nil
+		},
+	}
+}
+
+func getMFAServiceDef() di.Def {
+	return di.Def{
+		Name:  MFAServiceDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			log, _ := ctn.Get(LoggerDef).(logger.Logger)
+			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
+			mfaRepo, _ := ctn.Get(MFARepoDef).(mfaService.MFARepository)
+			transactor, _ := ctn.Get(TransactorDef).(mfaService.Transactor)
+			usersService, _ := ctn.Get(UsersServiceDef).(*usersService.Service)
+			throttleService, _ := ctn.Get(ThrottleServiceDef).(*throttle.Service)
+			errorsService, _ := ctn.Get(ErrorsServiceDef).(errors.Errors)
+
+			return mfaService.New(
+				log,
+				cfg.MFA,
+				mfaRepo,
+				transactor,
+				usersService,
+				throttleService,
+				errorsService,
+			)
+		},
+	}
+}
+
+func getPasskeysServiceDef() di.Def {
+	return di.Def{
+		Name:  PasskeysServiceDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			log, _ := ctn.Get(LoggerDef).(logger.Logger)
+			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
+			mfaRepo, _ := ctn.Get(MFARepoDef).(passkeys.CredentialsRepository)
+			usersService, _ := ctn.Get(UsersServiceDef).(*usersService.Service)
+			errorsService, _ := ctn.Get(ErrorsServiceDef).(errors.Errors)
+
+			return passkeys.New(log, cfg.Passkeys, mfaRepo, usersService, errorsService)
+		},
+	}
+}
+
+func getValidationServiceDef() di.Def {
+	return di.Def{
+		Name:  ValidationServiceDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
+			passwordPolicy, _ := ctn.Get(PasswordPolicyDef).(*policy.Service)
+			errorsService, _ := ctn.Get(ErrorsServiceDef).(errors.Errors)
+
+			return validation.New(cfg.Validation, passwordPolicy, errorsService), nil
+		},
+	}
+}
+
+func getPasswordPolicyDef() di.Def {
+	return di.Def{
+		Name:  PasswordPolicyDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			log, _ := ctn.Get(LoggerDef).(logger.Logger)
+			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
+			usersRepo, _ := ctn.Get(UsersRepoDef).(policy.HistoryRepository)
+			passwordsService, _ := ctn.Get(PasswordsServiceDef).(*passwords.Service)
+
+			return policy.New(log, cfg.PasswordPolicy, usersRepo, passwordsService)
+		},
+	}
+}
+
+func getThrottleServiceDef() di.Def {
+	return di.Def{
+		Name:  ThrottleServiceDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			log, _ := ctn.Get(LoggerDef).(logger.Logger)
+			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
+			store, _ := ctn.Get(AttemptsRepoDef).(throttle.Store)
+			errorsService, _ := ctn.Get(ErrorsServiceDef).(errors.Errors)
+
+			return throttle.New(log, cfg.Throttle, store, errorsService), nil
+		},
+	}
+}
+
+func getPurgeJobDef() di.Def {
+	return di.Def{
+		Name:  PurgeJobDef,
+		Scope: di.App,
+		Build: func(ctn di.Container) (interface{}, error) {
+			log, _ := ctn.Get(LoggerDef).(logger.Logger)
+			cfg, _ := ctn.Get(ConfigDef).(*config.Config)
+			usersRepo, _ := ctn.Get(UsersRepoDef).(purge.UsersRepository)
+
+			return purge.New(log, cfg.Purge, usersRepo)
+		},
+		Close: func(obj interface{}) error {
+			job, _ := obj.(*purge.Job)
+			return job.Close()
+		},
+	}
+}
@@ -0,0 +1,37 @@
+package entity
+
+import (
+	"fmt"
+	"time"
+)
+
+// LoginAttempts holds the recent failed password checks of an account or a client IP.
+// An attempt counts as failed from its reservation until it succeeds.
+type LoginAttempts struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	// PreviousFailureAt is the failure before the last one, nil for the first
+	PreviousFailureAt *time.Time
+	LockedUntil       *time.Time
+}
+
+func AccountAttemptsKey(userID uint64) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+func IPAttemptsKey(ip string) string {
+	return "ip:" + ip
+}
+
+func MFAAttemptsKey(userID uint64) string {
+	return fmt.Sprintf("mfa:%d", userID)
+}
+
+func ChallengeAttemptsKey(id string) string {
+	return "challenge:" + id
+}
+
+func (a LoginAttempts) IsLocked(now time.Time) bool {
+	return a.LockedUntil != nil && now.Before(*a.LockedUntil)
+}
@@ -0,0 +1,10 @@
+package entity
+
+import "errors"
+
+// Errors reported by repositories when a write conflicts with the unique constraints
+// of the stored data.
+var (
+	ErrEmailAlreadyExists    = errors.New("email already exists")
+	ErrUsernameAlreadyExists = errors.New("username already exists")
+)
@@ -0,0 +1,29 @@
+package entity
+
+// PasswordHashConfig describes how the hashes of an imported batch were produced.
+// SignerKey, SaltSeparator, Rounds and MemCost are only used by firebase-scrypt.
+type PasswordHashConfig struct {
+	Algorithm     string `json:"algorithm"`
+	SignerKey     string `json:"signer_key"`
+	SaltSeparator string `json:"salt_separator"`
+	Rounds        int    `json:"rounds"`
+	MemCost       int    `json:"mem_cost"`
+}
+
+type UserImportDTO struct {
+	Email        string `json:"email"`
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+	Salt         string `json:"salt"`
+}
+
+type UsersImportDTO struct {
+	Hash  PasswordHashConfig `json:"hash"`
+	Users []UserImportDTO    `json:"users"`
+}
+
+type UserImportResult struct {
+	Email string `json:"email"`
+	ID    uint64 `json:"id,omitempty"`
+	Error error  `json:"error,omitempty"`
+}
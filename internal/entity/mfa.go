@@ -0,0 +1,57 @@
+package entity
+
+import "time"
+
+type TOTP struct {
+	UserID       uint64
+	Secret       string
+	LastUsedStep int64
+	ConfirmedAt  *time.Time
+}
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+func (t TOTP) IsConfirmed() bool {
+	return t.ConfirmedAt != nil
+}
+
+const (
+	WebAuthnRegistration = "registration"
+	WebAuthnLogin        = "login"
+	WebAuthnMFA          = "mfa"
+)
+
+type WebAuthnCredential struct {
+	ID              uint64     `json:"id"`
+	UserID          uint64     `json:"-"`
+	Name            string     `json:"name"`
+	CredentialID    []byte     `json:"-"`
+	PublicKey       []byte     `json:"-"`
+	AttestationType string     `json:"-"`
+	AAGUID          []byte     `json:"-"`
+	SignCount       uint32     `json:"-"`
+	Transports      []string   `json:"transports"`
+	BackupEligible  bool       `json:"backup_eligible"`
+	BackupState     bool       `json:"backup_state"`
+	CloneWarning    bool       `json:"clone_warning"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastUsedAt      *time.Time `json:"last_used_at"`
+}
+
+// WebAuthnCeremony keeps the server side state of a registration or assertion between
+// its begin and finish requests. UserID is zero for discoverable logins.
+type WebAuthnCeremony struct {
+	ID        string
+	UserID    uint64
+	Purpose   string
+	Data      []byte
+	ExpiresAt time.Time
+}
+
+type WebAuthnChallenge struct {
+	CeremonyID string `json:"ceremony_id"`
+	Options    any    `json:"options"`
+}
@@ -0,0 +1,46 @@
+package entity
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeEmail returns the form an email is stored and looked up in: NFKC
+// normalized, trimmed, with a lowercased domain. The local part keeps its case,
+// the database compares emails case-insensitively.
+func NormalizeEmail(email string) string {
+	email = strings.TrimSpace(norm.NFKC.String(email))
+
+	at := strings.LastIndex(email, "@")
+	if at == -1 {
+		return email
+	}
+
+	return email[:at+1] + strings.ToLower(email[at+1:])
+}
+
+// NormalizeUsername returns the form a username is stored and looked up in: NFKC
+// normalized and trimmed. The database compares usernames case-insensitively.
+func NormalizeUsername(username string) string {
+	return strings.TrimSpace(norm.NFKC.String(username))
+}
+
+// IdentityKey folds a normalized email or username into the key it is unique by.
+func IdentityKey(value string) string {
+	return strings.ToLower(value)
+}
+
+// IdentityCollision lists users whose values of a field are unique as stored but
+// share an identity key once normalized.
+type IdentityCollision struct {
+	Field   string   `json:"field"`
+	Key     string   `json:"key"`
+	UserIDs []uint64 `json:"user_ids"`
+}
+
+type IdentityReport struct {
+	Scanned    int                 `json:"scanned"`
+	Normalized int                 `json:"normalized"`
+	Collisions []IdentityCollision `json:"collisions"`
+}
@@ -0,0 +1,33 @@
+package entity
+
+import "time"
+
+// Rules of the password policy, reported with a violation.
+const (
+	PasswordRuleMinLength = "min_length"
+	PasswordRuleMaxLength = "max_length"
+	PasswordRuleLower     = "lowercase"
+	PasswordRuleUpper     = "uppercase"
+	PasswordRuleDigit     = "digit"
+	PasswordRuleSymbol    = "symbol"
+	PasswordRuleIdentity  = "identity"
+	PasswordRuleReused    = "reused"
+	PasswordRuleBreached  = "breached"
+)
+
+type PasswordHistoryEntry struct {
+	UserID    uint64
+	Password  string
+	Salt      string
+	CreatedAt time.Time
+}
+
+// PasswordPolicyError reports the rule of the password policy a password failed.
+type PasswordPolicyError struct {
+	Rule    string
+	Message string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return e.Message
+}
@@ -0,0 +1,35 @@
+package entity
+
+import "time"
+
+type Session struct {
+	ID         uint64     `json:"id"`
+	UserID     uint64     `json:"-"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+}
+
+type RefreshToken struct {
+	ID        uint64
+	SessionID uint64
+	TokenHash string
+	UsedAt    *time.Time
+}
+
+type Device struct {
+	UserAgent string
+	IP        string
+}
+
+type TokenPair struct {
+	AccessToken  AccessToken
+	RefreshToken string
+}
+
+func (s Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
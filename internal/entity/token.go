@@ -0,0 +1,15 @@
+package entity
+
+import "time"
+
+type AccessToken struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// MFAChallenge is the verified challenge token of a login waiting for its second factor.
+type MFAChallenge struct {
+	ID        string
+	UserID    uint64
+	ExpiresAt time.Time
+}
@@ -1,51 +1,91 @@
 package entity
 
 import (
-	"github.com/0x16F/cloud-common/pkg/generator"
-)
-
-const (
-	SaltLength = 10
+	"time"
 )
 
 type User struct {
-	ID       uint64 `json:"id"`
-	Email    string `json:"email"`
-	Username string `json:"username"`
-	Password string `json:"-"`
-	Salt     string `json:"-"`
+	ID              uint64     `json:"id"`
+	Email           string     `json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	PendingEmail    string     `json:"-"`
+	Username        string     `json:"username"`
+	Role            string     `json:"-"`
+	Password        string     `json:"-"`
+	Salt            string     `json:"-"`
+	LockedAt        *time.Time `json:"-"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+}
+
+// UserAccountDTO is the user as the user itself and admins see it, with the fields
+// of the account that are kept from everyone else.
+type UserAccountDTO struct {
+	User
+	PendingEmail string     `json:"pending_email,omitempty"`
+	Role         string     `json:"role"`
+	LockedAt     *time.Time `json:"locked_at"`
+}
+
+func NewUserAccountDTO(user User) UserAccountDTO {
+	return UserAccountDTO{
+		User:         user,
+		PendingEmail: user.PendingEmail,
+		Role:         user.Role,
+		LockedAt:     user.LockedAt,
+	}
 }
 
 type UserCreateDTO struct {
-	Email    string `json:"email"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,email"`
+	Username string `json:"username" validate:"required,username"`
+	Password string `json:"password" validate:"required,password"`
 }
 
 type GetUsersParams struct {
-	Limit    int
-	LastID   uint64
-	Username string
-	Email    string
+	Limit         int
+	LastID        uint64
+	Username      string
+	Email         string
+	EmailVerified *bool
+	// IncludeDeleted also returns deleted users that were not purged yet
+	IncludeDeleted bool
 }
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type UserData struct {
-	Login string
-	Role  string
+	ID            uint64
+	SessionID     uint64
+	Login         string
+	Role          string
+	EmailVerified bool
 }
 
-func NewUser(dto UserCreateDTO) User {
-	salt := generator.NewString(SaltLength)
-	password := generator.NewHash(dto.Password, salt)
+// CanManage reports whether the user may act on the account with the given ID:
+// their own one, or any one for admins.
+func (d UserData) CanManage(id uint64) bool {
+	return d.ID == id || d.Role == RoleAdmin
+}
 
+func NewUser(dto UserCreateDTO, passwordHash string) User {
 	return User{
-		Email:    dto.Email,
-		Username: dto.Username,
-		Password: password,
-		Salt:     salt,
+		Email:    NormalizeEmail(dto.Email),
+		Username: NormalizeUsername(dto.Username),
+		Password: passwordHash,
 	}
 }
 
-func (u User) ValidatePassword(password string) bool {
-	return generator.NewHash(password, u.Salt) == u.Password
+func (u User) IsDeleted() bool {
+	return u.DeletedAt != nil
+}
+
+func (u User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+func (u User) IsLocked() bool {
+	return u.LockedAt != nil
 }
@@ -0,0 +1,22 @@
+package entity
+
+import "time"
+
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+	TokenEmailChange       = "email_change"
+	TokenEmailRevert       = "email_revert"
+)
+
+// UserToken is a single-use token sent to the user by email. Only the hash of the
+// token is stored. Payload binds the token to data of the flow, such as the address
+// an email change was requested for.
+type UserToken struct {
+	ID        uint64
+	UserID    uint64
+	Purpose   string
+	TokenHash string
+	Payload   string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,109 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/pkg/errors"
+)
+
+type Config struct {
+	Host     string `env:"SMTP_HOST" env-default:"localhost"`
+	Port     uint16 `env:"SMTP_PORT" env-default:"25"`
+	Username string `env:"SMTP_USERNAME"`
+	Password string `env:"SMTP_PASSWORD"`
+	From     string `env:"SMTP_FROM" env-default:"no-reply@localhost"`
+}
+
+// SMTP delivers mail through an SMTP relay. STARTTLS is used whenever the server
+// offers it, and authentication only when a username is configured.
+type SMTP struct {
+	cfg Config
+}
+
+func NewSMTP(cfg Config) *SMTP {
+	return &SMTP{
+		cfg: cfg,
+	}
+}
+
+func (m *SMTP) Send(ctx context.Context, mail entity.Mail) error {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.cfg.Host, strconv.Itoa(int(m.cfg.Port))))
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to smtp server")
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		_ = conn.Close()
+
+		return errors.Wrap(err, "failed to create smtp client")
+	}
+
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: m.cfg.Host}); err != nil {
+			return errors.Wrap(err, "failed to start tls")
+		}
+	}
+
+	if m.cfg.Username != "" {
+		if err = client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return errors.Wrap(err, "failed to authenticate")
+		}
+	}
+
+	if err = client.Mail(m.cfg.From); err != nil {
+		return errors.Wrap(err, "failed to set sender")
+	}
+
+	if err = client.Rcpt(mail.To); err != nil {
+		return errors.Wrap(err, "failed to set recipient")
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return errors.Wrap(err, "failed to start data")
+	}
+
+	if _, err = writer.Write(m.message(mail)); err != nil {
+		return errors.Wrap(err, "failed to write message")
+	}
+
+	if err = writer.Close(); err != nil {
+		return errors.Wrap(err, "failed to send message")
+	}
+
+	return client.Quit()
+}
+
+func (m *SMTP) message(mail entity.Mail) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "From: %s\r\n", m.cfg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", mail.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", mail.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(mail.Body)
+
+	return buf.Bytes()
+}
@@ -0,0 +1,160 @@
+package attempts
+
+import (
+	"context"
+	"time"
+
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+type Repo struct {
+	db repo.DBTX
+}
+
+func NewRepo(db repo.DBTX) *Repo {
+	return &Repo{
+		db: db,
+	}
+}
+
+// GetAttempts returns the attempts of the key, or zero attempts if none were recorded.
+func (r *Repo) GetAttempts(ctx context.Context, key string) (entity.LoginAttempts, error) {
+	query := `
+		SELECT key, failures, last_failure_at, previous_failure_at, locked_until
+		FROM cd_login_attempts
+		WHERE key = @key
+	`
+
+	args := pgx.NamedArgs{
+		"key": key,
+	}
+
+	attempts, err := scanAttempts(r.db.QueryRow(ctx, query, args))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.LoginAttempts{Key: key}, nil
+		}
+
+		return entity.LoginAttempts{}, errors.Wrap(err, "failed to get attempts")
+	}
+
+	return attempts, nil
+}
+
+// Reserve counts an attempt before it is made and returns the count including it,
+// so that concurrent attempts each get a count of their own. Failures older than
+// the window are forgotten and the count starts over.
+func (r *Repo) Reserve(
+	ctx context.Context,
+	key string,
+	now time.Time,
+	window time.Duration,
+) (entity.LoginAttempts, error) {
+	query := `
+		INSERT INTO cd_login_attempts (key, failures, last_failure_at)
+		VALUES (@key, 1, @now)
+		ON CONFLICT (key) DO UPDATE
+		SET failures = CASE
+				WHEN cd_login_attempts.last_failure_at < @expired THEN 1
+				ELSE cd_login_attempts.failures + 1
+			END,
+			previous_failure_at = CASE
+				WHEN cd_login_attempts.last_failure_at < @expired THEN NULL
+				ELSE cd_login_attempts.last_failure_at
+			END,
+			last_failure_at = @now
+		RETURNING key, failures, last_failure_at, previous_failure_at, locked_until
+	`
+
+	args := pgx.NamedArgs{
+		"key":     key,
+		"now":     now,
+		"expired": now.Add(-window),
+	}
+
+	attempts, err := scanAttempts(r.db.QueryRow(ctx, query, args))
+	if err != nil {
+		return entity.LoginAttempts{}, errors.Wrap(err, "failed to reserve attempt")
+	}
+
+	return attempts, nil
+}
+
+// Release takes back the reservation of an attempt that succeeded.
+func (r *Repo) Release(ctx context.Context, key string) error {
+	query := `
+		UPDATE cd_login_attempts
+		SET failures = failures - 1
+		WHERE key = @key AND failures > 0
+	`
+
+	args := pgx.NamedArgs{
+		"key": key,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		return errors.Wrap(err, "failed to release attempt")
+	}
+
+	return nil
+}
+
+// Lock locks the key until the given time, unless it is locked already, and
+// reports whether it did.
+func (r *Repo) Lock(ctx context.Context, key string, now time.Time, until time.Time) (bool, error) {
+	query := `
+		UPDATE cd_login_attempts
+		SET locked_until = @until
+		WHERE key = @key AND (locked_until IS NULL OR locked_until <= @now)
+	`
+
+	args := pgx.NamedArgs{
+		"key":   key,
+		"now":   now,
+		"until": until,
+	}
+
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to lock")
+	}
+
+	return tag.RowsAffected() != 0, nil
+}
+
+func (r *Repo) ResetAttempts(ctx context.Context, key string) error {
+	query := `
+		DELETE FROM cd_login_attempts
+		WHERE key = @key
+	`
+
+	args := pgx.NamedArgs{
+		"key": key,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		return errors.Wrap(err, "failed to reset attempts")
+	}
+
+	return nil
+}
+
+func scanAttempts(row pgx.Row) (entity.LoginAttempts, error) {
+	var attempts entity.LoginAttempts
+
+	err := row.Scan(
+		&attempts.Key,
+		&attempts.Failures,
+		&attempts.LastFailureAt,
+		&attempts.PreviousFailureAt,
+		&attempts.LockedUntil,
+	)
+	if err != nil {
+		return entity.LoginAttempts{}, err
+	}
+
+	return attempts, nil
+}
@@ -0,0 +1,116 @@
+package attempts
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/0x16F/cloud-users/internal/entity"
+)
+
+// Memory keeps the attempts in the process. It suits a single node, every node of a
+// cluster would throttle on its own.
+type Memory struct {
+	mu        sync.Mutex
+	attempts  map[string]entity.LoginAttempts
+	lastPrune time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		attempts: make(map[string]entity.LoginAttempts),
+	}
+}
+
+func (m *Memory) GetAttempts(_ context.Context, key string) (entity.LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if attempts, ok := m.attempts[key]; ok {
+		return attempts, nil
+	}
+
+	return entity.LoginAttempts{Key: key}, nil
+}
+
+func (m *Memory) Reserve(
+	_ context.Context,
+	key string,
+	now time.Time,
+	window time.Duration,
+) (entity.LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune(now, window)
+
+	attempts, ok := m.attempts[key]
+	if !ok || attempts.LastFailureAt.Before(now.Add(-window)) {
+		attempts = entity.LoginAttempts{
+			Key:         key,
+			LockedUntil: attempts.LockedUntil,
+		}
+	} else {
+		previous := attempts.LastFailureAt
+		attempts.PreviousFailureAt = &previous
+	}
+
+	attempts.Failures++
+	attempts.LastFailureAt = now
+
+	m.attempts[key] = attempts
+
+	return attempts, nil
+}
+
+func (m *Memory) Release(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if attempts, ok := m.attempts[key]; ok && attempts.Failures > 0 {
+		attempts.Failures--
+		m.attempts[key] = attempts
+	}
+
+	return nil
+}
+
+func (m *Memory) Lock(_ context.Context, key string, now time.Time, until time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempts, ok := m.attempts[key]
+	if !ok || attempts.IsLocked(now) {
+		return false, nil
+	}
+
+	attempts.LockedUntil = &until
+	m.attempts[key] = attempts
+
+	return true, nil
+}
+
+func (m *Memory) ResetAttempts(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+
+	return nil
+}
+
+// prune drops the forgotten attempts once per window, so that keys of clients that
+// gave up don't pile up.
+func (m *Memory) prune(now time.Time, window time.Duration) {
+	if now.Sub(m.lastPrune) < window {
+		return
+	}
+
+	for key, attempts := range m.attempts {
+		if attempts.LastFailureAt.Before(now.Add(-window)) && !attempts.IsLocked(now) {
+			delete(m.attempts, key)
+		}
+	}
+
+	m.lastPrune = now
+}
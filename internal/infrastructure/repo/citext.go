@@ -0,0 +1,124 @@
+package repo
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"modernc.org/sqlite"
+)
+
+// sqliteCollation is the collation of the SQLite columns that are CITEXT on
+// Postgres. The NOCASE collation of SQLite only folds ASCII, CITEXT folds every
+// letter, so that "Ä" and "ä" are the same email.
+const sqliteCollation = "CITEXT"
+
+// init registers the collation and replaces the like function of SQLite, which
+// only folds ASCII as well, on every connection the driver opens, the ones of the
+// migrations included.
+func init() {
+	sqlite.MustRegisterCollationUtf8(sqliteCollation, func(left, right string) int {
+		return strings.Compare(strings.ToLower(left), strings.ToLower(right))
+	})
+
+	// the driver registers a function once for any number of arguments
+	sqlite.MustRegisterDeterministicScalarFunction("like", -1, sqliteLike)
+}
+
+// sqliteLike implements "value LIKE pattern [ESCAPE escape]", which SQLite calls as
+// like(pattern, value[, escape]).
+func sqliteLike(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.New("wrong number of arguments to function like()")
+	}
+
+	texts := make([]string, len(args))
+
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case nil:
+			return nil, nil
+		case string:
+			texts[i] = arg
+		case []byte:
+			texts[i] = string(arg)
+		default:
+			texts[i] = fmt.Sprint(arg)
+		}
+	}
+
+	escape := rune(-1)
+
+	if len(texts) == 3 {
+		if utf8.RuneCountInString(texts[2]) != 1 {
+			return nil, errors.New("ESCAPE expression must be a single character")
+		}
+
+		escape, _ = utf8.DecodeRuneInString(strings.ToLower(texts[2]))
+	}
+
+	if likeFold(strings.ToLower(texts[1]), strings.ToLower(texts[0]), escape) {
+		return int64(1), nil
+	}
+
+	return int64(0), nil
+}
+
+type likeToken struct {
+	// '%' matches any run of characters, '_' a single one and 0 the rune
+	wildcard rune
+	r        rune
+}
+
+// likeFold matches the folded value against the folded pattern. A rune after escape
+// is taken as is, escape is -1 if there is none.
+func likeFold(value string, pattern string, escape rune) bool {
+	tokens := make([]likeToken, 0, len(pattern))
+	escaped := false
+
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			tokens = append(tokens, likeToken{r: r})
+			escaped = false
+		case r == escape:
+			escaped = true
+		case r == '%' || r == '_':
+			tokens = append(tokens, likeToken{wildcard: r})
+		default:
+			tokens = append(tokens, likeToken{r: r})
+		}
+	}
+
+	runes := []rune(value)
+
+	// the last % seen and the rune it matched up to, to backtrack to on a mismatch
+	var (
+		i, j       int
+		star, mark = -1, 0
+	)
+
+	for j < len(runes) {
+		switch {
+		case i < len(tokens) && tokens[i].wildcard == '%':
+			star, mark = i, j
+			i++
+		case i < len(tokens) && (tokens[i].wildcard == '_' || tokens[i].wildcard == 0 && tokens[i].r == runes[j]):
+			i++
+			j++
+		case star >= 0:
+			mark++
+			i, j = star+1, mark
+		default:
+			return false
+		}
+	}
+
+	for i < len(tokens) && tokens[i].wildcard == '%' {
+		i++
+	}
+
+	return i == len(tokens)
+}
@@ -0,0 +1,401 @@
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo/memory"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo/repotest"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo/users"
+	"github.com/jackc/pgx/v5"
+)
+
+// usersStore is what the stores of the users have in common.
+type usersStore interface {
+	CreateUser(ctx context.Context, user entity.User) (entity.User, error)
+	GetUser(ctx context.Context, id uint64) (entity.User, error)
+	GetUserByEmail(ctx context.Context, email string) (entity.User, error)
+	GetUserByUsername(ctx context.Context, username string) (entity.User, error)
+	GetUserWithDeleted(ctx context.Context, id uint64) (entity.User, error)
+	GetUsers(ctx context.Context, params entity.GetUsersParams) ([]entity.User, error)
+	UpdateUsername(ctx context.Context, id uint64, username string) error
+	DeleteUser(ctx context.Context, id uint64) error
+	RestoreUser(ctx context.Context, id uint64) (entity.User, error)
+}
+
+// store opens an empty store, or skips the test if the database isn't available.
+type store struct {
+	name string
+	open func(t *testing.T) usersStore
+}
+
+func stores() []store {
+	return []store{
+		{
+			name: repo.DriverMemory,
+			open: func(t *testing.T) usersStore {
+				return memory.NewDB()
+			},
+		},
+		{
+			name: repo.DriverSQLite,
+			open: func(t *testing.T) usersStore {
+				db := repotest.SQLite(t)
+
+				return users.NewRepo(db, db)
+			},
+		},
+		{
+			name: repo.DriverPostgres,
+			open: func(t *testing.T) usersStore {
+				db := repotest.Postgres(t)
+
+				return users.NewRepo(db, db)
+			},
+		},
+	}
+}
+
+// TestUsersConformance runs the same cases on every store of the users, so that
+// they can replace each other.
+func TestUsersConformance(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s usersStore)
+	}{
+		{
+			name: "lookups ignore case",
+			run:  testCaseInsensitiveLookups,
+		},
+		{
+			name: "unique violations",
+			run:  testUniqueViolations,
+		},
+		{
+			name: "soft delete",
+			run:  testSoftDelete,
+		},
+		{
+			name: "keyset pagination",
+			run:  testKeysetPagination,
+		},
+		{
+			name: "filters ignore case",
+			run:  testFilters,
+		},
+		{
+			name: "case folding beyond ASCII",
+			run:  testUnicodeFolding,
+		},
+		{
+			name: "escaped wildcards",
+			run:  testEscapedWildcards,
+		},
+	}
+
+	for _, s := range stores() {
+		t.Run(s.name, func(t *testing.T) {
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					tt.run(t, s.open(t))
+				})
+			}
+		})
+	}
+}
+
+func testCaseInsensitiveLookups(t *testing.T, s usersStore) {
+	ctx := context.Background()
+
+	created := createUser(t, s, "Alice@Example.com", "Alice")
+
+	tests := []struct {
+		name   string
+		lookup func() (entity.User, error)
+	}{
+		{
+			name: "email",
+			lookup: func() (entity.User, error) {
+				return s.GetUserByEmail(ctx, "aLICE@eXAMPLE.COM")
+			},
+		},
+		{
+			name: "username",
+			lookup: func() (entity.User, error) {
+				return s.GetUserByUsername(ctx, "ALICE")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		user, err := tt.lookup()
+		if err != nil {
+			t.Fatalf("%s: failed to get user: %v", tt.name, err)
+		}
+
+		if user.ID != created.ID {
+			t.Errorf("%s: got user %d, want %d", tt.name, user.ID, created.ID)
+		}
+
+		// the stored spelling is kept
+		if user.Email != "Alice@Example.com" || user.Username != "Alice" {
+			t.Errorf("%s: got %q and %q, want the spelling of the creation", tt.name, user.Email, user.Username)
+		}
+	}
+
+	if _, err := s.GetUserByEmail(ctx, "bob@example.com"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("got %v for a missing email, want pgx.ErrNoRows", err)
+	}
+}
+
+func testUniqueViolations(t *testing.T, s usersStore) {
+	ctx := context.Background()
+
+	alice := createUser(t, s, "alice@example.com", "alice")
+	bob := createUser(t, s, "bob@example.com", "bob")
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{
+			name: "email of another user",
+			call: func() error {
+				_, err := s.CreateUser(ctx, entity.User{Email: "ALICE@example.com", Username: "carol", Password: "x"})
+				return err
+			},
+			want: entity.ErrEmailAlreadyExists,
+		},
+		{
+			name: "username of another user",
+			call: func() error {
+				_, err := s.CreateUser(ctx, entity.User{Email: "carol@example.com", Username: "Alice", Password: "x"})
+				return err
+			},
+			want: entity.ErrUsernameAlreadyExists,
+		},
+		{
+			name: "username change to another user",
+			call: func() error {
+				return s.UpdateUsername(ctx, bob.ID, "ALICE")
+			},
+			want: entity.ErrUsernameAlreadyExists,
+		},
+		{
+			name: "username change of the case",
+			call: func() error {
+				return s.UpdateUsername(ctx, alice.ID, "ALICE")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		if err := tt.call(); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func testSoftDelete(t *testing.T, s usersStore) {
+	ctx := context.Background()
+
+	deleted := createUser(t, s, "alice@example.com", "alice")
+
+	if err := s.DeleteUser(ctx, deleted.ID); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+
+	if err := s.DeleteUser(ctx, deleted.ID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("got %v deleting twice, want pgx.ErrNoRows", err)
+	}
+
+	if _, err := s.GetUser(ctx, deleted.ID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("got %v getting the deleted user, want pgx.ErrNoRows", err)
+	}
+
+	if _, err := s.GetUserByEmail(ctx, "alice@example.com"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("got %v getting the deleted user by email, want pgx.ErrNoRows", err)
+	}
+
+	if _, err := s.GetUserWithDeleted(ctx, deleted.ID); err != nil {
+		t.Errorf("failed to get the deleted user with deleted: %v", err)
+	}
+
+	if got := listUsers(t, s, entity.GetUsersParams{}); len(got) != 0 {
+		t.Errorf("got %d users, want the deleted user left out", len(got))
+	}
+
+	if got := listUsers(t, s, entity.GetUsersParams{IncludeDeleted: true}); len(got) != 1 {
+		t.Errorf("got %d users including deleted, want 1", len(got))
+	}
+
+	// a deleted user no longer holds the email. Only the email is taken, the stores
+	// don't agree on which violation to report for both.
+	createUser(t, s, "ALICE@example.com", "bob")
+
+	if _, err := s.RestoreUser(ctx, deleted.ID); !errors.Is(err, entity.ErrEmailAlreadyExists) {
+		t.Errorf("got %v restoring a user whose email was taken, want entity.ErrEmailAlreadyExists", err)
+	}
+}
+
+func testKeysetPagination(t *testing.T, s usersStore) {
+	const count = 5
+
+	created := make([]uint64, 0, count)
+
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		created = append(created, createUser(t, s, name+"@example.com", name).ID)
+	}
+
+	var (
+		got    []uint64
+		lastID uint64
+	)
+
+	for page := 0; page <= count; page++ {
+		users := listUsers(t, s, entity.GetUsersParams{Limit: 2, LastID: lastID})
+		if len(users) == 0 {
+			break
+		}
+
+		if len(users) > 2 {
+			t.Fatalf("got %d users, want at most the limit of 2", len(users))
+		}
+
+		for _, user := range users {
+			got = append(got, user.ID)
+		}
+
+		lastID = users[len(users)-1].ID
+	}
+
+	if len(got) != len(created) {
+		t.Fatalf("got users %v, want %v", got, created)
+	}
+
+	for i := range got {
+		if got[i] != created[i] {
+			t.Fatalf("got users %v, want %v", got, created)
+		}
+	}
+}
+
+func testFilters(t *testing.T, s usersStore) {
+	createUser(t, s, "alice@example.com", "Alice")
+	createUser(t, s, "bob@Example.ORG", "bob")
+
+	tests := []struct {
+		name   string
+		params entity.GetUsersParams
+		want   int
+	}{
+		{
+			name:   "email",
+			params: entity.GetUsersParams{Email: "%@EXAMPLE.%"},
+			want:   2,
+		},
+		{
+			name:   "username",
+			params: entity.GetUsersParams{Username: "ali%"},
+			want:   1,
+		},
+		{
+			name:   "no match",
+			params: entity.GetUsersParams{Username: "carol"},
+			want:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := listUsers(t, s, tt.params); len(got) != tt.want {
+			t.Errorf("%s: got %d users, want %d", tt.name, len(got), tt.want)
+		}
+	}
+}
+
+func testUnicodeFolding(t *testing.T, s usersStore) {
+	ctx := context.Background()
+
+	created := createUser(t, s, "Ärger@example.com", "Åsa")
+
+	if user, err := s.GetUserByEmail(ctx, "äRGER@example.com"); err != nil || user.ID != created.ID {
+		t.Errorf("got user %d and %v by email, want user %d", user.ID, err, created.ID)
+	}
+
+	if user, err := s.GetUserByUsername(ctx, "åSA"); err != nil || user.ID != created.ID {
+		t.Errorf("got user %d and %v by username, want user %d", user.ID, err, created.ID)
+	}
+
+	_, err := s.CreateUser(ctx, entity.User{Email: "ärger@EXAMPLE.com", Username: "other", Password: "x"})
+	if !errors.Is(err, entity.ErrEmailAlreadyExists) {
+		t.Errorf("got %v creating a user with the email in another case, want entity.ErrEmailAlreadyExists", err)
+	}
+
+	if got := listUsers(t, s, entity.GetUsersParams{Username: "å%"}); len(got) != 1 {
+		t.Errorf("got %d users matching the username in another case, want 1", len(got))
+	}
+}
+
+func testEscapedWildcards(t *testing.T, s usersStore) {
+	createUser(t, s, "a_b@example.com", "a_b")
+	createUser(t, s, "axb@example.com", "axb")
+	createUser(t, s, "100%@example.com", "100%")
+
+	tests := []struct {
+		name   string
+		params entity.GetUsersParams
+		want   int
+	}{
+		{
+			name:   "wildcard",
+			params: entity.GetUsersParams{Username: "a_b"},
+			want:   2,
+		},
+		{
+			name:   "escaped underscore",
+			params: entity.GetUsersParams{Username: `a\_b`},
+			want:   1,
+		},
+		{
+			name:   "escaped percent",
+			params: entity.GetUsersParams{Email: `%\%@%`},
+			want:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := listUsers(t, s, tt.params); len(got) != tt.want {
+			t.Errorf("%s: got %d users, want %d", tt.name, len(got), tt.want)
+		}
+	}
+}
+
+func createUser(t *testing.T, s usersStore, email string, username string) entity.User {
+	t.Helper()
+
+	user, err := s.CreateUser(context.Background(), entity.User{
+		Email:    email,
+		Username: username,
+		Password: "password",
+	})
+	if err != nil {
+		t.Fatalf("failed to create user %s: %v", username, err)
+	}
+
+	return user
+}
+
+func listUsers(t *testing.T, s usersStore, params entity.GetUsersParams) []entity.User {
+	t.Helper()
+
+	users, err := s.GetUsers(context.Background(), params)
+	if err != nil {
+		t.Fatalf("failed to get users: %v", err)
+	}
+
+	return users
+}
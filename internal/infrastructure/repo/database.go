@@ -3,22 +3,181 @@ package repo
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
 type Config struct {
+	// DriverSQLite keeps the data in the file at SQLitePath instead, see SQLiteDB,
+	// and DriverMemory in the process, see memory.DB
+	Driver     string `env:"DB_DRIVER" env-default:"postgres"`
+	SQLitePath string `env:"DB_SQLITE_PATH" env-default:"cloud-users.db"`
+
 	Host     string `env:"DB_HOST" env-default:"localhost"`
 	Port     uint16 `env:"DB_PORT" env-default:"5432"`
 	User     string `env:"DB_USER" env-default:"postgres"`
 	Password string `env:"DB_PASSWORD" env-default:"postgres"`
 	Database string `env:"DB_DATABASE" env-default:"postgres"`
+
+	SSLMode         string `env:"DB_SSL_MODE" env-default:"prefer"`
+	SSLRootCert     string `env:"DB_SSL_ROOT_CERT"`
+	ApplicationName string `env:"DB_APPLICATION_NAME" env-default:"cloud-users"`
+
+	MaxConns          int32         `env:"DB_MAX_CONNS" env-default:"10"`
+	MinConns          int32         `env:"DB_MIN_CONNS" env-default:"0"`
+	MaxConnLifetime   time.Duration `env:"DB_MAX_CONN_LIFETIME" env-default:"1h"`
+	MaxConnIdleTime   time.Duration `env:"DB_MAX_CONN_IDLE_TIME" env-default:"30m"`
+	HealthCheckPeriod time.Duration `env:"DB_HEALTH_CHECK_PERIOD" env-default:"1m"`
+	StatementTimeout  time.Duration `env:"DB_STATEMENT_TIMEOUT" env-default:"30s"`
+
+	RetryAttempts  int           `env:"DB_RETRY_ATTEMPTS" env-default:"3"`
+	RetryBaseDelay time.Duration `env:"DB_RETRY_BASE_DELAY" env-default:"50ms"`
+	RetryMaxDelay  time.Duration `env:"DB_RETRY_MAX_DELAY" env-default:"1s"`
+
+	// read-only queries go to the replicas that lag at most ReplicaMaxLag behind
+	ReplicaDSNs          []string      `env:"DB_REPLICA_DSNS" env-separator:","`
+	ReplicaMaxLag        time.Duration `env:"DB_REPLICA_MAX_LAG" env-default:"5s"`
+	ReplicaCheckInterval time.Duration `env:"DB_REPLICA_CHECK_INTERVAL" env-default:"5s"`
+
+	// the database gets this long to come up at startup, see Wait
+	ConnectTimeout  time.Duration `env:"DB_CONNECT_TIMEOUT" env-default:"1m"`
+	ConnectMaxDelay time.Duration `env:"DB_CONNECT_MAX_DELAY" env-default:"5s"`
 }
 
 func (c Config) DSN() string {
-	return fmt.Sprintf("postgresql://%s:%s@%s:%d/%s", c.User, c.Password, c.Host, c.Port, c.Database)
+	query := url.Values{}
+
+	if c.SSLMode != "" {
+		query.Set("sslmode", c.SSLMode)
+	}
+
+	if c.SSLRootCert != "" {
+		query.Set("sslrootcert", c.SSLRootCert)
+	}
+
+	if c.ApplicationName != "" {
+		query.Set("application_name", c.ApplicationName)
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgresql",
+		User:     url.UserPassword(c.User, c.Password),
+		Host:     fmt.Sprintf("%s:%d", c.Host, c.Port),
+		Path:     c.Database,
+		RawQuery: query.Encode(),
+	}
+
+	return dsn.String()
+}
+
+// PoolConfig returns the pool configuration of the DSN with the tuning of the
+// config applied.
+func (c Config) PoolConfig() (*pgxpool.Config, error) {
+	return c.poolConfig(c.DSN())
+}
+
+func (c Config) poolConfig(dsn string) (*pgxpool.Config, error) {
+	poolCfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database config: %w", err)
+	}
+
+	poolCfg.MaxConns = c.MaxConns
+	poolCfg.MinConns = c.MinConns
+	poolCfg.MaxConnLifetime = c.MaxConnLifetime
+	poolCfg.MaxConnIdleTime = c.MaxConnIdleTime
+	poolCfg.HealthCheckPeriod = c.HealthCheckPeriod
+
+	if c.StatementTimeout > 0 {
+		poolCfg.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10)
+	}
+
+	return poolCfg, nil
 }
 
+// NewConnection creates the pool. It doesn't connect yet, see Wait.
 func NewConnection(ctx context.Context, cfg Config) (*pgxpool.Pool, error) {
-	return pgxpool.New(ctx, cfg.DSN())
+	poolCfg, err := cfg.PoolConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return pgxpool.NewWithConfig(ctx, poolCfg)
+}
+
+// NewReplicas creates a pool per replica DSN, tuned like the primary.
+func NewReplicas(ctx context.Context, cfg Config) ([]*pgxpool.Pool, error) {
+	replicas := make([]*pgxpool.Pool, 0, len(cfg.ReplicaDSNs))
+
+	for i, dsn := range cfg.ReplicaDSNs {
+		poolCfg, err := cfg.poolConfig(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("replica %d: %w", i, err)
+		}
+
+		pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+		if err != nil {
+			return nil, fmt.Errorf("replica %d: %w", i, err)
+		}
+
+		replicas = append(replicas, pool)
+	}
+
+	return replicas, nil
+}
+
+// Wait blocks until the database accepts connections, retrying with a growing
+// delay for at most ConnectTimeout.
+func Wait(ctx context.Context, log logger.Logger, cfg Config) error {
+	connCfg, err := pgx.ParseConfig(cfg.DSN())
+	if err != nil {
+		return fmt.Errorf("failed to parse database config: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+	defer cancel()
+
+	b := backoff{
+		base: cfg.RetryBaseDelay,
+		max:  cfg.ConnectMaxDelay,
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = ping(ctx, connCfg)
+		if err == nil {
+			return nil
+		}
+
+		delay := b.delay(attempt)
+
+		log.Warnf("database is not ready, retrying in %s: %v", delay, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("database is not ready after %s: %w", cfg.ConnectTimeout, err)
+		case <-time.After(delay):
+		}
+	}
+}
+
+func ping(ctx context.Context, connCfg *pgx.ConnConfig) error {
+	conn, err := pgx.ConnectConfig(ctx, connCfg)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close(context.Background())
+
+	return conn.Ping(ctx)
 }
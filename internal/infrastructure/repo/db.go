@@ -0,0 +1,251 @@
+package repo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DBTX is what the repositories run their queries on.
+type DBTX interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	// WithTx runs fn in a transaction, see DB.WithTx.
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+	Dialect() Dialect
+}
+
+type txKey struct{}
+
+// txState is the transaction of a context. It remembers whether a query failed in
+// a way that makes the whole transaction worth another try, since fn usually turns
+// the error of the query into a domain error.
+type txState struct {
+	tx        pgx.Tx
+	retryable bool
+}
+
+func (s *txState) track(err error) {
+	if err != nil && isTxRetryable(err) {
+		s.retryable = true
+	}
+}
+
+// DB runs every query on a connection of the pool, or on the transaction of the
+// context if there is one, see WithTx. Repositories built on it therefore join the
+// transaction of the caller without knowing about it. Queries outside of a
+// transaction are retried on transient errors.
+type DB struct {
+	pool     *pgxpool.Pool
+	replicas *replicas
+	attempts int
+	backoff  backoff
+}
+
+// NewDB routes the queries to the primary pool. Read-only queries can go to the
+// replica pools instead, see Replica.
+func NewDB(pool *pgxpool.Pool, replicaPools []*pgxpool.Pool, cfg Config) *DB {
+	return &DB{
+		pool:     pool,
+		replicas: newReplicas(replicaPools, cfg),
+		attempts: max(cfg.RetryAttempts, 1),
+		backoff: backoff{
+			base: cfg.RetryBaseDelay,
+			max:  cfg.RetryMaxDelay,
+		},
+	}
+}
+
+func (db *DB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	markWrite(ctx, sql)
+
+	return db.exec(ctx, db.pool, sql, args...)
+}
+
+func (db *DB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	markWrite(ctx, sql)
+
+	return db.query(ctx, db.pool, sql, args...)
+}
+
+func (db *DB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	markWrite(ctx, sql)
+
+	return &row{
+		db:   db,
+		pool: db.pool,
+		ctx:  ctx,
+		sql:  sql,
+		args: args,
+	}
+}
+
+// Replica returns the DBTX for the queries of a repository that only read. They go
+// to a replica that is healthy and doesn't lag too far behind, unless the context
+// has to read its own writes, see Consistency, or runs a transaction. Without such
+// a replica they go to the primary.
+func (db *DB) Replica() DBTX {
+	return replicaDB{
+		db: db,
+	}
+}
+
+func (db *DB) Dialect() Dialect {
+	return DialectPostgres
+}
+
+// CheckReplicas keeps checking the health and the lag of the replicas until Close.
+func (db *DB) CheckReplicas() {
+	db.replicas.check()
+}
+
+// Close stops checking the replicas and closes their pools.
+func (db *DB) Close() {
+	db.replicas.close()
+}
+
+// WithTx runs fn in a transaction, which the queries on the context passed to fn
+// join. The transaction commits if fn returns nil and rolls back otherwise, the
+// error of fn is returned as is. A transaction that failed on a conflict or a lost
+// connection runs again, so fn must not have effects outside of the database. A call
+// inside fn joins the outer transaction. The context must not be shared with other
+// goroutines while fn runs, since a transaction runs one query at a time.
+func (db *DB) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*txState); ok {
+		return fn(ctx)
+	}
+
+	var committing bool
+
+	retryable := func(err error) bool {
+		var marked *retryableTx
+
+		if errors.As(err, &marked) || isConflict(err) {
+			return true
+		}
+
+		// a connection lost during the commit leaves it unknown whether it applied
+		return !committing && isTxRetryable(err)
+	}
+
+	err := db.backoff.retry(ctx, db.attempts, retryable, func() error {
+		committing = false
+
+		tx, err := db.pool.Begin(ctx)
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			_ = tx.Rollback(context.Background())
+		}()
+
+		state := &txState{
+			tx: tx,
+		}
+
+		if err = fn(context.WithValue(ctx, txKey{}, state)); err != nil {
+			if state.retryable {
+				return &retryableTx{err: err}
+			}
+
+			return err
+		}
+
+		committing = true
+
+		return tx.Commit(ctx)
+	})
+
+	var marked *retryableTx
+
+	if errors.As(err, &marked) {
+		return marked.err
+	}
+
+	return err
+}
+
+// retryableTx marks the error of fn after a query of the transaction failed in a
+// way that makes another try worthwhile.
+type retryableTx struct {
+	err error
+}
+
+func (e *retryableTx) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableTx) Unwrap() error {
+	return e.err
+}
+
+func (db *DB) exec(ctx context.Context, pool *pgxpool.Pool, sql string, args ...any) (pgconn.CommandTag, error) {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		tag, err := state.tx.Exec(ctx, sql, args...)
+		state.track(err)
+
+		return tag, err
+	}
+
+	var tag pgconn.CommandTag
+
+	err := db.backoff.retry(ctx, db.attempts, isStatementRetryable, func() error {
+		var err error
+
+		tag, err = pool.Exec(ctx, sql, args...)
+
+		return err
+	})
+
+	return tag, err
+}
+
+// query is only retried if it fails before the first row, errors while reading the
+// rows are the caller's.
+func (db *DB) query(ctx context.Context, pool *pgxpool.Pool, sql string, args ...any) (pgx.Rows, error) {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		rows, err := state.tx.Query(ctx, sql, args...)
+		state.track(err)
+
+		return rows, err
+	}
+
+	var rows pgx.Rows
+
+	err := db.backoff.retry(ctx, db.attempts, isStatementRetryable, func() error {
+		var err error
+
+		rows, err = pool.Query(ctx, sql, args...)
+
+		return err
+	})
+
+	return rows, err
+}
+
+// row runs the query once it is scanned, since only then its error is known.
+type row struct {
+	db   *DB
+	pool *pgxpool.Pool
+	ctx  context.Context
+	sql  string
+	args []any
+}
+
+func (r *row) Scan(dest ...any) error {
+	if state, ok := r.ctx.Value(txKey{}).(*txState); ok {
+		err := state.tx.QueryRow(r.ctx, r.sql, r.args...).Scan(dest...)
+		state.track(err)
+
+		return err
+	}
+
+	return r.db.backoff.retry(r.ctx, r.db.attempts, isStatementRetryable, func() error {
+		return r.pool.QueryRow(r.ctx, r.sql, r.args...).Scan(dest...)
+	})
+}
@@ -0,0 +1,97 @@
+package repo_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo/repotest"
+	"github.com/jackc/pgx/v5"
+)
+
+// the time each transaction of TestWithTxParallel holds its row
+const holdFor = 100 * time.Millisecond
+
+// TestWithTxParallel runs transactions on separate rows at once. They only share
+// the pool, so together they have to finish in a fraction of the time they take one
+// after another. Memory and SQLite run one transaction at a time, only Postgres is
+// tested.
+func TestWithTxParallel(t *testing.T) {
+	// pgxpool has at least 4 connections
+	const workers = 4
+
+	db := repotest.Postgres(t)
+	ctx := context.Background()
+
+	for i := range workers {
+		query := `
+			INSERT INTO cd_login_attempts (key, failures, last_failure_at)
+			VALUES (@key, 0, NOW())
+		`
+
+		if _, err := db.Exec(ctx, query, pgx.NamedArgs{"key": rowKey(i)}); err != nil {
+			t.Fatalf("failed to create row: %v", err)
+		}
+	}
+
+	single := timeTx(t, db, 0)
+
+	start := time.Now()
+
+	var wg sync.WaitGroup
+
+	for i := range workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			timeTx(t, db, i)
+		}()
+	}
+
+	wg.Wait()
+
+	parallel := time.Since(start)
+
+	// in parallel they take about as long as one, serialized workers times as long
+	if parallel >= workers*single/2 {
+		t.Errorf("%d transactions took %v, one takes %v: they did not run in parallel", workers, parallel, single)
+	}
+}
+
+// timeTx updates the row of the worker in a transaction that holds it for holdFor
+// and returns how long the transaction took.
+func timeTx(t *testing.T, db *repo.DB, worker int) time.Duration {
+	t.Helper()
+
+	start := time.Now()
+
+	err := db.WithTx(context.Background(), func(ctx context.Context) error {
+		query := `
+			UPDATE cd_login_attempts
+			SET failures = failures + 1
+			WHERE key = @key
+		`
+
+		if _, err := db.Exec(ctx, query, pgx.NamedArgs{"key": rowKey(worker)}); err != nil {
+			return err
+		}
+
+		_, err := db.Exec(ctx, "SELECT pg_sleep(@seconds)", pgx.NamedArgs{"seconds": holdFor.Seconds()})
+
+		return err
+	})
+	if err != nil {
+		t.Errorf("worker %d: failed to run transaction: %v", worker, err)
+	}
+
+	return time.Since(start)
+}
+
+func rowKey(worker int) string {
+	return fmt.Sprintf("load:%d", worker)
+}
@@ -0,0 +1,23 @@
+package repo
+
+import (
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// Dialect is the SQL a database speaks. The repositories write their queries for
+// Postgres and only switch on the dialect where SQLite needs different ones.
+type Dialect string
+
+const (
+	DialectPostgres Dialect = "postgres"
+	DialectSQLite   Dialect = "sqlite3"
+)
+
+// Flavor returns the flavor the queries of the dialect are built with.
+func (d Dialect) Flavor() sqlbuilder.Flavor {
+	if d == DialectSQLite {
+		return sqlbuilder.SQLite
+	}
+
+	return sqlbuilder.PostgreSQL
+}
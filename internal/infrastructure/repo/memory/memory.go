@@ -0,0 +1,190 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+// DB keeps the tables of the service in the process, for tests and local
+// development. Its methods behave like the ones of the Postgres repositories,
+// errors included: missing rows fail with pgx.ErrNoRows, unique violations of the
+// users with the entity errors and other violations with a *pgconn.PgError. The
+// data is gone once the process exits.
+type DB struct {
+	mu     sync.Mutex
+	tables tables
+	// sequences survive a rolled back transaction, like the ones of Postgres
+	sequences map[string]uint64
+}
+
+type tables struct {
+	users         map[uint64]user
+	userTokens    map[uint64]userToken
+	history       map[uint64]historyEntry
+	sessions      map[uint64]entity.Session
+	refreshTokens map[uint64]entity.RefreshToken
+	totp          map[uint64]entity.TOTP
+	recoveryCodes map[uint64]recoveryCode
+	credentials   map[uint64]entity.WebAuthnCredential
+	ceremonies    map[string]entity.WebAuthnCeremony
+}
+
+type user struct {
+	entity.User
+	pendingEmailExpiresAt *time.Time
+	purgedAt              *time.Time
+}
+
+type userToken struct {
+	entity.UserToken
+	usedAt *time.Time
+}
+
+type historyEntry struct {
+	id uint64
+	entity.PasswordHistoryEntry
+}
+
+type recoveryCode struct {
+	userID   uint64
+	codeHash string
+	usedAt   *time.Time
+}
+
+func NewDB() *DB {
+	return &DB{
+		tables: tables{
+			users:         make(map[uint64]user),
+			userTokens:    make(map[uint64]userToken),
+			history:       make(map[uint64]historyEntry),
+			sessions:      make(map[uint64]entity.Session),
+			refreshTokens: make(map[uint64]entity.RefreshToken),
+			totp:          make(map[uint64]entity.TOTP),
+			recoveryCodes: make(map[uint64]recoveryCode),
+			credentials:   make(map[uint64]entity.WebAuthnCredential),
+			ceremonies:    make(map[string]entity.WebAuthnCeremony),
+		},
+		sequences: make(map[string]uint64),
+	}
+}
+
+type txKey struct {
+	db *DB
+}
+
+// WithTx runs fn in a transaction, see repo.DB.WithTx. Transactions run one at a
+// time and keep every other query waiting, so fn must only use the store with the
+// context passed to it. The tables are restored if fn fails.
+func (db *DB) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(txKey{db}) != nil {
+		return fn(ctx)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	snapshot := db.tables.clone()
+
+	if err := fn(context.WithValue(ctx, txKey{db}, true)); err != nil {
+		db.tables = snapshot
+
+		return err
+	}
+
+	return nil
+}
+
+// lock locks the tables for a query, unless the query runs in the transaction that
+// holds the lock already.
+func (db *DB) lock(ctx context.Context) func() {
+	if ctx.Value(txKey{db}) != nil {
+		return func() {}
+	}
+
+	db.mu.Lock()
+
+	return db.mu.Unlock
+}
+
+func (db *DB) nextID(table string) uint64 {
+	db.sequences[table]++
+
+	return db.sequences[table]
+}
+
+// the values are copied as a whole on every write, so the maps can share them
+func (t tables) clone() tables {
+	return tables{
+		users:         maps.Clone(t.users),
+		userTokens:    maps.Clone(t.userTokens),
+		history:       maps.Clone(t.history),
+		sessions:      maps.Clone(t.sessions),
+		refreshTokens: maps.Clone(t.refreshTokens),
+		totp:          maps.Clone(t.totp),
+		recoveryCodes: maps.Clone(t.recoveryCodes),
+		credentials:   maps.Clone(t.credentials),
+		ceremonies:    maps.Clone(t.ceremonies),
+	}
+}
+
+func now() *time.Time {
+	now := time.Now().UTC()
+
+	return &now
+}
+
+// equalFold compares like the citext columns do.
+func equalFold(a, b string) bool {
+	return strings.ToLower(a) == strings.ToLower(b)
+}
+
+// like matches a LIKE pattern the way it is matched against a citext column: case
+// insensitive, with % and _ as wildcards and \ escaping the next character.
+func like(value string, pattern string) bool {
+	var expr strings.Builder
+
+	expr.WriteString("(?is)^")
+
+	escaped := false
+
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			expr.WriteString(".*")
+		case r == '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	expr.WriteString("$")
+
+	return regexp.MustCompile(expr.String()).MatchString(value)
+}
+
+func violation(code string, constraint string) error {
+	return &pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           code,
+		Message:        "violates constraint " + constraint,
+		ConstraintName: constraint,
+	}
+}
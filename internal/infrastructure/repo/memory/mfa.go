@@ -0,0 +1,273 @@
+package memory
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// SaveTOTP stores an unconfirmed secret, replacing a previous unfinished enrollment.
+func (db *DB) SaveTOTP(ctx context.Context, totp entity.TOTP) error {
+	defer db.lock(ctx)()
+
+	if _, ok := db.tables.users[totp.UserID]; !ok {
+		return errors.Wrap(violation(foreignKeyViolation, "cd_totp_user_id_fkey"), "failed to save totp")
+	}
+
+	if saved, ok := db.tables.totp[totp.UserID]; ok && saved.IsConfirmed() {
+		return nil
+	}
+
+	db.tables.totp[totp.UserID] = entity.TOTP{
+		UserID: totp.UserID,
+		Secret: totp.Secret,
+	}
+
+	return nil
+}
+
+func (db *DB) GetTOTP(ctx context.Context, userID uint64) (entity.TOTP, error) {
+	defer db.lock(ctx)()
+
+	totp, ok := db.tables.totp[userID]
+	if !ok {
+		return entity.TOTP{}, errors.Wrap(pgx.ErrNoRows, "failed to get totp")
+	}
+
+	return totp, nil
+}
+
+func (db *DB) ConfirmTOTP(ctx context.Context, userID uint64) error {
+	defer db.lock(ctx)()
+
+	if totp, ok := db.tables.totp[userID]; ok {
+		totp.ConfirmedAt = now()
+		db.tables.totp[userID] = totp
+	}
+
+	return nil
+}
+
+// UseTOTPStep records the time step of an accepted code and reports whether no
+// code of this or a later step was accepted before.
+func (db *DB) UseTOTPStep(ctx context.Context, userID uint64, step int64) (bool, error) {
+	defer db.lock(ctx)()
+
+	totp, ok := db.tables.totp[userID]
+	if !ok || totp.LastUsedStep >= step {
+		return false, nil
+	}
+
+	totp.LastUsedStep = step
+	db.tables.totp[userID] = totp
+
+	return true, nil
+}
+
+// DeleteTOTP removes the secret together with the recovery codes.
+func (db *DB) DeleteTOTP(ctx context.Context, userID uint64) error {
+	defer db.lock(ctx)()
+
+	db.tables.deleteRecoveryCodes(userID)
+
+	delete(db.tables.totp, userID)
+
+	return nil
+}
+
+// ReplaceRecoveryCodes invalidates the existing recovery codes of the user and stores new ones.
+func (db *DB) ReplaceRecoveryCodes(ctx context.Context, userID uint64, codeHashes []string) error {
+	defer db.lock(ctx)()
+
+	if _, ok := db.tables.users[userID]; !ok && len(codeHashes) != 0 {
+		return errors.Wrap(violation(foreignKeyViolation, "cd_recovery_codes_user_id_fkey"), "failed to replace recovery codes")
+	}
+
+	db.tables.deleteRecoveryCodes(userID)
+
+	for _, codeHash := range codeHashes {
+		db.tables.recoveryCodes[db.nextID("cd_recovery_codes")] = recoveryCode{
+			userID:   userID,
+			codeHash: codeHash,
+		}
+	}
+
+	return nil
+}
+
+// UseRecoveryCode consumes an unused recovery code and reports whether there was one.
+func (db *DB) UseRecoveryCode(ctx context.Context, userID uint64, codeHash string) (bool, error) {
+	defer db.lock(ctx)()
+
+	used := false
+
+	for id, code := range db.tables.recoveryCodes {
+		if code.userID == userID && code.codeHash == codeHash && code.usedAt == nil {
+			code.usedAt = now()
+			db.tables.recoveryCodes[id] = code
+
+			used = true
+		}
+	}
+
+	return used, nil
+}
+
+func (db *DB) CreateWebAuthnCredential(
+	ctx context.Context,
+	credential entity.WebAuthnCredential,
+) (entity.WebAuthnCredential, error) {
+	defer db.lock(ctx)()
+
+	if _, ok := db.tables.users[credential.UserID]; !ok {
+		return entity.WebAuthnCredential{}, errors.Wrap(
+			violation(foreignKeyViolation, "cd_webauthn_credentials_user_id_fkey"),
+			"failed to create webauthn credential",
+		)
+	}
+
+	for _, other := range db.tables.credentials {
+		if bytes.Equal(other.CredentialID, credential.CredentialID) {
+			return entity.WebAuthnCredential{}, errors.Wrap(
+				violation(uniqueViolation, "cd_webauthn_credentials_credential_id_key"),
+				"failed to create webauthn credential",
+			)
+		}
+	}
+
+	credential.ID = db.nextID("cd_webauthn_credentials")
+	credential.CredentialID = bytes.Clone(credential.CredentialID)
+	credential.PublicKey = bytes.Clone(credential.PublicKey)
+	credential.AAGUID = bytes.Clone(credential.AAGUID)
+	credential.Transports = append([]string{}, credential.Transports...)
+	credential.CloneWarning = false
+	credential.CreatedAt = *now()
+	credential.LastUsedAt = nil
+
+	db.tables.credentials[credential.ID] = credential
+
+	return cloneCredential(credential), nil
+}
+
+func (db *DB) GetWebAuthnCredentials(ctx context.Context, userID uint64) ([]entity.WebAuthnCredential, error) {
+	defer db.lock(ctx)()
+
+	credentials := []entity.WebAuthnCredential{}
+
+	for _, credential := range db.tables.credentials {
+		if credential.UserID == userID {
+			credentials = append(credentials, cloneCredential(credential))
+		}
+	}
+
+	slices.SortFunc(credentials, func(a, b entity.WebAuthnCredential) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return credentials, nil
+}
+
+func (db *DB) HasWebAuthnCredentials(ctx context.Context, userID uint64) (bool, error) {
+	defer db.lock(ctx)()
+
+	for _, credential := range db.tables.credentials {
+		if credential.UserID == userID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// UpdateWebAuthnCredential stores the counter and flags reported by the last assertion.
+func (db *DB) UpdateWebAuthnCredential(ctx context.Context, credential entity.WebAuthnCredential) error {
+	defer db.lock(ctx)()
+
+	if stored, ok := db.tables.credentials[credential.ID]; ok {
+		stored.SignCount = credential.SignCount
+		stored.BackupState = credential.BackupState
+		stored.CloneWarning = credential.CloneWarning
+		stored.LastUsedAt = now()
+
+		db.tables.credentials[credential.ID] = stored
+	}
+
+	return nil
+}
+
+func (db *DB) DeleteWebAuthnCredential(ctx context.Context, userID uint64, id uint64) (bool, error) {
+	defer db.lock(ctx)()
+
+	credential, ok := db.tables.credentials[id]
+	if !ok || credential.UserID != userID {
+		return false, nil
+	}
+
+	delete(db.tables.credentials, id)
+
+	return true, nil
+}
+
+func (db *DB) SaveWebAuthnCeremony(ctx context.Context, ceremony entity.WebAuthnCeremony) error {
+	defer db.lock(ctx)()
+
+	if _, ok := db.tables.users[ceremony.UserID]; !ok && ceremony.UserID != 0 {
+		return errors.Wrap(violation(foreignKeyViolation, "cd_webauthn_ceremonies_user_id_fkey"), "failed to save webauthn ceremony")
+	}
+
+	if _, ok := db.tables.ceremonies[ceremony.ID]; ok {
+		return errors.Wrap(violation(uniqueViolation, "cd_webauthn_ceremonies_pkey"), "failed to save webauthn ceremony")
+	}
+
+	ceremony.Data = bytes.Clone(ceremony.Data)
+
+	db.tables.ceremonies[ceremony.ID] = ceremony
+
+	return nil
+}
+
+// TakeWebAuthnCeremony removes an unexpired ceremony and returns it, so that every
+// challenge can be answered only once. Expired ceremonies are cleaned up on the way.
+func (db *DB) TakeWebAuthnCeremony(ctx context.Context, id string, purpose string) (entity.WebAuthnCeremony, error) {
+	defer db.lock(ctx)()
+
+	current := time.Now()
+
+	for ceremonyID, ceremony := range db.tables.ceremonies {
+		if !ceremony.ExpiresAt.After(current) {
+			delete(db.tables.ceremonies, ceremonyID)
+		}
+	}
+
+	ceremony, ok := db.tables.ceremonies[id]
+	if !ok || ceremony.Purpose != purpose {
+		return entity.WebAuthnCeremony{}, errors.Wrap(pgx.ErrNoRows, "failed to take webauthn ceremony")
+	}
+
+	delete(db.tables.ceremonies, id)
+
+	return ceremony, nil
+}
+
+func (t tables) deleteRecoveryCodes(userID uint64) {
+	for id, code := range t.recoveryCodes {
+		if code.userID == userID {
+			delete(t.recoveryCodes, id)
+		}
+	}
+}
+
+func cloneCredential(credential entity.WebAuthnCredential) entity.WebAuthnCredential {
+	credential.CredentialID = bytes.Clone(credential.CredentialID)
+	credential.PublicKey = bytes.Clone(credential.PublicKey)
+	credential.AAGUID = bytes.Clone(credential.AAGUID)
+	credential.Transports = slices.Clone(credential.Transports)
+
+	return credential
+}
@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+func (db *DB) CreateSession(ctx context.Context, session entity.Session) (entity.Session, error) {
+	defer db.lock(ctx)()
+
+	if _, ok := db.tables.users[session.UserID]; !ok {
+		return entity.Session{}, errors.Wrap(violation(foreignKeyViolation, "cd_sessions_user_id_fkey"), "failed to create session")
+	}
+
+	created := *now()
+
+	session.ID = db.nextID("cd_sessions")
+	session.CreatedAt = created
+	session.LastUsedAt = created
+	session.RevokedAt = nil
+
+	db.tables.sessions[session.ID] = session
+
+	return session, nil
+}
+
+func (db *DB) GetSession(ctx context.Context, id uint64) (entity.Session, error) {
+	defer db.lock(ctx)()
+
+	session, ok := db.tables.sessions[id]
+	if !ok {
+		return entity.Session{}, errors.Wrap(pgx.ErrNoRows, "failed to get session")
+	}
+
+	return session, nil
+}
+
+// GetSessions returns the sessions of the user that are neither revoked nor expired.
+func (db *DB) GetSessions(ctx context.Context, userID uint64) ([]entity.Session, error) {
+	defer db.lock(ctx)()
+
+	sessions := []entity.Session{}
+
+	for _, session := range db.tables.sessions {
+		if session.UserID == userID && session.IsActive(time.Now()) {
+			sessions = append(sessions, session)
+		}
+	}
+
+	slices.SortFunc(sessions, func(a, b entity.Session) int {
+		return b.LastUsedAt.Compare(a.LastUsedAt)
+	})
+
+	return sessions, nil
+}
+
+// TouchSession records a use of the session and extends its expiry.
+func (db *DB) TouchSession(ctx context.Context, id uint64, device entity.Device, expiresAt time.Time) error {
+	defer db.lock(ctx)()
+
+	if session, ok := db.tables.sessions[id]; ok {
+		session.UserAgent = device.UserAgent
+		session.IP = device.IP
+		session.LastUsedAt = *now()
+		session.ExpiresAt = expiresAt
+
+		db.tables.sessions[id] = session
+	}
+
+	return nil
+}
+
+// RevokeSession revokes an active session of the user and reports whether there was one.
+func (db *DB) RevokeSession(ctx context.Context, userID uint64, id uint64) (bool, error) {
+	defer db.lock(ctx)()
+
+	session, ok := db.tables.sessions[id]
+	if !ok || session.UserID != userID || session.RevokedAt != nil {
+		return false, nil
+	}
+
+	session.RevokedAt = now()
+	db.tables.sessions[id] = session
+
+	return true, nil
+}
+
+// RevokeSessions revokes every active session of the user except the given one.
+func (db *DB) RevokeSessions(ctx context.Context, userID uint64, exceptID uint64) error {
+	defer db.lock(ctx)()
+
+	for id, session := range db.tables.sessions {
+		if session.UserID == userID && id != exceptID && session.RevokedAt == nil {
+			session.RevokedAt = now()
+			db.tables.sessions[id] = session
+		}
+	}
+
+	return nil
+}
+
+func (db *DB) CreateRefreshToken(ctx context.Context, token entity.RefreshToken) error {
+	defer db.lock(ctx)()
+
+	if _, ok := db.tables.sessions[token.SessionID]; !ok {
+		return errors.Wrap(violation(foreignKeyViolation, "cd_refresh_tokens_session_id_fkey"), "failed to create refresh token")
+	}
+
+	for _, other := range db.tables.refreshTokens {
+		if other.TokenHash == token.TokenHash {
+			return errors.Wrap(violation(uniqueViolation, "cd_refresh_tokens_token_hash_key"), "failed to create refresh token")
+		}
+	}
+
+	token.ID = db.nextID("cd_refresh_tokens")
+	token.UsedAt = nil
+
+	db.tables.refreshTokens[token.ID] = token
+
+	return nil
+}
+
+func (db *DB) GetRefreshToken(ctx context.Context, tokenHash string) (entity.RefreshToken, error) {
+	defer db.lock(ctx)()
+
+	for _, token := range db.tables.refreshTokens {
+		if token.TokenHash == tokenHash {
+			return token, nil
+		}
+	}
+
+	return entity.RefreshToken{}, errors.Wrap(pgx.ErrNoRows, "failed to get refresh token")
+}
+
+// UseRefreshToken marks the token as used and reports whether it was unused before.
+func (db *DB) UseRefreshToken(ctx context.Context, id uint64) (bool, error) {
+	defer db.lock(ctx)()
+
+	token, ok := db.tables.refreshTokens[id]
+	if !ok || token.UsedAt != nil {
+		return false, nil
+	}
+
+	token.UsedAt = now()
+	db.tables.refreshTokens[id] = token
+
+	return true, nil
+}
+
+// deleteSession drops the session along with its refresh tokens.
+func (t tables) deleteSession(id uint64) {
+	delete(t.sessions, id)
+
+	for tokenID, token := range t.refreshTokens {
+		if token.SessionID == id {
+			delete(t.refreshTokens, tokenID)
+		}
+	}
+}
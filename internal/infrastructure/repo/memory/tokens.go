@@ -0,0 +1,148 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+func (db *DB) CreateToken(ctx context.Context, token entity.UserToken) error {
+	defer db.lock(ctx)()
+
+	if _, ok := db.tables.users[token.UserID]; !ok {
+		return errors.Wrap(violation(foreignKeyViolation, "cd_user_tokens_user_id_fkey"), "failed to create token")
+	}
+
+	for _, other := range db.tables.userTokens {
+		if other.TokenHash == token.TokenHash {
+			return errors.Wrap(violation(uniqueViolation, "cd_user_tokens_token_hash_key"), "failed to create token")
+		}
+	}
+
+	token.ID = db.nextID("cd_user_tokens")
+
+	db.tables.userTokens[token.ID] = userToken{
+		UserToken: token,
+	}
+
+	return nil
+}
+
+// GetToken returns an unused and unexpired token without using it.
+func (db *DB) GetToken(ctx context.Context, tokenHash string, purpose string) (entity.UserToken, error) {
+	defer db.lock(ctx)()
+
+	token, ok := db.tables.validToken(tokenHash, purpose)
+	if !ok {
+		return entity.UserToken{}, errors.Wrap(pgx.ErrNoRows, "failed to get token")
+	}
+
+	return token.UserToken, nil
+}
+
+// UseToken marks an unused and unexpired token as used and returns it, so that a
+// token can be redeemed only once.
+func (db *DB) UseToken(ctx context.Context, tokenHash string, purpose string) (entity.UserToken, error) {
+	defer db.lock(ctx)()
+
+	token, ok := db.tables.validToken(tokenHash, purpose)
+	if !ok {
+		return entity.UserToken{}, errors.Wrap(pgx.ErrNoRows, "failed to use token")
+	}
+
+	token.usedAt = now()
+	db.tables.userTokens[token.ID] = token
+
+	return token.UserToken, nil
+}
+
+// DeleteTokens removes every token of the user issued for the purpose.
+func (db *DB) DeleteTokens(ctx context.Context, userID uint64, purpose string) error {
+	defer db.lock(ctx)()
+
+	for id, token := range db.tables.userTokens {
+		if token.UserID == userID && token.Purpose == purpose {
+			delete(db.tables.userTokens, id)
+		}
+	}
+
+	return nil
+}
+
+// AddPasswordHistory stores a replaced password hash and drops all but the keep
+// most recent ones of the user.
+func (db *DB) AddPasswordHistory(ctx context.Context, entry entity.PasswordHistoryEntry, keep int) error {
+	defer db.lock(ctx)()
+
+	if _, ok := db.tables.users[entry.UserID]; !ok {
+		return errors.Wrap(violation(foreignKeyViolation, "cd_password_history_user_id_fkey"), "failed to add password history")
+	}
+
+	id := db.nextID("cd_password_history")
+
+	entry.CreatedAt = time.Now().UTC()
+
+	db.tables.history[id] = historyEntry{
+		id:                   id,
+		PasswordHistoryEntry: entry,
+	}
+
+	for i, stale := range db.tables.userHistory(entry.UserID) {
+		if i >= keep {
+			delete(db.tables.history, stale.id)
+		}
+	}
+
+	return nil
+}
+
+// GetPasswordHistory returns the most recent replaced password hashes of the user,
+// newest first.
+func (db *DB) GetPasswordHistory(ctx context.Context, userID uint64, count int) ([]entity.PasswordHistoryEntry, error) {
+	defer db.lock(ctx)()
+
+	entries := []entity.PasswordHistoryEntry{}
+
+	for _, entry := range db.tables.userHistory(userID) {
+		if len(entries) == count {
+			break
+		}
+
+		entries = append(entries, entry.PasswordHistoryEntry)
+	}
+
+	return entries, nil
+}
+
+func (t tables) validToken(tokenHash string, purpose string) (userToken, bool) {
+	for _, token := range t.userTokens {
+		if token.TokenHash == tokenHash && token.Purpose == purpose && token.usedAt == nil &&
+			token.ExpiresAt.After(time.Now()) {
+			return token, true
+		}
+	}
+
+	return userToken{}, false
+}
+
+// userHistory returns the password history of the user, newest first.
+func (t tables) userHistory(userID uint64) []historyEntry {
+	entries := []historyEntry{}
+
+	for _, entry := range t.history {
+		if entry.UserID == userID {
+			entries = append(entries, entry)
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b historyEntry) int {
+		return cmp.Compare(b.id, a.id)
+	})
+
+	return entries
+}
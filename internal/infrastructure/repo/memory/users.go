@@ -0,0 +1,481 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+const (
+	limit = 1000
+)
+
+const (
+	defaultRole = "user"
+)
+
+func (db *DB) CreateUser(ctx context.Context, created entity.User) (entity.User, error) {
+	defer db.lock(ctx)()
+
+	row := user{
+		User: entity.User{
+			Email:    created.Email,
+			Username: created.Username,
+			Password: created.Password,
+			Role:     defaultRole,
+		},
+	}
+
+	if err := db.tables.checkUnique(row); err != nil {
+		return entity.User{}, errors.Wrap(err, "failed to create user")
+	}
+
+	row.ID = db.nextID("cd_users")
+	db.tables.users[row.ID] = row
+
+	created.ID = row.ID
+	created.Role = row.Role
+
+	return created, nil
+}
+
+func (db *DB) GetUser(ctx context.Context, id uint64) (entity.User, error) {
+	defer db.lock(ctx)()
+
+	row, ok := db.tables.users[id]
+	if !ok || row.DeletedAt != nil {
+		return entity.User{}, errors.Wrap(pgx.ErrNoRows, "failed to get user")
+	}
+
+	return row.User, nil
+}
+
+// GetUserProfile is GetUser, the store has no replicas to lag behind.
+func (db *DB) GetUserProfile(ctx context.Context, id uint64) (entity.User, error) {
+	return db.GetUser(ctx, id)
+}
+
+func (db *DB) GetUserByEmail(ctx context.Context, email string) (entity.User, error) {
+	defer db.lock(ctx)()
+
+	for _, row := range db.tables.users {
+		if row.DeletedAt == nil && equalFold(row.Email, email) {
+			return row.User, nil
+		}
+	}
+
+	return entity.User{}, errors.Wrap(pgx.ErrNoRows, "failed to get user by email")
+}
+
+func (db *DB) GetUserByUsername(ctx context.Context, username string) (entity.User, error) {
+	defer db.lock(ctx)()
+
+	for _, row := range db.tables.users {
+		if row.DeletedAt == nil && equalFold(row.Username, username) {
+			return row.User, nil
+		}
+	}
+
+	return entity.User{}, errors.Wrap(pgx.ErrNoRows, "failed to get user by username")
+}
+
+// GetUserWithDeleted returns the user even if it is deleted, unless it was purged.
+func (db *DB) GetUserWithDeleted(ctx context.Context, id uint64) (entity.User, error) {
+	defer db.lock(ctx)()
+
+	row, ok := db.tables.users[id]
+	if !ok || row.purgedAt != nil {
+		return entity.User{}, errors.Wrap(pgx.ErrNoRows, "failed to get user with deleted")
+	}
+
+	return row.User, nil
+}
+
+func (db *DB) GetUsers(ctx context.Context, params entity.GetUsersParams) ([]entity.User, error) {
+	defer db.lock(ctx)()
+
+	if params.Limit == 0 {
+		params.Limit = limit
+	}
+
+	users := []entity.User{}
+
+	for _, row := range db.tables.sortedUsers() {
+		if params.Limit > 0 && len(users) == params.Limit {
+			break
+		}
+
+		switch {
+		case params.IncludeDeleted && row.purgedAt != nil,
+			!params.IncludeDeleted && row.DeletedAt != nil,
+			row.ID <= params.LastID,
+			params.Username != "" && !like(row.Username, params.Username),
+			params.Email != "" && !like(row.Email, params.Email),
+			params.EmailVerified != nil && *params.EmailVerified != row.IsEmailVerified():
+			continue
+		}
+
+		users = append(users, row.User)
+	}
+
+	return users, nil
+}
+
+// SetPendingEmail stores the address of an email change until expiresAt. It fails
+// with entity.ErrEmailAlreadyExists if another user owns the address or is changing
+// to it. A change that expired no longer holds the address.
+func (db *DB) SetPendingEmail(ctx context.Context, id uint64, email string, expiresAt time.Time) error {
+	defer db.lock(ctx)()
+
+	row, ok := db.tables.users[id]
+	if !ok || row.DeletedAt != nil {
+		return errors.Wrap(entity.ErrEmailAlreadyExists, "failed to set pending email")
+	}
+
+	for _, other := range db.tables.users {
+		if other.ID != id && other.DeletedAt == nil && equalFold(other.Email, email) {
+			return errors.Wrap(entity.ErrEmailAlreadyExists, "failed to set pending email")
+		}
+
+		if other.ID != id && equalFold(other.PendingEmail, email) && other.pendingEmailExpired() {
+			other.PendingEmail = ""
+			other.pendingEmailExpiresAt = nil
+			db.tables.users[other.ID] = other
+		}
+	}
+
+	row.PendingEmail = email
+	row.pendingEmailExpiresAt = &expiresAt
+
+	return errors.Wrap(db.tables.updateUser(row), "failed to set pending email")
+}
+
+// ConfirmEmail replaces the email with the pending one, if it still is the given
+// address, and reports whether it did.
+func (db *DB) ConfirmEmail(ctx context.Context, id uint64, email string) (bool, error) {
+	defer db.lock(ctx)()
+
+	row, ok := db.tables.users[id]
+	if !ok || row.PendingEmail == "" || !equalFold(row.PendingEmail, email) || row.pendingEmailExpired() {
+		return false, nil
+	}
+
+	row.Email = row.PendingEmail
+	row.PendingEmail = ""
+	row.pendingEmailExpiresAt = nil
+	row.EmailVerifiedAt = now()
+
+	if err := db.tables.updateUser(row); err != nil {
+		return false, errors.Wrap(err, "failed to confirm email")
+	}
+
+	return true, nil
+}
+
+// RevertEmail restores the previous email and locks the user.
+func (db *DB) RevertEmail(ctx context.Context, id uint64, email string) error {
+	defer db.lock(ctx)()
+
+	row, ok := db.tables.users[id]
+	if !ok {
+		return nil
+	}
+
+	row.Email = email
+	row.PendingEmail = ""
+	row.pendingEmailExpiresAt = nil
+	row.EmailVerifiedAt = now()
+	row.LockedAt = now()
+
+	return errors.Wrap(db.tables.updateUser(row), "failed to revert email")
+}
+
+func (db *DB) UnlockUser(ctx context.Context, id uint64) error {
+	defer db.lock(ctx)()
+
+	if row, ok := db.tables.users[id]; ok {
+		row.LockedAt = nil
+		db.tables.users[id] = row
+	}
+
+	return nil
+}
+
+func (db *DB) UpdateUsername(ctx context.Context, id uint64, username string) error {
+	defer db.lock(ctx)()
+
+	row, ok := db.tables.users[id]
+	if !ok || row.DeletedAt != nil {
+		return errors.Wrap(pgx.ErrNoRows, "failed to update username")
+	}
+
+	row.Username = username
+
+	return errors.Wrap(db.tables.updateUser(row), "failed to update username")
+}
+
+func (db *DB) UpdatePassword(ctx context.Context, id uint64, password string) error {
+	defer db.lock(ctx)()
+
+	if row, ok := db.tables.users[id]; ok {
+		row.Password = password
+		row.Salt = ""
+		db.tables.users[id] = row
+	}
+
+	return nil
+}
+
+// DeleteUser marks the user as deleted. It fails with pgx.ErrNoRows if there is no
+// such user or it is already deleted.
+func (db *DB) DeleteUser(ctx context.Context, id uint64) error {
+	defer db.lock(ctx)()
+
+	row, ok := db.tables.users[id]
+	if !ok || row.DeletedAt != nil {
+		return errors.Wrap(pgx.ErrNoRows, "failed to delete user")
+	}
+
+	row.DeletedAt = now()
+	db.tables.users[id] = row
+
+	return nil
+}
+
+// RestoreUser undoes the deletion of a user that was not purged yet. It fails with
+// pgx.ErrNoRows if there is no such deleted user, and with the entity errors of a
+// unique violation if another user took the email or the username meanwhile.
+func (db *DB) RestoreUser(ctx context.Context, id uint64) (entity.User, error) {
+	defer db.lock(ctx)()
+
+	row, ok := db.tables.users[id]
+	if !ok || row.DeletedAt == nil || row.purgedAt != nil {
+		return entity.User{}, errors.Wrap(pgx.ErrNoRows, "failed to restore user")
+	}
+
+	row.DeletedAt = nil
+
+	if err := db.tables.updateUser(row); err != nil {
+		return entity.User{}, errors.Wrap(err, "failed to restore user")
+	}
+
+	return row.User, nil
+}
+
+// PurgeUsers hard-deletes up to count users deleted before the given time, along
+// with everything that references them.
+func (db *DB) PurgeUsers(ctx context.Context, before time.Time, count int) (int64, error) {
+	defer db.lock(ctx)()
+
+	ids := db.tables.purgeable(before, count)
+
+	for _, id := range ids {
+		delete(db.tables.users, id)
+
+		db.tables.deleteUserData(id)
+
+		for ceremonyID, ceremony := range db.tables.ceremonies {
+			if ceremony.UserID == id {
+				delete(db.tables.ceremonies, ceremonyID)
+			}
+		}
+	}
+
+	return int64(len(ids)), nil
+}
+
+// AnonymizeUsers replaces the personal data of up to count users deleted before the
+// given time and drops their credentials, keeping the rows for references.
+func (db *DB) AnonymizeUsers(ctx context.Context, before time.Time, count int) (int64, error) {
+	defer db.lock(ctx)()
+
+	ids := db.tables.purgeable(before, count)
+
+	for _, id := range ids {
+		row := db.tables.users[id]
+
+		row.Email = fmt.Sprintf("deleted-%d@invalid", id)
+		row.Username = fmt.Sprintf("deleted-%d", id)
+		row.PendingEmail = ""
+		row.pendingEmailExpiresAt = nil
+		row.Password = ""
+		row.Salt = ""
+		row.purgedAt = now()
+
+		db.tables.users[id] = row
+
+		db.tables.deleteUserData(id)
+	}
+
+	return int64(len(ids)), nil
+}
+
+func (db *DB) VerifyEmail(ctx context.Context, id uint64) error {
+	defer db.lock(ctx)()
+
+	if row, ok := db.tables.users[id]; ok && row.EmailVerifiedAt == nil {
+		row.EmailVerifiedAt = now()
+		db.tables.users[id] = row
+	}
+
+	return nil
+}
+
+// GetIdentities returns the id, email, pending email and username of the users
+// after lastID, deleted ones included.
+func (db *DB) GetIdentities(ctx context.Context, lastID uint64, count int) ([]entity.User, error) {
+	defer db.lock(ctx)()
+
+	users := []entity.User{}
+
+	for _, row := range db.tables.sortedUsers() {
+		if len(users) == count {
+			break
+		}
+
+		if row.ID <= lastID {
+			continue
+		}
+
+		users = append(users, entity.User{
+			ID:           row.ID,
+			Email:        row.Email,
+			PendingEmail: row.PendingEmail,
+			Username:     row.Username,
+		})
+	}
+
+	return users, nil
+}
+
+func (db *DB) UpdateIdentity(ctx context.Context, identity entity.User) error {
+	defer db.lock(ctx)()
+
+	row, ok := db.tables.users[identity.ID]
+	if !ok {
+		return nil
+	}
+
+	row.Email = identity.Email
+	row.PendingEmail = identity.PendingEmail
+	row.Username = identity.Username
+
+	return errors.Wrap(db.tables.updateUser(row), "failed to update identity")
+}
+
+// updateUser stores the row unless it violates a unique index.
+// pendingEmailExpired reports whether the email change no longer holds the pending
+// address.
+func (u user) pendingEmailExpired() bool {
+	return u.pendingEmailExpiresAt == nil || !u.pendingEmailExpiresAt.After(time.Now())
+}
+
+func (t tables) updateUser(row user) error {
+	if err := t.checkUnique(row); err != nil {
+		return err
+	}
+
+	t.users[row.ID] = row
+
+	return nil
+}
+
+// checkUnique enforces the unique indexes of the users that are not deleted, in the
+// order Postgres checks them.
+func (t tables) checkUnique(row user) error {
+	if row.DeletedAt != nil {
+		return nil
+	}
+
+	var email, username, pendingEmail bool
+
+	for _, other := range t.users {
+		if other.ID == row.ID || other.DeletedAt != nil {
+			continue
+		}
+
+		email = email || equalFold(other.Email, row.Email)
+		username = username || equalFold(other.Username, row.Username)
+		pendingEmail = pendingEmail || row.PendingEmail != "" && equalFold(other.PendingEmail, row.PendingEmail)
+	}
+
+	switch {
+	case email:
+		return entity.ErrEmailAlreadyExists
+	case username:
+		return entity.ErrUsernameAlreadyExists
+	case pendingEmail:
+		return entity.ErrEmailAlreadyExists
+	}
+
+	return nil
+}
+
+func (t tables) sortedUsers() []user {
+	users := make([]user, 0, len(t.users))
+
+	for _, row := range t.users {
+		users = append(users, row)
+	}
+
+	slices.SortFunc(users, func(a, b user) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return users
+}
+
+// purgeable returns the ids of up to count users deleted before the given time that
+// were not purged yet, in the order of their ids.
+func (t tables) purgeable(before time.Time, count int) []uint64 {
+	ids := []uint64{}
+
+	for _, row := range t.sortedUsers() {
+		if len(ids) == count {
+			break
+		}
+
+		if row.DeletedAt != nil && row.DeletedAt.Before(before) && row.purgedAt == nil {
+			ids = append(ids, row.ID)
+		}
+	}
+
+	return ids
+}
+
+// deleteUserData drops the sessions, tokens and credentials of the user.
+func (t tables) deleteUserData(userID uint64) {
+	for id, session := range t.sessions {
+		if session.UserID == userID {
+			t.deleteSession(id)
+		}
+	}
+
+	for id, token := range t.userTokens {
+		if token.UserID == userID {
+			delete(t.userTokens, id)
+		}
+	}
+
+	for id, entry := range t.history {
+		if entry.UserID == userID {
+			delete(t.history, id)
+		}
+	}
+
+	delete(t.totp, userID)
+
+	t.deleteRecoveryCodes(userID)
+
+	for id, credential := range t.credentials {
+		if credential.UserID == userID {
+			delete(t.credentials, id)
+		}
+	}
+}
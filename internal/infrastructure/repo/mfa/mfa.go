@@ -0,0 +1,504 @@
+package mfa
+
+import (
+	"context"
+
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+type Repo struct {
+	db repo.DBTX
+}
+
+func NewRepo(db repo.DBTX) *Repo {
+	return &Repo{
+		db: db,
+	}
+}
+
+// SaveTOTP stores an unconfirmed secret, replacing a previous unfinished enrollment.
+func (r *Repo) SaveTOTP(ctx context.Context, totp entity.TOTP) error {
+	query := `
+		INSERT INTO cd_totp (user_id, secret)
+		VALUES (@user_id, @secret)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW(), confirmed_at = NULL
+		WHERE cd_totp.confirmed_at IS NULL
+	`
+
+	args := pgx.NamedArgs{
+		"user_id": totp.UserID,
+		"secret":  totp.Secret,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		return errors.Wrap(err, "failed to save totp")
+	}
+
+	return nil
+}
+
+func (r *Repo) GetTOTP(ctx context.Context, userID uint64) (entity.TOTP, error) {
+	query := `
+		SELECT user_id, secret, last_used_step, confirmed_at
+		FROM cd_totp
+		WHERE user_id = @user_id
+	`
+
+	args := pgx.NamedArgs{
+		"user_id": userID,
+	}
+
+	var totp entity.TOTP
+
+	err := r.db.QueryRow(ctx, query, args).Scan(&totp.UserID, &totp.Secret, &totp.LastUsedStep, &totp.ConfirmedAt)
+	if err != nil {
+		return entity.TOTP{}, errors.Wrap(err, "failed to get totp")
+	}
+
+	return totp, nil
+}
+
+func (r *Repo) ConfirmTOTP(ctx context.Context, userID uint64) error {
+	query := `
+		UPDATE cd_totp
+		SET confirmed_at = NOW()
+		WHERE user_id = @user_id
+	`
+
+	args := pgx.NamedArgs{
+		"user_id": userID,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		return errors.Wrap(err, "failed to confirm totp")
+	}
+
+	return nil
+}
+
+// UseTOTPStep records the time step of an accepted code and reports whether no
+// code of this or a later step was accepted before.
+func (r *Repo) UseTOTPStep(ctx context.Context, userID uint64, step int64) (bool, error) {
+	query := `
+		UPDATE cd_totp
+		SET last_used_step = @step
+		WHERE user_id = @user_id AND last_used_step < @step
+	`
+
+	args := pgx.NamedArgs{
+		"user_id": userID,
+		"step":    step,
+	}
+
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to use totp step")
+	}
+
+	return tag.RowsAffected() != 0, nil
+}
+
+// DeleteTOTP removes the secret together with the recovery codes.
+func (r *Repo) DeleteTOTP(ctx context.Context, userID uint64) error {
+	if r.db.Dialect() == repo.DialectSQLite {
+		return r.deleteTOTPSQLite(ctx, userID)
+	}
+
+	query := `
+		WITH codes AS (
+			DELETE FROM cd_recovery_codes
+			WHERE user_id = @user_id
+		)
+		DELETE FROM cd_totp
+		WHERE user_id = @user_id
+	`
+
+	args := pgx.NamedArgs{
+		"user_id": userID,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		return errors.Wrap(err, "failed to delete totp")
+	}
+
+	return nil
+}
+
+// deleteTOTPSQLite is DeleteTOTP for SQLite, which can't modify data in a WITH clause.
+func (r *Repo) deleteTOTPSQLite(ctx context.Context, userID uint64) error {
+	err := r.db.WithTx(ctx, func(ctx context.Context) error {
+		args := pgx.NamedArgs{
+			"user_id": userID,
+		}
+
+		if _, err := r.db.Exec(ctx, "DELETE FROM cd_recovery_codes WHERE user_id = @user_id", args); err != nil {
+			return err
+		}
+
+		_, err := r.db.Exec(ctx, "DELETE FROM cd_totp WHERE user_id = @user_id", args)
+
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to delete totp")
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes invalidates the existing recovery codes of the user and stores new ones.
+func (r *Repo) ReplaceRecoveryCodes(ctx context.Context, userID uint64, codeHashes []string) error {
+	if r.db.Dialect() == repo.DialectSQLite {
+		return r.replaceRecoveryCodesSQLite(ctx, userID, codeHashes)
+	}
+
+	query := `
+		WITH codes AS (
+			DELETE FROM cd_recovery_codes
+			WHERE user_id = @user_id
+		)
+		INSERT INTO cd_recovery_codes (user_id, code_hash)
+		SELECT @user_id, UNNEST(@code_hashes::VARCHAR[])
+	`
+
+	args := pgx.NamedArgs{
+		"user_id":     userID,
+		"code_hashes": codeHashes,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		return errors.Wrap(err, "failed to replace recovery codes")
+	}
+
+	return nil
+}
+
+// replaceRecoveryCodesSQLite is ReplaceRecoveryCodes for SQLite, which has neither
+// arrays nor data modifying WITH clauses. The hashes arrive as a JSON array.
+func (r *Repo) replaceRecoveryCodesSQLite(ctx context.Context, userID uint64, codeHashes []string) error {
+	err := r.db.WithTx(ctx, func(ctx context.Context) error {
+		args := pgx.NamedArgs{
+			"user_id": userID,
+		}
+
+		if _, err := r.db.Exec(ctx, "DELETE FROM cd_recovery_codes WHERE user_id = @user_id", args); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO cd_recovery_codes (user_id, code_hash)
+			SELECT @user_id, value
+			FROM json_each(@code_hashes)
+		`
+
+		args = pgx.NamedArgs{
+			"user_id":     userID,
+			"code_hashes": codeHashes,
+		}
+
+		_, err := r.db.Exec(ctx, query, args)
+
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to replace recovery codes")
+	}
+
+	return nil
+}
+
+// UseRecoveryCode consumes an unused recovery code and reports whether there was one.
+func (r *Repo) UseRecoveryCode(ctx context.Context, userID uint64, codeHash string) (bool, error) {
+	query := `
+		UPDATE cd_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = @user_id AND code_hash = @code_hash AND used_at IS NULL
+	`
+
+	args := pgx.NamedArgs{
+		"user_id":   userID,
+		"code_hash": codeHash,
+	}
+
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to use recovery code")
+	}
+
+	return tag.RowsAffected() != 0, nil
+}
+
+const webAuthnCredentialColumns = `
+	id, user_id, name, credential_id, public_key, attestation_type, aaguid, sign_count,
+	transports, backup_eligible, backup_state, clone_warning, created_at, last_used_at
+`
+
+func (r *Repo) CreateWebAuthnCredential(
+	ctx context.Context,
+	credential entity.WebAuthnCredential,
+) (entity.WebAuthnCredential, error) {
+	query := `
+		INSERT INTO cd_webauthn_credentials (
+			user_id, name, credential_id, public_key, attestation_type, aaguid, sign_count,
+			transports, backup_eligible, backup_state
+		)
+		VALUES (
+			@user_id, @name, @credential_id, @public_key, @attestation_type, @aaguid, @sign_count,
+			@transports, @backup_eligible, @backup_state
+		)
+		RETURNING ` + webAuthnCredentialColumns
+
+	args := pgx.NamedArgs{
+		"user_id":          credential.UserID,
+		"name":             credential.Name,
+		"credential_id":    credential.CredentialID,
+		"public_key":       credential.PublicKey,
+		"attestation_type": credential.AttestationType,
+		"aaguid":           credential.AAGUID,
+		"sign_count":       int64(credential.SignCount),
+		"transports":       credential.Transports,
+		"backup_eligible":  credential.BackupEligible,
+		"backup_state":     credential.BackupState,
+	}
+
+	created, err := scanWebAuthnCredential(r.db.QueryRow(ctx, query, args))
+	if err != nil {
+		return entity.WebAuthnCredential{}, errors.Wrap(err, "failed to create webauthn credential")
+	}
+
+	return created, nil
+}
+
+func (r *Repo) GetWebAuthnCredentials(ctx context.Context, userID uint64) ([]entity.WebAuthnCredential, error) {
+	query := `
+		SELECT ` + webAuthnCredentialColumns + `
+		FROM cd_webauthn_credentials
+		WHERE user_id = @user_id
+		ORDER BY id
+	`
+
+	args := pgx.NamedArgs{
+		"user_id": userID,
+	}
+
+	rows, err := r.db.Query(ctx, query, args)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get webauthn credentials")
+	}
+
+	defer rows.Close()
+
+	credentials := []entity.WebAuthnCredential{}
+
+	for rows.Next() {
+		credential, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan webauthn credential")
+		}
+
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, rows.Err()
+}
+
+func (r *Repo) HasWebAuthnCredentials(ctx context.Context, userID uint64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM cd_webauthn_credentials
+			WHERE user_id = @user_id
+		)
+	`
+
+	args := pgx.NamedArgs{
+		"user_id": userID,
+	}
+
+	var exists bool
+
+	if err := r.db.QueryRow(ctx, query, args).Scan(&exists); err != nil {
+		return false, errors.Wrap(err, "failed to check webauthn credentials")
+	}
+
+	return exists, nil
+}
+
+// UpdateWebAuthnCredential stores the counter and flags reported by the last assertion.
+func (r *Repo) UpdateWebAuthnCredential(ctx context.Context, credential entity.WebAuthnCredential) error {
+	query := `
+		UPDATE cd_webauthn_credentials
+		SET sign_count = @sign_count, backup_state = @backup_state, clone_warning = @clone_warning,
+			last_used_at = NOW()
+		WHERE id = @id
+	`
+
+	args := pgx.NamedArgs{
+		"id":            credential.ID,
+		"sign_count":    int64(credential.SignCount),
+		"backup_state":  credential.BackupState,
+		"clone_warning": credential.CloneWarning,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		return errors.Wrap(err, "failed to update webauthn credential")
+	}
+
+	return nil
+}
+
+func (r *Repo) DeleteWebAuthnCredential(ctx context.Context, userID uint64, id uint64) (bool, error) {
+	query := `
+		DELETE FROM cd_webauthn_credentials
+		WHERE id = @id AND user_id = @user_id
+	`
+
+	args := pgx.NamedArgs{
+		"id":      id,
+		"user_id": userID,
+	}
+
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to delete webauthn credential")
+	}
+
+	return tag.RowsAffected() != 0, nil
+}
+
+func (r *Repo) SaveWebAuthnCeremony(ctx context.Context, ceremony entity.WebAuthnCeremony) error {
+	query := `
+		INSERT INTO cd_webauthn_ceremonies (id, user_id, purpose, data, expires_at)
+		VALUES (@id, NULLIF(@user_id, 0), @purpose, @data, @expires_at)
+	`
+
+	args := pgx.NamedArgs{
+		"id":         ceremony.ID,
+		"user_id":    ceremony.UserID,
+		"purpose":    ceremony.Purpose,
+		"data":       ceremony.Data,
+		"expires_at": ceremony.ExpiresAt,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		return errors.Wrap(err, "failed to save webauthn ceremony")
+	}
+
+	return nil
+}
+
+// TakeWebAuthnCeremony removes an unexpired ceremony and returns it, so that every
+// challenge can be answered only once. Expired ceremonies are cleaned up on the way.
+func (r *Repo) TakeWebAuthnCeremony(ctx context.Context, id string, purpose string) (entity.WebAuthnCeremony, error) {
+	if r.db.Dialect() == repo.DialectSQLite {
+		return r.takeWebAuthnCeremonySQLite(ctx, id, purpose)
+	}
+
+	query := `
+		WITH expired AS (
+			DELETE FROM cd_webauthn_ceremonies
+			WHERE expires_at <= NOW()
+		)
+		DELETE FROM cd_webauthn_ceremonies
+		WHERE id = @id AND purpose = @purpose AND expires_at > NOW()
+		RETURNING id, COALESCE(user_id, 0), purpose, data, expires_at
+	`
+
+	args := pgx.NamedArgs{
+		"id":      id,
+		"purpose": purpose,
+	}
+
+	ceremony, err := scanWebAuthnCeremony(r.db.QueryRow(ctx, query, args))
+	if err != nil {
+		return entity.WebAuthnCeremony{}, errors.Wrap(err, "failed to take webauthn ceremony")
+	}
+
+	return ceremony, nil
+}
+
+// takeWebAuthnCeremonySQLite is TakeWebAuthnCeremony for SQLite, which can't modify
+// data in a WITH clause.
+func (r *Repo) takeWebAuthnCeremonySQLite(ctx context.Context, id string, purpose string) (entity.WebAuthnCeremony, error) {
+	var ceremony entity.WebAuthnCeremony
+
+	err := r.db.WithTx(ctx, func(ctx context.Context) error {
+		if _, err := r.db.Exec(ctx, "DELETE FROM cd_webauthn_ceremonies WHERE expires_at <= NOW()"); err != nil {
+			return err
+		}
+
+		query := `
+			DELETE FROM cd_webauthn_ceremonies
+			WHERE id = @id AND purpose = @purpose
+			RETURNING id, COALESCE(user_id, 0), purpose, data, expires_at
+		`
+
+		args := pgx.NamedArgs{
+			"id":      id,
+			"purpose": purpose,
+		}
+
+		var err error
+
+		ceremony, err = scanWebAuthnCeremony(r.db.QueryRow(ctx, query, args))
+
+		return err
+	})
+	if err != nil {
+		return entity.WebAuthnCeremony{}, errors.Wrap(err, "failed to take webauthn ceremony")
+	}
+
+	return ceremony, nil
+}
+
+func scanWebAuthnCeremony(row pgx.Row) (entity.WebAuthnCeremony, error) {
+	var ceremony entity.WebAuthnCeremony
+
+	err := row.Scan(
+		&ceremony.ID,
+		&ceremony.UserID,
+		&ceremony.Purpose,
+		&ceremony.Data,
+		&ceremony.ExpiresAt,
+	)
+	if err != nil {
+		return entity.WebAuthnCeremony{}, err
+	}
+
+	return ceremony, nil
+}
+
+func scanWebAuthnCredential(row pgx.Row) (entity.WebAuthnCredential, error) {
+	var (
+		credential entity.WebAuthnCredential
+		signCount  int64
+	)
+
+	err := row.Scan(
+		&credential.ID,
+		&credential.UserID,
+		&credential.Name,
+		&credential.CredentialID,
+		&credential.PublicKey,
+		&credential.AttestationType,
+		&credential.AAGUID,
+		&signCount,
+		&credential.Transports,
+		&credential.BackupEligible,
+		&credential.BackupState,
+		&credential.CloneWarning,
+		&credential.CreatedAt,
+		&credential.LastUsedAt,
+	)
+	if err != nil {
+		return entity.WebAuthnCredential{}, err
+	}
+
+	credential.SignCount = uint32(signCount)
+
+	return credential, nil
+}
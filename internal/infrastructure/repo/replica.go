@@ -0,0 +1,257 @@
+package repo
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// a replica that is in sync reports no lag, even if the primary had no writes for
+// a while and the last replayed transaction is old. Being in sync only means
+// something while the replica streams from the primary, a replica whose WAL
+// receiver is down has replayed all it got and falls behind unnoticed. The status
+// of the receiver is only shown to roles with pg_read_all_stats, for others a
+// running receiver is taken as streaming.
+const replicaLagQuery = `
+	SELECT
+		NOT pg_is_in_recovery() OR EXISTS (
+			SELECT 1 FROM pg_stat_wal_receiver WHERE COALESCE(status, 'streaming') = 'streaming'
+		),
+		CASE
+			WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM NOW() - pg_last_xact_replay_timestamp()), 0)
+		END
+`
+
+type replica struct {
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+}
+
+type replicas struct {
+	nodes    []*replica
+	next     atomic.Uint64
+	maxLag   time.Duration
+	interval time.Duration
+	stop     chan struct{}
+	once     sync.Once
+}
+
+func newReplicas(pools []*pgxpool.Pool, cfg Config) *replicas {
+	r := &replicas{
+		nodes:    make([]*replica, 0, len(pools)),
+		maxLag:   cfg.ReplicaMaxLag,
+		interval: cfg.ReplicaCheckInterval,
+		stop:     make(chan struct{}),
+	}
+
+	for _, pool := range pools {
+		r.nodes = append(r.nodes, &replica{
+			pool: pool,
+		})
+	}
+
+	return r
+}
+
+// pick returns the next healthy replica, or nil if there is none. Replicas only
+// become healthy once a check passed.
+func (r *replicas) pick() *replica {
+	for range r.nodes {
+		node := r.nodes[r.next.Add(1)%uint64(len(r.nodes))]
+
+		if node.healthy.Load() {
+			return node
+		}
+	}
+
+	return nil
+}
+
+// check takes the replicas that fail, lost the connection to the primary or lag too
+// far behind out of the rotation and puts them back once they caught up.
+func (r *replicas) check() {
+	if len(r.nodes) == 0 || r.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		r.checkAll()
+
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				r.checkAll()
+			}
+		}
+	}()
+}
+
+func (r *replicas) checkAll() {
+	for _, node := range r.nodes {
+		ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+
+		var (
+			streaming bool
+			lag       float64
+		)
+
+		err := node.pool.QueryRow(ctx, replicaLagQuery).Scan(&streaming, &lag)
+
+		cancel()
+
+		node.healthy.Store(err == nil && streaming && time.Duration(lag*float64(time.Second)) <= r.maxLag)
+	}
+}
+
+func (r *replicas) close() {
+	r.once.Do(func() {
+		close(r.stop)
+
+		for _, node := range r.nodes {
+			node.pool.Close()
+		}
+	})
+}
+
+// replicaDB runs the queries on a replica, see DB.Replica.
+type replicaDB struct {
+	db *DB
+}
+
+func (r replicaDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return r.db.Exec(ctx, sql, args...)
+}
+
+func (r replicaDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	node := r.replica(ctx)
+	if node == nil {
+		return r.db.Query(ctx, sql, args...)
+	}
+
+	rows, err := r.db.query(ctx, node.pool, sql, args...)
+	if err != nil && isTxRetryable(err) {
+		node.healthy.Store(false)
+
+		return r.db.Query(ctx, sql, args...)
+	}
+
+	return rows, err
+}
+
+func (r replicaDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	node := r.replica(ctx)
+	if node == nil {
+		return r.db.QueryRow(ctx, sql, args...)
+	}
+
+	return &replicaRow{
+		node: node,
+		row: row{
+			db:   r.db,
+			pool: node.pool,
+			ctx:  ctx,
+			sql:  sql,
+			args: args,
+		},
+	}
+}
+
+// WithTx runs the transaction on the primary, since it may write.
+func (r replicaDB) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.db.WithTx(ctx, fn)
+}
+
+func (r replicaDB) Dialect() Dialect {
+	return DialectPostgres
+}
+
+func (r replicaDB) replica(ctx context.Context) *replica {
+	if _, ok := ctx.Value(txKey{}).(*txState); ok {
+		return nil
+	}
+
+	if consistency, ok := ctx.Value(ConsistencyKey).(*Consistency); ok && consistency.primary.Load() {
+		return nil
+	}
+
+	return r.db.replicas.pick()
+}
+
+// replicaRow falls back to the primary if the replica fails.
+type replicaRow struct {
+	node *replica
+	row  row
+}
+
+func (r *replicaRow) Scan(dest ...any) error {
+	err := r.row.Scan(dest...)
+	if err != nil && isTxRetryable(err) {
+		r.node.healthy.Store(false)
+
+		r.row.pool = r.row.db.pool
+
+		return r.row.Scan(dest...)
+	}
+
+	return err
+}
+
+type consistencyKey string
+
+// ConsistencyKey is the context key of the Consistency of a request. Fiber
+// handlers can set it with c.Locals, since the request context resolves locals.
+const ConsistencyKey consistencyKey = "consistency"
+
+// Consistency makes a request read its own writes: once it wrote to the primary,
+// or if it asked to from the start, its reads skip the replicas.
+type Consistency struct {
+	primary atomic.Bool
+	wrote   atomic.Bool
+}
+
+// NewConsistency returns the consistency of a request, which reads from the
+// primary from the start if primary is set.
+func NewConsistency(primary bool) *Consistency {
+	consistency := &Consistency{}
+	consistency.primary.Store(primary)
+
+	return consistency
+}
+
+// WithConsistency returns a context that tracks its writes, see Consistency.
+func WithConsistency(ctx context.Context, consistency *Consistency) context.Context {
+	return context.WithValue(ctx, ConsistencyKey, consistency)
+}
+
+// Wrote reports whether the request wrote to the primary.
+func (c *Consistency) Wrote() bool {
+	return c.wrote.Load()
+}
+
+// markWrite sends the later reads of the context to the primary, unless the query
+// obviously only reads.
+func markWrite(ctx context.Context, sql string) {
+	consistency, ok := ctx.Value(ConsistencyKey).(*Consistency)
+	if !ok {
+		return
+	}
+
+	if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(sql)), "SELECT") {
+		return
+	}
+
+	consistency.wrote.Store(true)
+	consistency.primary.Store(true)
+}
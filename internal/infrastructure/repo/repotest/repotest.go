@@ -0,0 +1,125 @@
+// Package repotest opens migrated, empty databases for the tests of the
+// repositories and the services that run on them.
+package repotest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo"
+	"github.com/0x16F/cloud-users/internal/usecase/migrations"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+)
+
+// PostgresDSNEnv names the database the tests run against on Postgres. Every test
+// gets a schema of its own there, which is dropped afterwards. The locale of the
+// database must fold more than ASCII, like the ones of en_US.UTF-8 do and C doesn't.
+const PostgresDSNEnv = "TEST_POSTGRES_DSN"
+
+var schemas atomic.Uint64
+
+// SQLite opens a database in a temporary directory of the test.
+func SQLite(t testing.TB) *repo.SQLiteDB {
+	t.Helper()
+
+	db, err := repo.NewSQLiteDB(context.Background(), repo.Config{
+		SQLitePath:       filepath.Join(t.TempDir(), "users.db"),
+		MaxConns:         10,
+		StatementTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	migrate(t, db.DB(), db.Dialect(), repo.DriverSQLite)
+
+	return db
+}
+
+// Postgres connects to the database of PostgresDSNEnv, or skips the test if it is
+// not set.
+func Postgres(t testing.TB) *repo.DB {
+	t.Helper()
+
+	dsn := os.Getenv(PostgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", PostgresDSNEnv)
+	}
+
+	ctx := context.Background()
+
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", PostgresDSNEnv, err)
+	}
+
+	schema := fmt.Sprintf("test_%d_%d", os.Getpid(), schemas.Add(1))
+
+	run(t, dsn, "CREATE SCHEMA "+schema)
+
+	t.Cleanup(func() {
+		run(t, dsn, "DROP SCHEMA "+schema+" CASCADE")
+	})
+
+	// the extensions stay in public
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema + ", public"
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+
+	// runs before the schema is dropped
+	t.Cleanup(pool.Close)
+
+	migrate(t, stdlib.OpenDBFromPool(pool), repo.DialectPostgres, repo.DriverPostgres)
+
+	return repo.NewDB(pool, nil, repo.Config{
+		RetryAttempts:  3,
+		RetryBaseDelay: 10 * time.Millisecond,
+		RetryMaxDelay:  100 * time.Millisecond,
+	})
+}
+
+func run(t testing.TB, dsn string, query string) {
+	t.Helper()
+
+	conn, err := pgx.Connect(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+
+	defer conn.Close(context.Background())
+
+	if _, err = conn.Exec(context.Background(), query); err != nil {
+		t.Fatalf("failed to run %q: %v", query, err)
+	}
+}
+
+func migrate(t testing.TB, db *sql.DB, dialect repo.Dialect, driver string) {
+	t.Helper()
+
+	// the migrations are at the root of the module
+	_, file, _, _ := runtime.Caller(0)
+	path := filepath.Join(filepath.Dir(file), "..", "..", "..", "..", "migrations", driver)
+
+	goose.SetLogger(goose.NopLogger())
+
+	if err := migrations.Up(db, dialect, path); err != nil {
+		t.Fatalf("failed to run migrations: %v", err)
+	}
+}
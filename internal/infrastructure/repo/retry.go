@@ -0,0 +1,87 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+// backoff doubles the delay with every attempt up to max and picks a random delay
+// below it, so that clients failing together don't retry together.
+type backoff struct {
+	base time.Duration
+	max  time.Duration
+}
+
+func (b backoff) delay(attempt int) time.Duration {
+	delay := b.base
+
+	for i := 0; i < attempt && delay < b.max; i++ {
+		delay *= 2
+	}
+
+	delay = min(delay, b.max)
+	if delay <= 0 {
+		return 0
+	}
+
+	return rand.N(delay) + 1
+}
+
+// retry runs fn until it succeeds, fails with an error retryable doesn't accept or
+// the attempts run out.
+func (b backoff) retry(ctx context.Context, attempts int, retryable func(error) bool, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt+1 >= attempts || !retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(b.delay(attempt)):
+		}
+	}
+}
+
+// isConflict reports a serialization failure or a deadlock. The database rolled
+// back the statement, so running it again is safe.
+func isConflict(err error) bool {
+	var pgErr *pgconn.PgError
+
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	return pgErr.Code == serializationFailure || pgErr.Code == deadlockDetected
+}
+
+// isStatementRetryable reports whether a single statement can run again: after a
+// conflict, or when the connection failed before the statement reached the
+// database. A connection lost later might have applied the statement already.
+func isStatementRetryable(err error) bool {
+	return isConflict(err) || pgconn.SafeToRetry(err)
+}
+
+// isTxRetryable reports whether a transaction can run again. A lost connection
+// rolls the transaction back, so unlike a single statement it is retryable
+// whenever it happened. The commit is the exception, see DB.WithTx.
+func isTxRetryable(err error) bool {
+	var netErr net.Error
+
+	return isStatementRetryable(err) ||
+		errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
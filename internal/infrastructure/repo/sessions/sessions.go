@@ -0,0 +1,242 @@
+package sessions
+
+import (
+	"context"
+	"time"
+
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+const (
+	sessionColumns = "id, user_id, user_agent, ip, created_at, last_used_at, expires_at, revoked_at"
+)
+
+type Repo struct {
+	db repo.DBTX
+}
+
+func NewRepo(db repo.DBTX) *Repo {
+	return &Repo{
+		db: db,
+	}
+}
+
+func (r *Repo) CreateSession(ctx context.Context, session entity.Session) (entity.Session, error) {
+	query := `
+		INSERT INTO cd_sessions (user_id, user_agent, ip, expires_at)
+		VALUES (@user_id, @user_agent, @ip, @expires_at)
+		RETURNING ` + sessionColumns
+
+	args := pgx.NamedArgs{
+		"user_id":    session.UserID,
+		"user_agent": session.UserAgent,
+		"ip":         session.IP,
+		"expires_at": session.ExpiresAt,
+	}
+
+	session, err := scanSession(r.db.QueryRow(ctx, query, args))
+	if err != nil {
+		return entity.Session{}, errors.Wrap(err, "failed to create session")
+	}
+
+	return session, nil
+}
+
+func (r *Repo) GetSession(ctx context.Context, id uint64) (entity.Session, error) {
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM cd_sessions
+		WHERE id = @id
+	`
+
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	session, err := scanSession(r.db.QueryRow(ctx, query, args))
+	if err != nil {
+		return entity.Session{}, errors.Wrap(err, "failed to get session")
+	}
+
+	return session, nil
+}
+
+// GetSessions returns the sessions of the user that are neither revoked nor expired.
+func (r *Repo) GetSessions(ctx context.Context, userID uint64) ([]entity.Session, error) {
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM cd_sessions
+		WHERE user_id = @user_id AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC
+	`
+
+	args := pgx.NamedArgs{
+		"user_id": userID,
+	}
+
+	rows, err := r.db.Query(ctx, query, args)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get sessions")
+	}
+
+	defer rows.Close()
+
+	sessions := []entity.Session{}
+
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan session")
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// TouchSession records a use of the session and extends its expiry.
+func (r *Repo) TouchSession(ctx context.Context, id uint64, device entity.Device, expiresAt time.Time) error {
+	query := `
+		UPDATE cd_sessions
+		SET user_agent = @user_agent, ip = @ip, last_used_at = NOW(), expires_at = @expires_at
+		WHERE id = @id
+	`
+
+	args := pgx.NamedArgs{
+		"id":         id,
+		"user_agent": device.UserAgent,
+		"ip":         device.IP,
+		"expires_at": expiresAt,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		return errors.Wrap(err, "failed to touch session")
+	}
+
+	return nil
+}
+
+// RevokeSession revokes an active session of the user and reports whether there was one.
+func (r *Repo) RevokeSession(ctx context.Context, userID uint64, id uint64) (bool, error) {
+	query := `
+		UPDATE cd_sessions
+		SET revoked_at = NOW()
+		WHERE id = @id AND user_id = @user_id AND revoked_at IS NULL
+	`
+
+	args := pgx.NamedArgs{
+		"id":      id,
+		"user_id": userID,
+	}
+
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to revoke session")
+	}
+
+	return tag.RowsAffected() != 0, nil
+}
+
+// RevokeSessions revokes every active session of the user except the given one.
+func (r *Repo) RevokeSessions(ctx context.Context, userID uint64, exceptID uint64) error {
+	query := `
+		UPDATE cd_sessions
+		SET revoked_at = NOW()
+		WHERE user_id = @user_id AND id <> @except_id AND revoked_at IS NULL
+	`
+
+	args := pgx.NamedArgs{
+		"user_id":   userID,
+		"except_id": exceptID,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		return errors.Wrap(err, "failed to revoke sessions")
+	}
+
+	return nil
+}
+
+func (r *Repo) CreateRefreshToken(ctx context.Context, token entity.RefreshToken) error {
+	query := `
+		INSERT INTO cd_refresh_tokens (session_id, token_hash)
+		VALUES (@session_id, @token_hash)
+	`
+
+	args := pgx.NamedArgs{
+		"session_id": token.SessionID,
+		"token_hash": token.TokenHash,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		return errors.Wrap(err, "failed to create refresh token")
+	}
+
+	return nil
+}
+
+func (r *Repo) GetRefreshToken(ctx context.Context, tokenHash string) (entity.RefreshToken, error) {
+	query := `
+		SELECT id, session_id, token_hash, used_at
+		FROM cd_refresh_tokens
+		WHERE token_hash = @token_hash
+	`
+
+	args := pgx.NamedArgs{
+		"token_hash": tokenHash,
+	}
+
+	var token entity.RefreshToken
+
+	err := r.db.QueryRow(ctx, query, args).Scan(&token.ID, &token.SessionID, &token.TokenHash, &token.UsedAt)
+	if err != nil {
+		return entity.RefreshToken{}, errors.Wrap(err, "failed to get refresh token")
+	}
+
+	return token, nil
+}
+
+// UseRefreshToken marks the token as used and reports whether it was unused before.
+// Concurrent uses of the same token are serialized by the row update.
+func (r *Repo) UseRefreshToken(ctx context.Context, id uint64) (bool, error) {
+	query := `
+		UPDATE cd_refresh_tokens
+		SET used_at = NOW()
+		WHERE id = @id AND used_at IS NULL
+	`
+
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to use refresh token")
+	}
+
+	return tag.RowsAffected() != 0, nil
+}
+
+func scanSession(row pgx.Row) (entity.Session, error) {
+	var session entity.Session
+
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IP,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+	)
+	if err != nil {
+		return entity.Session{}, err
+	}
+
+	return session, nil
+}
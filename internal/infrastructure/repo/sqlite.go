@@ -0,0 +1,415 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+)
+
+// timestamps are stored as UTC text of a fixed width, so that they sort like the
+// times they stand for, also against sqliteNow
+const (
+	sqliteTimeFormat = "2006-01-02 15:04:05.000"
+	sqliteNow        = "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+)
+
+const sqliteConstraint = 19
+
+var sqliteConstraintPattern = regexp.MustCompile(`(UNIQUE|FOREIGN KEY|NOT NULL|CHECK) constraint failed(?:: ([\w.]+(?:, [\w.]+)*))?`)
+
+// the SQLSTATE Postgres reports for the same violation
+var sqliteConstraintCodes = map[string]string{
+	"UNIQUE":      "23505",
+	"FOREIGN KEY": "23503",
+	"NOT NULL":    "23502",
+	"CHECK":       "23514",
+}
+
+type sqliteTxKey struct{}
+
+// sqliteConn is what both the database and a transaction run queries on.
+type sqliteConn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// SQLiteDB runs the queries of the repositories on SQLite. They are written for
+// Postgres, so it translates what SQLite has in another form: pgx.NamedArgs, NOW(),
+// timestamps, which it stores as UTC text, and string arrays, which it stores as
+// JSON. Errors look like the ones of pgx: a missing row is pgx.ErrNoRows and a
+// constraint violation is a *pgconn.PgError with the code and, for unique
+// violations, the constraint name Postgres would report. Emails and usernames
+// compare and match LIKE patterns the way CITEXT does, see sqliteCollation.
+// Queries that differ beyond that are up to the repositories, see Dialect.
+type SQLiteDB struct {
+	db *sql.DB
+}
+
+// NewSQLiteDB opens the database file of the config, creating it if needed.
+// Transactions take the write lock when they begin, and wait for it at most
+// StatementTimeout, so that concurrent transactions queue up instead of failing.
+func NewSQLiteDB(ctx context.Context, cfg Config) (*SQLiteDB, error) {
+	query := url.Values{}
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Add("_pragma", "journal_mode(WAL)")
+	query.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", cfg.StatementTimeout.Milliseconds()))
+	query.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+cfg.SQLitePath+"?"+query.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	db.SetMaxOpenConns(int(cfg.MaxConns))
+	db.SetConnMaxLifetime(cfg.MaxConnLifetime)
+	db.SetConnMaxIdleTime(cfg.MaxConnIdleTime)
+
+	if err = db.PingContext(ctx); err != nil {
+		_ = db.Close()
+
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	return &SQLiteDB{
+		db: db,
+	}, nil
+}
+
+// DB returns the database, for the migrations.
+func (s *SQLiteDB) DB() *sql.DB {
+	return s.db
+}
+
+func (s *SQLiteDB) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteDB) Dialect() Dialect {
+	return DialectSQLite
+}
+
+func (s *SQLiteDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	query, params := translateSQLite(sql, args)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, params...)
+	if err != nil {
+		return pgconn.CommandTag{}, sqliteError(err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return pgconn.CommandTag{}, sqliteError(err)
+	}
+
+	command, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+
+	return pgconn.NewCommandTag(strings.ToUpper(command) + " " + strconv.FormatInt(affected, 10)), nil
+}
+
+func (s *SQLiteDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	query, params := translateSQLite(sql, args)
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+
+	return &sqliteRows{
+		rows: rows,
+	}, nil
+}
+
+func (s *SQLiteDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	query, params := translateSQLite(sql, args)
+
+	return &sqliteRow{
+		row: s.conn(ctx).QueryRowContext(ctx, query, params...),
+	}
+}
+
+// WithTx runs fn in a transaction, which the queries on the context passed to fn
+// join. The transaction commits if fn returns nil and rolls back otherwise, the
+// error of fn is returned as is. A call inside fn joins the outer transaction.
+func (s *SQLiteDB) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(sqliteTxKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return sqliteError(err)
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err = fn(context.WithValue(ctx, sqliteTxKey{}, tx)); err != nil {
+		return err
+	}
+
+	return sqliteError(tx.Commit())
+}
+
+func (s *SQLiteDB) conn(ctx context.Context) sqliteConn {
+	if tx, ok := ctx.Value(sqliteTxKey{}).(*sql.Tx); ok {
+		return tx
+	}
+
+	return s.db
+}
+
+// translateSQLite turns a query and its arguments for pgx into ones for SQLite,
+// which takes @name parameters as well.
+func translateSQLite(query string, args []any) (string, []any) {
+	query = strings.ReplaceAll(query, "NOW()", sqliteNow)
+
+	if len(args) == 1 {
+		if named, ok := args[0].(pgx.NamedArgs); ok {
+			params := make([]any, 0, len(named))
+
+			for name, value := range named {
+				params = append(params, sql.Named(name, sqliteValue(value)))
+			}
+
+			return query, params
+		}
+	}
+
+	params := make([]any, 0, len(args))
+
+	for _, value := range args {
+		params = append(params, sqliteValue(value))
+	}
+
+	return query, params
+}
+
+func sqliteValue(value any) any {
+	switch value := value.(type) {
+	case time.Time:
+		return value.UTC().Format(sqliteTimeFormat)
+	case *time.Time:
+		if value == nil {
+			return nil
+		}
+
+		return value.UTC().Format(sqliteTimeFormat)
+	case []string:
+		encoded, _ := json.Marshal(append([]string{}, value...))
+
+		return string(encoded)
+	}
+
+	return value
+}
+
+// sqliteError maps the errors of SQLite to the ones pgx reports for Postgres.
+func sqliteError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return pgx.ErrNoRows
+	}
+
+	var sqliteErr *sqlite.Error
+
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code()&0xff != sqliteConstraint {
+		return err
+	}
+
+	match := sqliteConstraintPattern.FindStringSubmatch(sqliteErr.Error())
+	if match == nil {
+		return err
+	}
+
+	pgErr := &pgconn.PgError{
+		Severity: "ERROR",
+		Code:     sqliteConstraintCodes[match[1]],
+		Message:  sqliteErr.Error(),
+	}
+
+	// "cd_users.email" is the column of the index Postgres calls cd_users_email_key
+	if match[1] == "UNIQUE" && match[2] != "" {
+		columns := strings.Split(match[2], ", ")
+		table, _, _ := strings.Cut(columns[0], ".")
+
+		name := []string{table}
+
+		for _, column := range columns {
+			_, column, _ = strings.Cut(column, ".")
+			name = append(name, column)
+		}
+
+		pgErr.ConstraintName = strings.Join(name, "_") + "_key"
+	}
+
+	return pgErr
+}
+
+// sqliteDest lets the destinations of Scan take the values SQLite stores for
+// timestamps and string arrays.
+func sqliteDest(dest []any) []any {
+	mapped := make([]any, len(dest))
+
+	for i, d := range dest {
+		switch d := d.(type) {
+		case *time.Time:
+			mapped[i] = &sqliteTime{dest: d}
+		case **time.Time:
+			mapped[i] = &sqliteNullTime{dest: d}
+		case *[]string:
+			mapped[i] = &sqliteStrings{dest: d}
+		default:
+			mapped[i] = d
+		}
+	}
+
+	return mapped
+}
+
+type sqliteTime struct {
+	dest *time.Time
+}
+
+func (t *sqliteTime) Scan(src any) error {
+	switch src := src.(type) {
+	case time.Time:
+		*t.dest = src.UTC()
+
+		return nil
+	case string:
+		return t.parse(src)
+	case []byte:
+		return t.parse(string(src))
+	}
+
+	return fmt.Errorf("cannot scan %T into a time", src)
+}
+
+func (t *sqliteTime) parse(src string) error {
+	parsed, err := time.Parse("2006-01-02 15:04:05.999999999", src)
+	if err != nil {
+		return err
+	}
+
+	*t.dest = parsed
+
+	return nil
+}
+
+type sqliteNullTime struct {
+	dest **time.Time
+}
+
+func (t *sqliteNullTime) Scan(src any) error {
+	if src == nil {
+		*t.dest = nil
+
+		return nil
+	}
+
+	var value time.Time
+
+	if err := (&sqliteTime{dest: &value}).Scan(src); err != nil {
+		return err
+	}
+
+	*t.dest = &value
+
+	return nil
+}
+
+type sqliteStrings struct {
+	dest *[]string
+}
+
+func (s *sqliteStrings) Scan(src any) error {
+	switch src := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(src), s.dest)
+	case []byte:
+		return json.Unmarshal(src, s.dest)
+	}
+
+	return fmt.Errorf("cannot scan %T into strings", src)
+}
+
+type sqliteRow struct {
+	row *sql.Row
+}
+
+func (r *sqliteRow) Scan(dest ...any) error {
+	return sqliteError(r.row.Scan(sqliteDest(dest)...))
+}
+
+// sqliteRows implements the part of pgx.Rows the repositories use.
+type sqliteRows struct {
+	rows *sql.Rows
+}
+
+func (r *sqliteRows) Close() {
+	_ = r.rows.Close()
+}
+
+func (r *sqliteRows) Err() error {
+	return sqliteError(r.rows.Err())
+}
+
+func (r *sqliteRows) CommandTag() pgconn.CommandTag {
+	return pgconn.CommandTag{}
+}
+
+func (r *sqliteRows) FieldDescriptions() []pgconn.FieldDescription {
+	return nil
+}
+
+func (r *sqliteRows) Next() bool {
+	return r.rows.Next()
+}
+
+func (r *sqliteRows) Scan(dest ...any) error {
+	return r.rows.Scan(sqliteDest(dest)...)
+}
+
+func (r *sqliteRows) Values() ([]any, error) {
+	columns, err := r.rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]any, len(columns))
+	dest := make([]any, len(columns))
+
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	if err = r.rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func (r *sqliteRows) RawValues() [][]byte {
+	return nil
+}
+
+func (r *sqliteRows) Conn() *pgx.Conn {
+	return nil
+}
@@ -0,0 +1,36 @@
+package users
+
+import (
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+)
+
+const (
+	uniqueViolation = "23505"
+)
+
+const (
+	emailConstraint        = "cd_users_email_key"
+	pendingEmailConstraint = "cd_users_pending_email_key"
+	usernameConstraint     = "cd_users_username_key"
+)
+
+// mapUniqueViolation turns a unique violation of the users table into the matching
+// entity error, so that concurrent writes don't need a check before them.
+func mapUniqueViolation(err error) error {
+	var pgErr *pgconn.PgError
+
+	if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolation {
+		return err
+	}
+
+	switch pgErr.ConstraintName {
+	case emailConstraint, pendingEmailConstraint:
+		return entity.ErrEmailAlreadyExists
+	case usernameConstraint:
+		return entity.ErrUsernameAlreadyExists
+	}
+
+	return err
+}
@@ -0,0 +1,88 @@
+package users
+
+import (
+	"context"
+
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// AddPasswordHistory stores a replaced password hash and drops all but the keep
+// most recent ones of the user.
+func (r *Repo) AddPasswordHistory(ctx context.Context, entry entity.PasswordHistoryEntry, keep int) error {
+	query := `
+		INSERT INTO cd_password_history (user_id, password, salt)
+		VALUES (@user_id, @password, NULLIF(@salt, ''))
+	`
+
+	args := pgx.NamedArgs{
+		"user_id":  entry.UserID,
+		"password": entry.Password,
+		"salt":     entry.Salt,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		return errors.Wrap(err, "failed to add password history")
+	}
+
+	query = `
+		DELETE FROM cd_password_history
+		WHERE user_id = @user_id AND id NOT IN (
+			SELECT id
+			FROM cd_password_history
+			WHERE user_id = @user_id
+			ORDER BY id DESC
+			LIMIT @keep
+		)
+	`
+
+	args = pgx.NamedArgs{
+		"user_id": entry.UserID,
+		"keep":    keep,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		return errors.Wrap(err, "failed to prune password history")
+	}
+
+	return nil
+}
+
+// GetPasswordHistory returns the most recent replaced password hashes of the user,
+// newest first.
+func (r *Repo) GetPasswordHistory(ctx context.Context, userID uint64, count int) ([]entity.PasswordHistoryEntry, error) {
+	query := `
+		SELECT user_id, password, COALESCE(salt, ''), created_at
+		FROM cd_password_history
+		WHERE user_id = @user_id
+		ORDER BY id DESC
+		LIMIT @limit
+	`
+
+	args := pgx.NamedArgs{
+		"user_id": userID,
+		"limit":   count,
+	}
+
+	rows, err := r.db.Query(ctx, query, args)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get password history")
+	}
+
+	defer rows.Close()
+
+	entries := []entity.PasswordHistoryEntry{}
+
+	for rows.Next() {
+		var entry entity.PasswordHistoryEntry
+
+		if err = rows.Scan(&entry.UserID, &entry.Password, &entry.Salt, &entry.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, "failed to scan password history")
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, errors.Wrap(rows.Err(), "failed to get password history")
+}
@@ -0,0 +1,111 @@
+package users
+
+import (
+	"context"
+
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+func (r *Repo) CreateToken(ctx context.Context, token entity.UserToken) error {
+	query := `
+		INSERT INTO cd_user_tokens (user_id, purpose, token_hash, payload, expires_at)
+		VALUES (@user_id, @purpose, @token_hash, @payload, @expires_at)
+	`
+
+	args := pgx.NamedArgs{
+		"user_id":    token.UserID,
+		"purpose":    token.Purpose,
+		"token_hash": token.TokenHash,
+		"payload":    token.Payload,
+		"expires_at": token.ExpiresAt,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		return errors.Wrap(err, "failed to create token")
+	}
+
+	return nil
+}
+
+// GetToken returns an unused and unexpired token without using it.
+func (r *Repo) GetToken(ctx context.Context, tokenHash string, purpose string) (entity.UserToken, error) {
+	query := `
+		SELECT id, user_id, purpose, token_hash, payload, expires_at
+		FROM cd_user_tokens
+		WHERE token_hash = @token_hash AND purpose = @purpose AND used_at IS NULL AND expires_at > NOW()
+	`
+
+	args := pgx.NamedArgs{
+		"token_hash": tokenHash,
+		"purpose":    purpose,
+	}
+
+	var token entity.UserToken
+
+	err := r.db.QueryRow(ctx, query, args).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.Payload,
+		&token.ExpiresAt,
+	)
+	if err != nil {
+		return entity.UserToken{}, errors.Wrap(err, "failed to get token")
+	}
+
+	return token, nil
+}
+
+// UseToken marks an unused and unexpired token as used and returns it, so that a
+// token can be redeemed only once.
+func (r *Repo) UseToken(ctx context.Context, tokenHash string, purpose string) (entity.UserToken, error) {
+	query := `
+		UPDATE cd_user_tokens
+		SET used_at = NOW()
+		WHERE token_hash = @token_hash AND purpose = @purpose AND used_at IS NULL AND expires_at > NOW()
+		RETURNING id, user_id, purpose, token_hash, payload, expires_at
+	`
+
+	args := pgx.NamedArgs{
+		"token_hash": tokenHash,
+		"purpose":    purpose,
+	}
+
+	var token entity.UserToken
+
+	err := r.db.QueryRow(ctx, query, args).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.Payload,
+		&token.ExpiresAt,
+	)
+	if err != nil {
+		return entity.UserToken{}, errors.Wrap(err, "failed to use token")
+	}
+
+	return token, nil
+}
+
+// DeleteTokens removes every token of the user issued for the purpose.
+func (r *Repo) DeleteTokens(ctx context.Context, userID uint64, purpose string) error {
+	query := `
+		DELETE FROM cd_user_tokens
+		WHERE user_id = @user_id AND purpose = @purpose
+	`
+
+	args := pgx.NamedArgs{
+		"user_id": userID,
+		"purpose": purpose,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		return errors.Wrap(err, "failed to delete tokens")
+	}
+
+	return nil
+}
@@ -2,12 +2,12 @@ package users
 
 import (
 	"context"
-	"strings"
+	"time"
 
 	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo"
 	"github.com/huandu/go-sqlbuilder"
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pkg/errors"
 )
 
@@ -15,55 +15,79 @@ const (
 	limit = 1000
 )
 
+// the tables AnonymizeUsers drops the rows of the users from
+var purgedUserTables = []string{
+	"cd_sessions",
+	"cd_user_tokens",
+	"cd_password_history",
+	"cd_totp",
+	"cd_recovery_codes",
+	"cd_webauthn_credentials",
+}
+
+const (
+	userColumns = "id, email, email_verified_at, COALESCE(pending_email, ''), username, role, password, " +
+		"COALESCE(salt, ''), locked_at, deleted_at"
+)
+
+// Repo runs the reads that only show users, GetUsers and GetUserProfile, on
+// replica, which may lag behind db, and everything else on db. Lookups that decide
+// about access, such as the ones of a login, must see a password change, a lock
+// or a deletion at once.
 type Repo struct {
-	db *pgxpool.Conn
+	db      repo.DBTX
+	replica repo.DBTX
 }
 
-func NewRepo(db *pgxpool.Conn) *Repo {
+func NewRepo(db repo.DBTX, replica repo.DBTX) *Repo {
 	return &Repo{
-		db: db,
+		db:      db,
+		replica: replica,
 	}
 }
 
 func (r *Repo) CreateUser(ctx context.Context, user entity.User) (entity.User, error) {
 	query := `
-		INSERT INTO cd_users (email, username, password, salt)
-		VALUES (@email, @username, @password, @salt)
-		RETURNING id
+		INSERT INTO cd_users (email, username, password)
+		VALUES (@email, @username, @password)
+		RETURNING id, role
 	`
 
 	args := pgx.NamedArgs{
 		"email":    user.Email,
 		"username": user.Username,
 		"password": user.Password,
-		"salt":     user.Salt,
 	}
 
-	var id uint64
-
-	if err := r.db.QueryRow(ctx, query, args).Scan(&id); err != nil {
-		return entity.User{}, errors.Wrap(err, "failed to create user")
+	if err := r.db.QueryRow(ctx, query, args).Scan(&user.ID, &user.Role); err != nil {
+		return entity.User{}, errors.Wrap(mapUniqueViolation(err), "failed to create user")
 	}
 
-	user.ID = id
-
 	return user, nil
 }
 
 func (r *Repo) GetUser(ctx context.Context, id uint64) (entity.User, error) {
+	return r.getUser(ctx, r.db, id)
+}
+
+// GetUserProfile is GetUser on a replica, for showing the user. The user may be
+// behind the primary, so nothing that decides about access reads it.
+func (r *Repo) GetUserProfile(ctx context.Context, id uint64) (entity.User, error) {
+	return r.getUser(ctx, r.replica, id)
+}
+
+func (r *Repo) getUser(ctx context.Context, db repo.DBTX, id uint64) (entity.User, error) {
 	query := `
-		SELECT id, email, username, password, salt
+		SELECT ` + userColumns + `
 		FROM cd_users
-		WHERE id = @id
+		WHERE id = @id AND deleted_at IS NULL
 	`
 
 	args := pgx.NamedArgs{
 		"id": id,
 	}
 
-	var user entity.User
-
-	err := r.db.QueryRow(ctx, query, args).Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Salt)
+	user, err := scanUser(db.QueryRow(ctx, query, args))
 	if err != nil {
 		return entity.User{}, errors.Wrap(err, "failed to get user")
 	}
@@ -73,18 +97,16 @@ func (r *Repo) GetUser(ctx context.Context, id uint64) (entity.User, error) {
 
 func (r *Repo) GetUserByEmail(ctx context.Context, email string) (entity.User, error) {
 	query := `
-		SELECT id, email, username, password, salt
+		SELECT ` + userColumns + `
 		FROM cd_users
-		WHERE email = LOWER(@email)
+		WHERE email = @email AND deleted_at IS NULL
 	`
 
 	args := pgx.NamedArgs{
 		"email": email,
 	}
 
-	var user entity.User
-
-	err := r.db.QueryRow(ctx, query, args).Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Salt)
+	user, err := scanUser(r.db.QueryRow(ctx, query, args))
 	if err != nil {
 		return entity.User{}, errors.Wrap(err, "failed to get user by email")
 	}
@@ -94,24 +116,41 @@ func (r *Repo) GetUserByEmail(ctx context.Context, email string) (entity.User, e
 
 func (r *Repo) GetUserByUsername(ctx context.Context, username string) (entity.User, error) {
 	query := `
-		SELECT id, email, username, password, salt
+		SELECT ` + userColumns + `
 		FROM cd_users
-		WHERE username = LOWER(@username)
+		WHERE username = @username AND deleted_at IS NULL
 	`
 
 	args := pgx.NamedArgs{
 		"username": username,
 	}
 
-	var user entity.User
-
-	err := r.db.QueryRow(ctx, query, args).Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Salt)
+	user, err := scanUser(r.db.QueryRow(ctx, query, args))
 	if err != nil {
 		return entity.User{}, errors.Wrap(err, "failed to get user by username")
 	}
 
 	return user, nil
+}
+
+// GetUserWithDeleted returns the user even if it is deleted, unless it was purged.
+func (r *Repo) GetUserWithDeleted(ctx context.Context, id uint64) (entity.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM cd_users
+		WHERE id = @id AND purged_at IS NULL
+	`
+
+	args := pgx.NamedArgs{
+		"id": id,
+	}
 
+	user, err := scanUser(r.db.QueryRow(ctx, query, args))
+	if err != nil {
+		return entity.User{}, errors.Wrap(err, "failed to get user with deleted")
+	}
+
+	return user, nil
 }
 
 func (r *Repo) GetUsers(ctx context.Context, params entity.GetUsersParams) ([]entity.User, error) {
@@ -119,50 +158,150 @@ func (r *Repo) GetUsers(ctx context.Context, params entity.GetUsersParams) ([]en
 		params.Limit = limit
 	}
 
-	sb := sqlbuilder.NewSelectBuilder()
+	sb := r.replica.Dialect().Flavor().NewSelectBuilder()
 
-	sb.Select("id", "email", "username", "password", "salt")
+	sb.Select(userColumns)
 	sb.From("cd_users")
+	sb.OrderBy("id")
 	sb.Limit(params.Limit)
 
+	if params.IncludeDeleted {
+		sb.Where(sb.IsNull("purged_at"))
+	} else {
+		sb.Where(sb.IsNull("deleted_at"))
+	}
+
 	if params.LastID != 0 {
 		sb.Where(sb.GT("id", params.LastID))
 	}
 
 	if params.Username != "" {
-		sb.Where(sb.Like("username", strings.ToLower(params.Username)))
+		sb.Where(r.like(sb, "username", params.Username))
 	}
 
 	if params.Email != "" {
-		sb.Where(sb.Like("email", strings.ToLower(params.Email)))
+		sb.Where(r.like(sb, "email", params.Email))
+	}
+
+	if params.EmailVerified != nil {
+		if *params.EmailVerified {
+			sb.Where(sb.IsNotNull("email_verified_at"))
+		} else {
+			sb.Where(sb.IsNull("email_verified_at"))
+		}
 	}
 
 	query, args := sb.Build()
 
-	rows, err := r.db.Query(ctx, query, args...)
+	rows, err := r.replica.Query(ctx, query, args...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get users")
 	}
 
+	defer rows.Close()
+
 	users := []entity.User{}
 
 	for rows.Next() {
-		var user entity.User
-
-		if err := rows.Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Salt); err != nil {
+		user, err := scanUser(rows)
+		if err != nil {
 			return nil, errors.Wrap(err, "failed to scan user")
 		}
 
 		users = append(users, user)
 	}
 
-	return users, nil
+	return users, errors.Wrap(rows.Err(), "failed to get users")
+}
+
+// like matches the field against a LIKE pattern in which \ escapes the next
+// character. It is the default escape character of Postgres, SQLite has none.
+func (r *Repo) like(sb *sqlbuilder.SelectBuilder, field string, pattern string) string {
+	if r.replica.Dialect() == repo.DialectSQLite {
+		return field + " LIKE " + sb.Var(pattern) + ` ESCAPE '\'`
+	}
+
+	return sb.Like(field, pattern)
 }
 
-func (r *Repo) UpdateEmail(ctx context.Context, id uint64, email string) error {
+// SetPendingEmail stores the address of an email change until expiresAt. It fails
+// with entity.ErrEmailAlreadyExists if another user owns the address or is changing
+// to it. A change that expired no longer holds the address.
+func (r *Repo) SetPendingEmail(ctx context.Context, id uint64, email string, expiresAt time.Time) error {
+	err := r.db.WithTx(ctx, func(ctx context.Context) error {
+		query := `
+			UPDATE cd_users
+			SET pending_email = NULL, pending_email_expires_at = NULL
+			WHERE pending_email = @email AND (pending_email_expires_at IS NULL OR pending_email_expires_at <= NOW())
+		`
+
+		args := pgx.NamedArgs{
+			"email": email,
+		}
+
+		if _, err := r.db.Exec(ctx, query, args); err != nil {
+			return err
+		}
+
+		query = `
+			UPDATE cd_users
+			SET pending_email = @email, pending_email_expires_at = @expires_at
+			WHERE id = @id AND deleted_at IS NULL AND NOT EXISTS (
+				SELECT 1
+				FROM cd_users
+				WHERE email = @email AND id <> @id AND deleted_at IS NULL
+			)
+		`
+
+		args = pgx.NamedArgs{
+			"id":         id,
+			"email":      email,
+			"expires_at": expiresAt,
+		}
+
+		tag, err := r.db.Exec(ctx, query, args)
+		if err != nil {
+			return mapUniqueViolation(err)
+		}
+
+		if tag.RowsAffected() == 0 {
+			return entity.ErrEmailAlreadyExists
+		}
+
+		return nil
+	})
+
+	return errors.Wrap(err, "failed to set pending email")
+}
+
+// ConfirmEmail replaces the email with the pending one, if it still is the given
+// address, and reports whether it did.
+func (r *Repo) ConfirmEmail(ctx context.Context, id uint64, email string) (bool, error) {
+	query := `
+		UPDATE cd_users
+		SET email = pending_email, pending_email = NULL, pending_email_expires_at = NULL, email_verified_at = NOW()
+		WHERE id = @id AND pending_email = @email AND pending_email_expires_at > NOW()
+	`
+
+	args := pgx.NamedArgs{
+		"id":    id,
+		"email": email,
+	}
+
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
+		return false, errors.Wrap(mapUniqueViolation(err), "failed to confirm email")
+	}
+
+	return tag.RowsAffected() != 0, nil
+}
+
+// RevertEmail restores the previous email and locks the user.
+func (r *Repo) RevertEmail(ctx context.Context, id uint64, email string) error {
 	query := `
 		UPDATE cd_users
-		SET email = @email
+		SET email = @email, pending_email = NULL, pending_email_expires_at = NULL, email_verified_at = NOW(),
+			locked_at = NOW()
 		WHERE id = @id
 	`
 
@@ -172,7 +311,25 @@ func (r *Repo) UpdateEmail(ctx context.Context, id uint64, email string) error {
 	}
 
 	if _, err := r.db.Exec(ctx, query, args); err != nil {
-		return errors.Wrap(err, "failed to update email")
+		return errors.Wrap(mapUniqueViolation(err), "failed to revert email")
+	}
+
+	return nil
+}
+
+func (r *Repo) UnlockUser(ctx context.Context, id uint64) error {
+	query := `
+		UPDATE cd_users
+		SET locked_at = NULL
+		WHERE id = @id
+	`
+
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		return errors.Wrap(err, "failed to unlock user")
 	}
 
 	return nil
@@ -182,7 +339,7 @@ func (r *Repo) UpdateUsername(ctx context.Context, id uint64, username string) e
 	query := `
 		UPDATE cd_users
 		SET username = @username
-		WHERE id = @id
+		WHERE id = @id AND deleted_at IS NULL
 	`
 
 	args := pgx.NamedArgs{
@@ -190,24 +347,28 @@ func (r *Repo) UpdateUsername(ctx context.Context, id uint64, username string) e
 		"username": username,
 	}
 
-	if _, err := r.db.Exec(ctx, query, args); err != nil {
-		return errors.Wrap(err, "failed to update username")
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
+		return errors.Wrap(mapUniqueViolation(err), "failed to update username")
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errors.Wrap(pgx.ErrNoRows, "failed to update username")
 	}
 
 	return nil
 }
 
-func (r *Repo) UpdatePassword(ctx context.Context, id uint64, password string, salt string) error {
+func (r *Repo) UpdatePassword(ctx context.Context, id uint64, password string) error {
 	query := `
 		UPDATE cd_users
-		SET password = @password, salt = @salt
+		SET password = @password, salt = NULL
 		WHERE id = @id
 	`
 
 	args := pgx.NamedArgs{
 		"id":       id,
 		"password": password,
-		"salt":     salt,
 	}
 
 	if _, err := r.db.Exec(ctx, query, args); err != nil {
@@ -217,20 +378,315 @@ func (r *Repo) UpdatePassword(ctx context.Context, id uint64, password string, s
 	return nil
 }
 
+// DeleteUser marks the user as deleted. It fails with pgx.ErrNoRows if there is no
+// such user or it is already deleted.
 func (r *Repo) DeleteUser(ctx context.Context, id uint64) error {
 	query := `
 		UPDATE cd_users
 		SET deleted_at = NOW()
-		WHERE id = @id
+		WHERE id = @id AND deleted_at IS NULL
 	`
 
 	args := pgx.NamedArgs{
 		"id": id,
 	}
 
-	if _, err := r.db.Exec(ctx, query, args); err != nil {
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
 		return errors.Wrap(err, "failed to delete user")
 	}
 
+	if tag.RowsAffected() == 0 {
+		return errors.Wrap(pgx.ErrNoRows, "failed to delete user")
+	}
+
+	return nil
+}
+
+// RestoreUser undoes the deletion of a user that was not purged yet. It fails with
+// pgx.ErrNoRows if there is no such deleted user, and with the entity errors of a
+// unique violation if another user took the email or the username meanwhile.
+func (r *Repo) RestoreUser(ctx context.Context, id uint64) (entity.User, error) {
+	query := `
+		UPDATE cd_users
+		SET deleted_at = NULL
+		WHERE id = @id AND deleted_at IS NOT NULL AND purged_at IS NULL
+		RETURNING ` + userColumns + `
+	`
+
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	user, err := scanUser(r.db.QueryRow(ctx, query, args))
+	if err != nil {
+		return entity.User{}, errors.Wrap(mapUniqueViolation(err), "failed to restore user")
+	}
+
+	return user, nil
+}
+
+// PurgeUsers hard-deletes up to count users deleted before the given time, along
+// with everything that references them. Rows locked by a concurrent purge are
+// skipped.
+func (r *Repo) PurgeUsers(ctx context.Context, before time.Time, count int) (int64, error) {
+	query := `
+		DELETE FROM cd_users
+		WHERE id IN (
+			SELECT id
+			FROM cd_users
+			WHERE deleted_at < @before AND purged_at IS NULL
+			ORDER BY id
+			LIMIT @limit
+			` + r.skipLocked() + `
+		)
+	`
+
+	args := pgx.NamedArgs{
+		"before": before,
+		"limit":  count,
+	}
+
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge users")
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// AnonymizeUsers replaces the personal data of up to count users deleted before the
+// given time and drops their credentials, keeping the rows for references. Rows
+// locked by a concurrent purge are skipped.
+func (r *Repo) AnonymizeUsers(ctx context.Context, before time.Time, count int) (int64, error) {
+	if r.db.Dialect() == repo.DialectSQLite {
+		return r.anonymizeUsersSQLite(ctx, before, count)
+	}
+
+	query := `
+		WITH purged AS (
+			UPDATE cd_users
+			SET email = 'deleted-' || id || '@invalid',
+				username = 'deleted-' || id,
+				pending_email = NULL,
+				pending_email_expires_at = NULL,
+				password = '',
+				salt = NULL,
+				purged_at = NOW()
+			WHERE id IN (
+				SELECT id
+				FROM cd_users
+				WHERE deleted_at < @before AND purged_at IS NULL
+				ORDER BY id
+				LIMIT @limit
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id
+		), sessions AS (
+			DELETE FROM cd_sessions
+			WHERE user_id IN (SELECT id FROM purged)
+		), tokens AS (
+			DELETE FROM cd_user_tokens
+			WHERE user_id IN (SELECT id FROM purged)
+		), history AS (
+			DELETE FROM cd_password_history
+			WHERE user_id IN (SELECT id FROM purged)
+		), totp AS (
+			DELETE FROM cd_totp
+			WHERE user_id IN (SELECT id FROM purged)
+		), recovery_codes AS (
+			DELETE FROM cd_recovery_codes
+			WHERE user_id IN (SELECT id FROM purged)
+		), credentials AS (
+			DELETE FROM cd_webauthn_credentials
+			WHERE user_id IN (SELECT id FROM purged)
+		)
+		SELECT COUNT(*)
+		FROM purged
+	`
+
+	args := pgx.NamedArgs{
+		"before": before,
+		"limit":  count,
+	}
+
+	var purged int64
+
+	if err := r.db.QueryRow(ctx, query, args).Scan(&purged); err != nil {
+		return 0, errors.Wrap(err, "failed to anonymize users")
+	}
+
+	return purged, nil
+}
+
+// anonymizeUsersSQLite is AnonymizeUsers for SQLite, which can't modify data in a
+// WITH clause. The users anonymized by a batch are the ones purged at its time.
+func (r *Repo) anonymizeUsersSQLite(ctx context.Context, before time.Time, count int) (int64, error) {
+	var purged int64
+
+	err := r.db.WithTx(ctx, func(ctx context.Context) error {
+		query := `
+			UPDATE cd_users
+			SET email = 'deleted-' || id || '@invalid',
+				username = 'deleted-' || id,
+				pending_email = NULL,
+				pending_email_expires_at = NULL,
+				password = '',
+				salt = NULL,
+				purged_at = @purged_at
+			WHERE id IN (
+				SELECT id
+				FROM cd_users
+				WHERE deleted_at < @before AND purged_at IS NULL
+				ORDER BY id
+				LIMIT @limit
+			)
+		`
+
+		purgedAt := time.Now().UTC()
+
+		args := pgx.NamedArgs{
+			"before":    before,
+			"limit":     count,
+			"purged_at": purgedAt,
+		}
+
+		tag, err := r.db.Exec(ctx, query, args)
+		if err != nil {
+			return err
+		}
+
+		purged = tag.RowsAffected()
+
+		for _, table := range purgedUserTables {
+			query = `
+				DELETE FROM ` + table + `
+				WHERE user_id IN (SELECT id FROM cd_users WHERE purged_at = @purged_at)
+			`
+
+			args = pgx.NamedArgs{
+				"purged_at": purgedAt,
+			}
+
+			if _, err = r.db.Exec(ctx, query, args); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to anonymize users")
+	}
+
+	return purged, nil
+}
+
+func (r *Repo) VerifyEmail(ctx context.Context, id uint64) error {
+	query := `
+		UPDATE cd_users
+		SET email_verified_at = NOW()
+		WHERE id = @id AND email_verified_at IS NULL
+	`
+
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		return errors.Wrap(err, "failed to verify email")
+	}
+
+	return nil
+}
+
+// skipLocked skips the rows a concurrent purge locked. SQLite runs one write at a
+// time and has no row locks to skip.
+func (r *Repo) skipLocked() string {
+	if r.db.Dialect() == repo.DialectSQLite {
+		return ""
+	}
+
+	return "FOR UPDATE SKIP LOCKED"
+}
+
+func scanUser(row pgx.Row) (entity.User, error) {
+	var user entity.User
+
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.EmailVerifiedAt,
+		&user.PendingEmail,
+		&user.Username,
+		&user.Role,
+		&user.Password,
+		&user.Salt,
+		&user.LockedAt,
+		&user.DeletedAt,
+	)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	return user, nil
+}
+
+// GetIdentities returns the id, email, pending email and username of the users
+// after lastID, deleted ones included.
+func (r *Repo) GetIdentities(ctx context.Context, lastID uint64, count int) ([]entity.User, error) {
+	query := `
+		SELECT id, email, COALESCE(pending_email, ''), username
+		FROM cd_users
+		WHERE id > @last_id
+		ORDER BY id
+		LIMIT @limit
+	`
+
+	args := pgx.NamedArgs{
+		"last_id": lastID,
+		"limit":   count,
+	}
+
+	rows, err := r.db.Query(ctx, query, args)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get identities")
+	}
+
+	defer rows.Close()
+
+	users := []entity.User{}
+
+	for rows.Next() {
+		var user entity.User
+
+		if err = rows.Scan(&user.ID, &user.Email, &user.PendingEmail, &user.Username); err != nil {
+			return nil, errors.Wrap(err, "failed to scan identity")
+		}
+
+		users = append(users, user)
+	}
+
+	return users, errors.Wrap(rows.Err(), "failed to get identities")
+}
+
+func (r *Repo) UpdateIdentity(ctx context.Context, user entity.User) error {
+	query := `
+		UPDATE cd_users
+		SET email = @email, pending_email = NULLIF(@pending_email, ''), username = @username
+		WHERE id = @id
+	`
+
+	args := pgx.NamedArgs{
+		"id":            user.ID,
+		"email":         user.Email,
+		"pending_email": user.PendingEmail,
+		"username":      user.Username,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		return errors.Wrap(mapUniqueViolation(err), "failed to update identity")
+	}
+
 	return nil
 }
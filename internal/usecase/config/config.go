@@ -1,8 +1,22 @@
 package config
 
 import (
+	"time"
+
 	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/controller/httpsrv"
+	"github.com/0x16F/cloud-users/internal/infrastructure/mailer"
 	"github.com/0x16F/cloud-users/internal/infrastructure/repo"
+	"github.com/0x16F/cloud-users/internal/usecase/mfa"
+	"github.com/0x16F/cloud-users/internal/usecase/passkeys"
+	"github.com/0x16F/cloud-users/internal/usecase/passwords"
+	"github.com/0x16F/cloud-users/internal/usecase/policy"
+	"github.com/0x16F/cloud-users/internal/usecase/purge"
+	"github.com/0x16F/cloud-users/internal/usecase/sessions"
+	"github.com/0x16F/cloud-users/internal/usecase/throttle"
+	"github.com/0x16F/cloud-users/internal/usecase/tokens"
+	"github.com/0x16F/cloud-users/internal/usecase/users"
+	"github.com/0x16F/cloud-users/internal/usecase/validation"
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
@@ -10,14 +24,28 @@ type App struct {
 	Port           uint16             `env:"WEB_PORT" env-default:"8080"`
 	Name           string             `env:"APP_NAME" env-default:"cloud-users"`
 	ErrorsPath     string             `env:"ERRORS_PATH"`
+	ErrorsLocale   string             `env:"ERRORS_LOCALE" env-default:"en"`
+	ErrorsReload   time.Duration      `env:"ERRORS_RELOAD_INTERVAL" env-default:"10s"`
 	MigrationsPath string             `env:"MIGRATIONS_PATH"`
 	Level          logger.LoggerLevel `env:"LOGGER_LEVEL" env-default:"info"`
 	ProxyEndpoint  string             `env:"FFLAGS_ENDPOINT" env-default:"http://localhost:1031"`
 }
 
 type Config struct {
-	Database repo.Config
-	App      App
+	Database       repo.Config
+	Mailer         mailer.Config
+	Users          users.Config
+	Passwords      passwords.Config
+	PasswordPolicy policy.Config
+	Tokens         tokens.Config
+	Sessions       sessions.Config
+	Throttle       throttle.Config
+	Purge          purge.Config
+	MFA            mfa.Config
+	Passkeys       passkeys.Config
+	Validation     validation.Config
+	HTTP           httpsrv.Config
+	App            App
 }
 
 func New() (*Config, error) {
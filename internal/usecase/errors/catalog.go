@@ -0,0 +1,226 @@
+package errors
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/0x16F/cloud-users/build"
+	"github.com/0x16F/cloud-users/pkg/codes"
+	"github.com/goccy/go-json"
+	"golang.org/x/text/language"
+)
+
+const embeddedCatalog = "errors.json"
+
+// source is a catalog file with the translations next to it, keyed by locale.
+type source struct {
+	name         string
+	catalog      []byte
+	translations map[string][]byte
+}
+
+// load reads the embedded catalog and the override files and merges them: entries
+// of the override replace the embedded entries of the same code and may add codes,
+// the same holds for the translations of each locale.
+func (e Errors) load() (catalogs, error) {
+	sources := make([]source, 0, 2)
+
+	embedded, err := readSource(build.Errors, embeddedCatalog)
+	if err != nil {
+		return nil, err
+	}
+
+	sources = append(sources, embedded)
+
+	if e.overridePath != "" {
+		override, err := readSource(os.DirFS(filepath.Dir(e.overridePath)), filepath.Base(e.overridePath))
+		if err != nil {
+			return nil, fmt.Errorf("errors override %s: %w", e.overridePath, err)
+		}
+
+		sources = append(sources, override)
+	}
+
+	catalog := make(map[int]Error)
+	translations := make(map[string][][]byte)
+
+	for _, s := range sources {
+		entries, err := parseCatalog(s.catalog)
+		if err != nil {
+			return nil, fmt.Errorf("invalid errors catalog %s: %w", s.name, err)
+		}
+
+		maps.Copy(catalog, entries)
+
+		for locale, data := range s.translations {
+			translations[locale] = append(translations[locale], data)
+		}
+	}
+
+	if err = checkCatalog(catalog, codes.All()); err != nil {
+		return nil, err
+	}
+
+	loaded := catalogs{
+		e.defaultLocale: catalog,
+	}
+
+	for locale, data := range translations {
+		translated, missing, err := translateCatalog(catalog, data...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s errors: %w", locale, err)
+		}
+
+		if len(missing) != 0 {
+			e.log.Warnf("errors catalog %s has no translation for codes %v", locale, missing)
+		}
+
+		loaded[locale] = translated
+	}
+
+	return loaded, nil
+}
+
+// readSource reads the catalog file name of fsys and its translations, named like
+// errors.ru.json for errors.json.
+func readSource(fsys fs.FS, name string) (source, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return source{}, fmt.Errorf("failed to read errors file: %w", err)
+	}
+
+	paths, err := fs.Glob(fsys, translationsPattern(name))
+	if err != nil {
+		return source{}, fmt.Errorf("failed to find errors translations: %w", err)
+	}
+
+	s := source{
+		name:         name,
+		catalog:      data,
+		translations: make(map[string][]byte, len(paths)),
+	}
+
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	for _, p := range paths {
+		locale := strings.TrimSuffix(strings.TrimPrefix(p, stem+"."), ext)
+
+		if _, err = language.Parse(locale); err != nil {
+			return source{}, fmt.Errorf("invalid locale of errors translation %s: %w", p, err)
+		}
+
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return source{}, fmt.Errorf("failed to read errors translation: %w", err)
+		}
+
+		s.translations[canonicalLocale(locale)] = data
+	}
+
+	return s, nil
+}
+
+func translationsPattern(name string) string {
+	ext := path.Ext(name)
+
+	return strings.TrimSuffix(name, ext) + ".*" + ext
+}
+
+// fingerprint describes the override files by name, size and modification time,
+// so that a changed, added or removed file changes it.
+func (e Errors) fingerprint() string {
+	paths, _ := filepath.Glob(filepath.Join(filepath.Dir(e.overridePath), translationsPattern(filepath.Base(e.overridePath))))
+
+	var b strings.Builder
+
+	for _, p := range append([]string{e.overridePath}, paths...) {
+		info, err := os.Stat(p)
+		if err != nil {
+			fmt.Fprintf(&b, "%s:-;", p)
+
+			continue
+		}
+
+		fmt.Fprintf(&b, "%s:%d:%d;", p, info.Size(), info.ModTime().UnixNano())
+	}
+
+	return b.String()
+}
+
+// Entry is an error as declared in the catalog file. Unlike Error it carries the
+// HTTP status, which is not part of the response body.
+type Entry struct {
+	Code        int    `json:"code"`
+	HttpCode    int    `json:"http_code"`
+	Message     string `json:"message"`
+	Description string `json:"description"`
+}
+
+func parseCatalog(data []byte) (map[int]Error, error) {
+	var entries []Entry
+
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal errors: %w", err)
+	}
+
+	catalog := make(map[int]Error, len(entries))
+
+	for i, e := range entries {
+		if err := e.validate(); err != nil {
+			return nil, fmt.Errorf("invalid errors entry %d: %w", i, err)
+		}
+
+		if _, ok := catalog[e.Code]; ok {
+			return nil, fmt.Errorf("invalid errors entry %d: duplicate code %d", i, e.Code)
+		}
+
+		catalog[e.Code] = Error{
+			Code:        e.Code,
+			HttpCode:    e.HttpCode,
+			Message:     e.Message,
+			Description: e.Description,
+		}
+	}
+
+	return catalog, nil
+}
+
+func (e Entry) validate() error {
+	if e.Code <= 0 {
+		return fmt.Errorf("code %d is not positive", e.Code)
+	}
+
+	if e.HttpCode < http.StatusBadRequest || e.HttpCode > 599 || http.StatusText(e.HttpCode) == "" {
+		return fmt.Errorf("code %d has invalid http_code %d", e.Code, e.HttpCode)
+	}
+
+	if strings.TrimSpace(e.Message) == "" {
+		return fmt.Errorf("code %d has no message", e.Code)
+	}
+
+	return nil
+}
+
+// checkCatalog fails if any of the codes has no entry in the catalog.
+func checkCatalog(catalog map[int]Error, codes []int) error {
+	var missing []string
+
+	for _, code := range codes {
+		if _, ok := catalog[code]; !ok {
+			missing = append(missing, fmt.Sprint(code))
+		}
+	}
+
+	if len(missing) != 0 {
+		return fmt.Errorf("errors catalog has no entry for codes %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
@@ -1,52 +1,121 @@
 package errors
 
 import (
+	"context"
 	"net/http"
-	"os"
+	"sort"
+	"sync/atomic"
+	"time"
 
 	"github.com/0x16F/cloud-common/pkg/logger"
 	"github.com/goccy/go-json"
 )
 
+// catalogs holds a complete catalog per locale, codes without a translation carry
+// the entry of the default locale.
+type catalogs map[string]map[int]Error
+
 type Errors struct {
-	errors map[int]Error
+	log           logger.Logger
+	defaultLocale string
+	overridePath  string
+	catalogs      *atomic.Pointer[catalogs]
+	stop          chan struct{}
 }
 
-func New(log logger.Logger, errorsPath string) Errors {
-	log = log.WithFields(logger.Fields{
-		"module": "errors",
-	})
-
+// New loads the embedded errors catalog and its translations and merges the
+// optional override file at overridePath on top, see load. It fails if a file can't
+// be read, an entry is malformed or a code of pkg/codes has no entry in the merged
+// catalog of the default locale. Codes missing from a translation are only logged.
+func New(log logger.Logger, overridePath string, defaultLocale string) (Errors, error) {
 	service := Errors{
-		errors: make(map[int]Error),
+		log: log.WithFields(logger.Fields{
+			"module": "errors",
+		}),
+		defaultLocale: canonicalLocale(defaultLocale),
+		overridePath:  overridePath,
+		catalogs:      new(atomic.Pointer[catalogs]),
+		stop:          make(chan struct{}),
 	}
 
-	data, err := os.ReadFile(errorsPath)
+	loaded, err := service.load()
 	if err != nil {
-		log.Errorf("failed to read errors file: %v", err)
-
-		return service
+		return Errors{}, err
 	}
 
-	var errors []Error
-	if err := json.Unmarshal(data, &errors); err != nil {
-		log.Errorf("failed to unmarshal errors: %v", err)
+	service.catalogs.Store(&loaded)
 
-		return service
-	}
+	return service, nil
+}
 
-	for _, err := range errors {
-		service.errors[err.Code] = err
+// Watch checks the override files for changes every interval until Close and
+// swaps in the reloaded catalogs at once. A catalog that fails to load is logged
+// and the previous one stays in use.
+func (e Errors) Watch(interval time.Duration) {
+	if e.overridePath == "" || interval <= 0 {
+		return
 	}
 
-	return service
+	log := e.log.WithFields(logger.Fields{
+		"method": "Watch",
+	})
+
+	last := e.fingerprint()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-e.stop:
+				return
+			case <-ticker.C:
+			}
+
+			current := e.fingerprint()
+			if current == last {
+				continue
+			}
+
+			last = current
+
+			loaded, err := e.load()
+			if err != nil {
+				log.Errorf("failed to reload errors catalog: %v", err)
+
+				continue
+			}
+
+			e.catalogs.Store(&loaded)
+
+			log.Infof("reloaded errors catalog from %s", e.overridePath)
+		}
+	}()
+}
+
+// Close stops watching the override files.
+func (e Errors) Close() error {
+	close(e.stop)
+
+	return nil
 }
 
 type Error struct {
-	Code        int    `json:"code"`
-	HttpCode    int    `json:"-"`
-	Message     string `json:"message"`
-	Description string `json:"description"`
+	Code        int          `json:"code"`
+	HttpCode    int          `json:"-"`
+	Message     string       `json:"message"`
+	Description string       `json:"description"`
+	Fields      []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError describes why a single field of the request was rejected. Path is the
+// JSON path of the field, e.g. $.users[0].email.
+type FieldError struct {
+	Path    string `json:"path"`
+	Code    int    `json:"code"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
 }
 
 func (ce Error) Error() string {
@@ -54,8 +123,62 @@ func (ce Error) Error() string {
 	return string(encoded)
 }
 
+func (ce *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+
+	return ce.Code == t.Code
+}
+
+// GetError returns the error of the code in the default locale.
 func (e Errors) GetError(code int) error {
-	if err, ok := e.errors[code]; ok {
+	return getError((*e.catalogs.Load())[e.defaultLocale], code)
+}
+
+// GetErrorContext returns the error of the code in the first locale of the context
+// the catalog has, see WithLocales, and falls back to the default locale.
+func (e Errors) GetErrorContext(ctx context.Context, code int) error {
+	return getError(e.catalog(ctx), code)
+}
+
+// Catalog returns every entry of the catalog in the first locale of the context the
+// catalog has, ordered by code.
+func (e Errors) Catalog(ctx context.Context) []Entry {
+	catalog := e.catalog(ctx)
+	entries := make([]Entry, 0, len(catalog))
+
+	for _, err := range catalog {
+		entries = append(entries, Entry{
+			Code:        err.Code,
+			HttpCode:    err.HttpCode,
+			Message:     err.Message,
+			Description: err.Description,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Code < entries[j].Code
+	})
+
+	return entries
+}
+
+func (e Errors) catalog(ctx context.Context) map[int]Error {
+	loaded := *e.catalogs.Load()
+
+	for _, locale := range Locales(ctx) {
+		if catalog, ok := loaded[locale]; ok {
+			return catalog
+		}
+	}
+
+	return loaded[e.defaultLocale]
+}
+
+func getError(catalog map[int]Error, code int) error {
+	if err, ok := catalog[code]; ok {
 		return &err
 	}
 
@@ -65,3 +188,14 @@ func (e Errors) GetError(code int) error {
 		Message:  "Unknown error",
 	}
 }
+
+// GetFieldsError returns the error of the code with the failing fields attached.
+func (e Errors) GetFieldsError(code int, fields []FieldError) error {
+	err := e.GetError(code)
+
+	if ce, ok := err.(*Error); ok {
+		ce.Fields = fields
+	}
+
+	return err
+}
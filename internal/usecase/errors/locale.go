@@ -0,0 +1,121 @@
+package errors
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"golang.org/x/text/language"
+)
+
+type contextKey string
+
+// LocalesKey is the context key of the preferred locales of a request. Fiber
+// handlers can set it with c.Locals, since the request context resolves locals.
+const LocalesKey contextKey = "locales"
+
+// WithLocales returns a context that prefers the locales in the given order.
+func WithLocales(ctx context.Context, locales []string) context.Context {
+	return context.WithValue(ctx, LocalesKey, locales)
+}
+
+// Locales returns the preferred locales of the context, most preferred first.
+func Locales(ctx context.Context) []string {
+	locales, _ := ctx.Value(LocalesKey).([]string)
+
+	return locales
+}
+
+// ParseAcceptLanguage turns an Accept-Language header into the chain of locales to
+// try: every accepted locale by quality, each followed by its base language, so
+// that ru-RU falls back to ru before the next accepted locale.
+func ParseAcceptLanguage(header string) []string {
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil {
+		return nil
+	}
+
+	var (
+		locales []string
+		seen    = make(map[string]bool)
+	)
+
+	for _, tag := range tags {
+		base, _ := tag.Base()
+
+		for _, locale := range []string{tag.String(), base.String()} {
+			if locale == "und" || seen[locale] {
+				continue
+			}
+
+			seen[locale] = true
+			locales = append(locales, locale)
+		}
+	}
+
+	return locales
+}
+
+func canonicalLocale(locale string) string {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return locale
+	}
+
+	return tag.String()
+}
+
+// translateCatalog applies the translations to the default catalog in order. It
+// returns the translated catalog and the codes the translations miss, which keep
+// the default entry.
+func translateCatalog(catalog map[int]Error, translations ...[]byte) (map[int]Error, []int, error) {
+	var entries []Entry
+
+	for _, data := range translations {
+		var translation []Entry
+
+		if err := json.Unmarshal(data, &translation); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal errors: %w", err)
+		}
+
+		entries = append(entries, translation...)
+	}
+
+	translated := make(map[int]Error, len(catalog))
+
+	for code, err := range catalog {
+		translated[code] = err
+	}
+
+	translatedCodes := make(map[int]bool, len(entries))
+
+	for i, e := range entries {
+		err, ok := catalog[e.Code]
+		if !ok {
+			return nil, nil, fmt.Errorf("entry %d: code %d is not in the default catalog", i, e.Code)
+		}
+
+		if strings.TrimSpace(e.Message) == "" {
+			return nil, nil, fmt.Errorf("entry %d: code %d has no message", i, e.Code)
+		}
+
+		err.Message = e.Message
+		err.Description = e.Description
+		translated[e.Code] = err
+		translatedCodes[e.Code] = true
+	}
+
+	var missing []int
+
+	for code := range catalog {
+		if !translatedCodes[code] {
+			missing = append(missing, code)
+		}
+	}
+
+	sort.Ints(missing)
+
+	return translated, missing, nil
+}
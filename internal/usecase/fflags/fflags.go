@@ -19,7 +19,8 @@ func New(client *of.Client) *Service {
 
 func (s *Service) IsFeatureEnabled(ctx context.Context, flag string, user entity.UserData) bool {
 	return s.client.Boolean(ctx, flag, false, of.NewEvaluationContext(user.Login, map[string]interface{}{
-		"login": user.Login,
-		"role":  user.Role,
+		"login":          user.Login,
+		"role":           user.Role,
+		"email_verified": user.EmailVerified,
 	}))
 }
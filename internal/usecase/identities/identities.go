@@ -0,0 +1,172 @@
+package identities
+
+import (
+	"context"
+	"sort"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/pkg/errors"
+)
+
+const (
+	batchSize = 1000
+)
+
+const (
+	FieldEmail        = "email"
+	FieldPendingEmail = "pending_email"
+	FieldUsername     = "username"
+)
+
+type Repository interface {
+	GetIdentities(ctx context.Context, lastID uint64, count int) ([]entity.User, error)
+	UpdateIdentity(ctx context.Context, user entity.User) error
+}
+
+// Service rewrites stored emails and usernames into their normalized form. It runs
+// before the columns become case-insensitive, while values that only differ in case
+// can still coexist.
+type Service struct {
+	log  logger.Logger
+	repo Repository
+}
+
+func New(log logger.Logger, repo Repository) *Service {
+	return &Service{
+		log:  log,
+		repo: repo,
+	}
+}
+
+// Normalize reports the users that would share an email or username once
+// normalized and, unless dryRun is set, normalizes every other user. Colliding
+// users are left untouched and have to be resolved by hand.
+func (s *Service) Normalize(ctx context.Context, dryRun bool) (entity.IdentityReport, error) {
+	log := s.log.WithFields(logger.Fields{
+		"method": "Normalize",
+	})
+
+	users, err := s.getIdentities(ctx)
+	if err != nil {
+		return entity.IdentityReport{}, err
+	}
+
+	report := entity.IdentityReport{
+		Scanned:    len(users),
+		Collisions: []entity.IdentityCollision{},
+	}
+
+	colliding := make(map[uint64]bool)
+
+	for _, field := range []string{FieldEmail, FieldPendingEmail, FieldUsername} {
+		for _, collision := range collisions(users, field) {
+			for _, id := range collision.UserIDs {
+				colliding[id] = true
+			}
+
+			report.Collisions = append(report.Collisions, collision)
+		}
+	}
+
+	for _, user := range users {
+		normalized := normalize(user)
+
+		if colliding[user.ID] || normalized == user {
+			continue
+		}
+
+		report.Normalized++
+
+		if dryRun {
+			continue
+		}
+
+		if err = s.repo.UpdateIdentity(ctx, normalized); err != nil {
+			log.Errorf("failed to normalize user %d: %v", user.ID, err)
+
+			return report, errors.Wrapf(err, "failed to normalize user %d", user.ID)
+		}
+	}
+
+	return report, nil
+}
+
+func (s *Service) getIdentities(ctx context.Context) ([]entity.User, error) {
+	var (
+		users  []entity.User
+		lastID uint64
+	)
+
+	for {
+		batch, err := s.repo.GetIdentities(ctx, lastID, batchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, batch...)
+
+		if len(batch) < batchSize {
+			return users, nil
+		}
+
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+func normalize(user entity.User) entity.User {
+	user.Email = entity.NormalizeEmail(user.Email)
+	user.PendingEmail = entity.NormalizeEmail(user.PendingEmail)
+	user.Username = entity.NormalizeUsername(user.Username)
+
+	return user
+}
+
+// collisions groups the users by the identity key of a field and returns the groups
+// with more than one user.
+func collisions(users []entity.User, field string) []entity.IdentityCollision {
+	groups := make(map[string][]uint64)
+
+	for _, user := range users {
+		value := identity(normalize(user), field)
+		if value == "" {
+			continue
+		}
+
+		key := entity.IdentityKey(value)
+		groups[key] = append(groups[key], user.ID)
+	}
+
+	result := []entity.IdentityCollision{}
+
+	for key, ids := range groups {
+		if len(ids) < 2 {
+			continue
+		}
+
+		result = append(result, entity.IdentityCollision{
+			Field:   field,
+			Key:     key,
+			UserIDs: ids,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+
+	return result
+}
+
+func identity(user entity.User, field string) string {
+	switch field {
+	case FieldEmail:
+		return user.Email
+	case FieldPendingEmail:
+		return user.PendingEmail
+	case FieldUsername:
+		return user.Username
+	}
+
+	return ""
+}
@@ -0,0 +1,467 @@
+package mfa
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/entity"
+	cerrors "github.com/0x16F/cloud-users/internal/usecase/errors"
+	"github.com/0x16F/cloud-users/pkg/codes"
+	"github.com/0x16F/cloud-users/pkg/secret"
+	"github.com/0x16F/cloud-users/pkg/totp"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	MethodTOTP     = "totp"
+	MethodWebAuthn = "webauthn"
+)
+
+const (
+	totpSkew           = 1
+	recoveryCodeLength = 10
+)
+
+type Config struct {
+	Issuer        string `env:"MFA_ISSUER" env-default:"cloud-users"`
+	EncryptionKey string `env:"MFA_ENCRYPTION_KEY"`
+	RecoveryCodes int    `env:"MFA_RECOVERY_CODES" env-default:"10"`
+}
+
+type MFARepository interface {
+	SaveTOTP(ctx context.Context, totp entity.TOTP) error
+	GetTOTP(ctx context.Context, userID uint64) (entity.TOTP, error)
+	ConfirmTOTP(ctx context.Context, userID uint64) error
+	UseTOTPStep(ctx context.Context, userID uint64, step int64) (bool, error)
+	DeleteTOTP(ctx context.Context, userID uint64) error
+	ReplaceRecoveryCodes(ctx context.Context, userID uint64, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID uint64, codeHash string) (bool, error)
+	HasWebAuthnCredentials(ctx context.Context, userID uint64) (bool, error)
+}
+
+type Transactor interface {
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type UsersService interface {
+	GetUser(ctx context.Context, id uint64) (entity.User, error)
+	VerifyPassword(ctx context.Context, id uint64, password string, ip string) error
+}
+
+type Throttle interface {
+	CheckMFA(ctx context.Context, challenge entity.MFAChallenge) error
+	FailMFA(ctx context.Context, challenge entity.MFAChallenge) error
+	SucceedMFA(ctx context.Context, challenge entity.MFAChallenge) error
+}
+
+type ErrorsService interface {
+	GetError(code int) error
+}
+
+type Service struct {
+	log           logger.Logger
+	cfg           Config
+	aead          cipher.AEAD
+	mfaRepo       MFARepository
+	transactor    Transactor
+	usersService  UsersService
+	throttle      Throttle
+	errorsService ErrorsService
+}
+
+// New creates the service. TOTP enrollment stays unavailable until MFA_ENCRYPTION_KEY
+// holds a base64 encoded AES key, since secrets are never stored in plain text.
+func New(
+	log logger.Logger,
+	cfg Config,
+	mfaRepo MFARepository,
+	transactor Transactor,
+	usersService UsersService,
+	throttle Throttle,
+	errorsService ErrorsService,
+) (*Service, error) {
+	service := &Service{
+		log:           log,
+		cfg:           cfg,
+		mfaRepo:       mfaRepo,
+		transactor:    transactor,
+		usersService:  usersService,
+		throttle:      throttle,
+		errorsService: errorsService,
+	}
+
+	if cfg.EncryptionKey != "" {
+		aead, err := newAEAD(cfg.EncryptionKey)
+		if err != nil {
+			return nil, err
+		}
+
+		service.aead = aead
+	}
+
+	return service, nil
+}
+
+// EnrollTOTP generates a new secret for the user. It has to be confirmed with a
+// code before it is required on login.
+func (s *Service) EnrollTOTP(ctx context.Context, userID uint64) (entity.TOTPEnrollment, error) {
+	log := s.log.WithFields(logger.Fields{
+		"method": "EnrollTOTP",
+	})
+
+	if s.aead == nil {
+		log.Warnf("totp enrollment requested without an encryption key")
+
+		return entity.TOTPEnrollment{}, s.errorsService.GetError(codes.FeatureIsDisabled)
+	}
+
+	user, err := s.usersService.GetUser(ctx, userID)
+	if err != nil {
+		log.Errorf("failed to get user: %v", err)
+
+		return entity.TOTPEnrollment{}, err
+	}
+
+	stored, err := s.getTOTP(ctx, log, userID)
+	if err != nil && !errors.Is(err, s.errorsService.GetError(codes.TOTPNotEnabled)) {
+		return entity.TOTPEnrollment{}, err
+	}
+
+	if stored.IsConfirmed() {
+		return entity.TOTPEnrollment{}, s.errorsService.GetError(codes.TOTPAlreadyEnabled)
+	}
+
+	plain, err := totp.NewSecret()
+	if err != nil {
+		log.Errorf("failed to generate secret: %v", err)
+
+		return entity.TOTPEnrollment{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	encrypted, err := encrypt(s.aead, plain)
+	if err != nil {
+		log.Errorf("failed to encrypt secret: %v", err)
+
+		return entity.TOTPEnrollment{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	if err = s.mfaRepo.SaveTOTP(ctx, entity.TOTP{UserID: userID, Secret: encrypted}); err != nil {
+		log.Errorf("failed to save totp: %v", err)
+
+		return entity.TOTPEnrollment{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	return entity.TOTPEnrollment{
+		Secret: plain,
+		URI:    totp.URI(s.cfg.Issuer, user.Email, plain),
+	}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the first code matches and
+// returns the initial recovery codes.
+func (s *Service) ConfirmTOTP(ctx context.Context, userID uint64, code string) ([]string, error) {
+	log := s.log.WithFields(logger.Fields{
+		"method": "ConfirmTOTP",
+	})
+
+	stored, err := s.getTOTP(ctx, log, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.IsConfirmed() {
+		return nil, s.errorsService.GetError(codes.TOTPAlreadyEnabled)
+	}
+
+	if err = s.verifyTOTP(ctx, log, stored, code); err != nil {
+		return nil, err
+	}
+
+	var recoveryCodes []string
+
+	// a confirmed secret always comes with its recovery codes
+	err = s.inTx(ctx, log, func(ctx context.Context) error {
+		if err := s.mfaRepo.ConfirmTOTP(ctx, userID); err != nil {
+			log.Errorf("failed to confirm totp: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		recoveryCodes, err = s.replaceRecoveryCodes(ctx, log, userID)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a current TOTP code.
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID uint64, code string) ([]string, error) {
+	log := s.log.WithFields(logger.Fields{
+		"method": "RegenerateRecoveryCodes",
+	})
+
+	stored, err := s.getTOTP(ctx, log, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !stored.IsConfirmed() {
+		return nil, s.errorsService.GetError(codes.TOTPNotEnabled)
+	}
+
+	if err = s.verifyTOTP(ctx, log, stored, code); err != nil {
+		return nil, err
+	}
+
+	return s.replaceRecoveryCodes(ctx, log, userID)
+}
+
+// DisableTOTP removes the secret and the recovery codes after checking the current password.
+func (s *Service) DisableTOTP(ctx context.Context, userID uint64, password string, ip string) error {
+	log := s.log.WithFields(logger.Fields{
+		"method": "DisableTOTP",
+	})
+
+	if err := s.usersService.VerifyPassword(ctx, userID, password, ip); err != nil {
+		log.Errorf("failed to verify password: %v", err)
+
+		return err
+	}
+
+	if _, err := s.getTOTP(ctx, log, userID); err != nil {
+		return err
+	}
+
+	if err := s.mfaRepo.DeleteTOTP(ctx, userID); err != nil {
+		log.Errorf("failed to delete totp: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
+
+	return nil
+}
+
+// Methods returns the second factors the user has to choose from on login. The
+// list is empty when two-factor authentication is not enabled.
+func (s *Service) Methods(ctx context.Context, userID uint64) ([]string, error) {
+	methods := []string{}
+
+	stored, err := s.mfaRepo.GetTOTP(ctx, userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		s.log.Errorf("failed to get totp: %v", err)
+
+		return nil, s.errorsService.GetError(codes.InternalError)
+	}
+
+	if err == nil && stored.IsConfirmed() {
+		methods = append(methods, MethodTOTP)
+	}
+
+	hasCredentials, err := s.mfaRepo.HasWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		s.log.Errorf("failed to check webauthn credentials: %v", err)
+
+		return nil, s.errorsService.GetError(codes.InternalError)
+	}
+
+	if hasCredentials {
+		methods = append(methods, MethodWebAuthn)
+	}
+
+	return methods, nil
+}
+
+// IsEnabled reports whether the user has to pass a second factor on login.
+func (s *Service) IsEnabled(ctx context.Context, userID uint64) (bool, error) {
+	methods, err := s.Methods(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return len(methods) != 0, nil
+}
+
+// Verify checks the second factor of a login, either a TOTP code or an unused
+// recovery code. Wrong codes are throttled per account and burn the challenge
+// after a few attempts, a passed challenge can't be used again.
+func (s *Service) Verify(ctx context.Context, challenge entity.MFAChallenge, code string) error {
+	log := s.log.WithFields(logger.Fields{
+		"method": "Verify",
+	})
+
+	if err := s.throttle.CheckMFA(ctx, challenge); err != nil {
+		return err
+	}
+
+	err := s.verify(ctx, log, challenge.UserID, code)
+	if errors.Is(err, s.errorsService.GetError(codes.InvalidOTPCode)) {
+		if failErr := s.throttle.FailMFA(ctx, challenge); failErr != nil {
+			return failErr
+		}
+
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return s.throttle.SucceedMFA(ctx, challenge)
+}
+
+func (s *Service) verify(ctx context.Context, log logger.Logger, userID uint64, code string) error {
+	stored, err := s.getTOTP(ctx, log, userID)
+	if err != nil {
+		return err
+	}
+
+	if !stored.IsConfirmed() {
+		return s.errorsService.GetError(codes.TOTPNotEnabled)
+	}
+
+	if isTOTPCode(code) {
+		return s.verifyTOTP(ctx, log, stored, code)
+	}
+
+	used, err := s.mfaRepo.UseRecoveryCode(ctx, userID, secret.Hash(normalizeRecoveryCode(code)))
+	if err != nil {
+		log.Errorf("failed to use recovery code: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
+
+	if !used {
+		return s.errorsService.GetError(codes.InvalidOTPCode)
+	}
+
+	return nil
+}
+
+// inTx runs fn in a transaction and reports a failed transaction as an internal error.
+func (s *Service) inTx(ctx context.Context, log logger.Logger, fn func(ctx context.Context) error) error {
+	err := s.transactor.WithTx(ctx, fn)
+
+	var ce *cerrors.Error
+
+	if err != nil && !errors.As(err, &ce) {
+		log.Errorf("failed to run transaction: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
+
+	return err
+}
+
+func (s *Service) getTOTP(ctx context.Context, log logger.Logger, userID uint64) (entity.TOTP, error) {
+	stored, err := s.mfaRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.TOTP{}, s.errorsService.GetError(codes.TOTPNotEnabled)
+		}
+
+		log.Errorf("failed to get totp: %v", err)
+
+		return entity.TOTP{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	return stored, nil
+}
+
+// verifyTOTP checks the code and rejects codes of steps that were already used.
+func (s *Service) verifyTOTP(ctx context.Context, log logger.Logger, stored entity.TOTP, code string) error {
+	if s.aead == nil {
+		log.Errorf("totp secret stored without an encryption key")
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
+
+	plain, err := decrypt(s.aead, stored.Secret)
+	if err != nil {
+		log.Errorf("failed to decrypt secret: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
+
+	step, ok := totp.Validate(plain, code, time.Now(), totpSkew)
+	if !ok || step <= stored.LastUsedStep {
+		return s.errorsService.GetError(codes.InvalidOTPCode)
+	}
+
+	fresh, err := s.mfaRepo.UseTOTPStep(ctx, stored.UserID, step)
+	if err != nil {
+		log.Errorf("failed to use totp step: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
+
+	if !fresh {
+		return s.errorsService.GetError(codes.InvalidOTPCode)
+	}
+
+	return nil
+}
+
+func (s *Service) replaceRecoveryCodes(ctx context.Context, log logger.Logger, userID uint64) ([]string, error) {
+	plain := make([]string, 0, s.cfg.RecoveryCodes)
+	hashes := make([]string, 0, s.cfg.RecoveryCodes)
+
+	for range s.cfg.RecoveryCodes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			log.Errorf("failed to generate recovery code: %v", err)
+
+			return nil, s.errorsService.GetError(codes.InternalError)
+		}
+
+		plain = append(plain, code)
+		hashes = append(hashes, secret.Hash(normalizeRecoveryCode(code)))
+	}
+
+	if err := s.mfaRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		log.Errorf("failed to replace recovery codes: %v", err)
+
+		return nil, s.errorsService.GetError(codes.InternalError)
+	}
+
+	return plain, nil
+}
+
+// newRecoveryCode returns a code such as ABCDE-FGHIJ.
+func newRecoveryCode() (string, error) {
+	data := make([]byte, recoveryCodeLength)
+
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	code := base32.StdEncoding.EncodeToString(data)[:recoveryCodeLength]
+
+	return code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+
+	return strings.ReplaceAll(code, " ", "")
+}
+
+func isTOTPCode(code string) bool {
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return code != ""
+}
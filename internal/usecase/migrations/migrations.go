@@ -1,16 +1,17 @@
 package migrations
 
 import (
-	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/jackc/pgx/v5/stdlib"
+	"database/sql"
+
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo"
 	"github.com/pkg/errors"
 	"github.com/pressly/goose/v3"
 )
 
-func Up(pool *pgxpool.Pool, migrationsPath string) error {
-	db := stdlib.OpenDBFromPool(pool)
-
-	if err := goose.SetDialect("postgres"); err != nil {
+// Up applies the migrations written for the dialect, which live in a directory
+// of migrationsPath named after the database driver.
+func Up(db *sql.DB, dialect repo.Dialect, migrationsPath string) error {
+	if err := goose.SetDialect(string(dialect)); err != nil {
 		return errors.Wrap(err, "failed to set dialect")
 	}
 
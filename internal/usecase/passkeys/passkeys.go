@@ -0,0 +1,501 @@
+package passkeys
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/pkg/codes"
+	"github.com/0x16F/cloud-users/pkg/secret"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jackc/pgx/v5"
+)
+
+type Config struct {
+	RPID        string        `env:"WEBAUTHN_RP_ID"`
+	RPName      string        `env:"WEBAUTHN_RP_NAME" env-default:"cloud-users"`
+	RPOrigins   []string      `env:"WEBAUTHN_RP_ORIGINS" env-separator:","`
+	CeremonyTTL time.Duration `env:"WEBAUTHN_CEREMONY_TTL" env-default:"5m"`
+}
+
+type CredentialsRepository interface {
+	CreateWebAuthnCredential(ctx context.Context, credential entity.WebAuthnCredential) (entity.WebAuthnCredential, error)
+	GetWebAuthnCredentials(ctx context.Context, userID uint64) ([]entity.WebAuthnCredential, error)
+	UpdateWebAuthnCredential(ctx context.Context, credential entity.WebAuthnCredential) error
+	DeleteWebAuthnCredential(ctx context.Context, userID uint64, id uint64) (bool, error)
+	SaveWebAuthnCeremony(ctx context.Context, ceremony entity.WebAuthnCeremony) error
+	TakeWebAuthnCeremony(ctx context.Context, id string, purpose string) (entity.WebAuthnCeremony, error)
+}
+
+type UsersService interface {
+	GetUser(ctx context.Context, id uint64) (entity.User, error)
+}
+
+type ErrorsService interface {
+	GetError(code int) error
+}
+
+type Service struct {
+	log             logger.Logger
+	cfg             Config
+	webAuthn        *webauthn.WebAuthn
+	credentialsRepo CredentialsRepository
+	usersService    UsersService
+	errorsService   ErrorsService
+}
+
+// New creates the service. Ceremonies stay unavailable until WEBAUTHN_RP_ID is set,
+// since credentials are bound to the relying party they were registered for.
+func New(
+	log logger.Logger,
+	cfg Config,
+	credentialsRepo CredentialsRepository,
+	usersService UsersService,
+	errorsService ErrorsService,
+) (*Service, error) {
+	service := &Service{
+		log:             log,
+		cfg:             cfg,
+		credentialsRepo: credentialsRepo,
+		usersService:    usersService,
+		errorsService:   errorsService,
+	}
+
+	if cfg.RPID != "" {
+		webAuthn, err := webauthn.New(&webauthn.Config{
+			RPID:          cfg.RPID,
+			RPDisplayName: cfg.RPName,
+			RPOrigins:     cfg.RPOrigins,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		service.webAuthn = webAuthn
+	}
+
+	return service, nil
+}
+
+// BeginRegistration starts registering a new credential for the user. Credentials
+// that are already registered are excluded so an authenticator is not added twice.
+func (s *Service) BeginRegistration(ctx context.Context, userID uint64) (entity.WebAuthnChallenge, error) {
+	log := s.log.WithFields(logger.Fields{
+		"method": "BeginRegistration",
+	})
+
+	if err := s.checkEnabled(log); err != nil {
+		return entity.WebAuthnChallenge{}, err
+	}
+
+	owner, err := s.getUser(ctx, log, userID)
+	if err != nil {
+		return entity.WebAuthnChallenge{}, err
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(owner.credentials))
+	for _, credential := range owner.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	creation, session, err := s.webAuthn.BeginRegistration(
+		owner,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err != nil {
+		log.Errorf("failed to begin registration: %v", err)
+
+		return entity.WebAuthnChallenge{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	return s.saveCeremony(ctx, log, userID, entity.WebAuthnRegistration, session, creation)
+}
+
+// FinishRegistration verifies the attestation and stores the new credential.
+func (s *Service) FinishRegistration(
+	ctx context.Context,
+	userID uint64,
+	ceremonyID string,
+	name string,
+	response []byte,
+) (entity.WebAuthnCredential, error) {
+	log := s.log.WithFields(logger.Fields{
+		"method": "FinishRegistration",
+	})
+
+	if err := s.checkEnabled(log); err != nil {
+		return entity.WebAuthnCredential{}, err
+	}
+
+	session, err := s.takeCeremony(ctx, log, ceremonyID, entity.WebAuthnRegistration, userID)
+	if err != nil {
+		return entity.WebAuthnCredential{}, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(response))
+	if err != nil {
+		log.Warnf("failed to parse attestation: %v", err)
+
+		return entity.WebAuthnCredential{}, s.errorsService.GetError(codes.InvalidWebAuthnCredential)
+	}
+
+	owner, err := s.getUser(ctx, log, userID)
+	if err != nil {
+		return entity.WebAuthnCredential{}, err
+	}
+
+	credential, err := s.webAuthn.CreateCredential(owner, session, parsed)
+	if err != nil {
+		log.Warnf("failed to verify attestation: %v", err)
+
+		return entity.WebAuthnCredential{}, s.errorsService.GetError(codes.InvalidWebAuthnCredential)
+	}
+
+	created, err := s.credentialsRepo.CreateWebAuthnCredential(ctx, newCredential(userID, name, credential))
+	if err != nil {
+		log.Errorf("failed to create credential: %v", err)
+
+		return entity.WebAuthnCredential{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	return created, nil
+}
+
+// BeginLogin starts a passwordless login with a discoverable credential. User
+// verification is required because the passkey replaces both factors.
+func (s *Service) BeginLogin(ctx context.Context) (entity.WebAuthnChallenge, error) {
+	log := s.log.WithFields(logger.Fields{
+		"method": "BeginLogin",
+	})
+
+	if err := s.checkEnabled(log); err != nil {
+		return entity.WebAuthnChallenge{}, err
+	}
+
+	assertion, session, err := s.webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		log.Errorf("failed to begin login: %v", err)
+
+		return entity.WebAuthnChallenge{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	return s.saveCeremony(ctx, log, 0, entity.WebAuthnLogin, session, assertion)
+}
+
+// FinishLogin verifies the assertion of a passwordless login and returns the user
+// that owns the credential.
+func (s *Service) FinishLogin(ctx context.Context, ceremonyID string, response []byte) (entity.User, error) {
+	log := s.log.WithFields(logger.Fields{
+		"method": "FinishLogin",
+	})
+
+	if err := s.checkEnabled(log); err != nil {
+		return entity.User{}, err
+	}
+
+	session, err := s.takeCeremony(ctx, log, ceremonyID, entity.WebAuthnLogin, 0)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+	if err != nil {
+		log.Warnf("failed to parse assertion: %v", err)
+
+		return entity.User{}, s.errorsService.GetError(codes.InvalidWebAuthnCredential)
+	}
+
+	var owner *user
+
+	credential, err := s.webAuthn.ValidateDiscoverableLogin(
+		func(_, userHandle []byte) (webauthn.User, error) {
+			userID, err := parseUserHandle(userHandle)
+			if err != nil {
+				return nil, err
+			}
+
+			owner, err = s.getUser(ctx, log, userID)
+			if err != nil {
+				return nil, err
+			}
+
+			return owner, nil
+		},
+		session,
+		parsed,
+	)
+	if err != nil {
+		log.Warnf("failed to verify assertion: %v", err)
+
+		return entity.User{}, s.errorsService.GetError(codes.InvalidWebAuthnCredential)
+	}
+
+	if owner.user.IsDeleted() {
+		return entity.User{}, s.errorsService.GetError(codes.InvalidCredentials)
+	}
+
+	if owner.user.IsLocked() {
+		return entity.User{}, s.errorsService.GetError(codes.AccountLocked)
+	}
+
+	if err = s.useCredential(ctx, log, owner, credential); err != nil {
+		return entity.User{}, err
+	}
+
+	return owner.user, nil
+}
+
+// BeginMFA starts an assertion with one of the user's credentials as the second factor
+// of a password login.
+func (s *Service) BeginMFA(ctx context.Context, userID uint64) (entity.WebAuthnChallenge, error) {
+	log := s.log.WithFields(logger.Fields{
+		"method": "BeginMFA",
+	})
+
+	if err := s.checkEnabled(log); err != nil {
+		return entity.WebAuthnChallenge{}, err
+	}
+
+	owner, err := s.getUser(ctx, log, userID)
+	if err != nil {
+		return entity.WebAuthnChallenge{}, err
+	}
+
+	if len(owner.credentials) == 0 {
+		return entity.WebAuthnChallenge{}, s.errorsService.GetError(codes.WebAuthnNotEnabled)
+	}
+
+	assertion, session, err := s.webAuthn.BeginLogin(owner)
+	if err != nil {
+		log.Errorf("failed to begin login: %v", err)
+
+		return entity.WebAuthnChallenge{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	return s.saveCeremony(ctx, log, userID, entity.WebAuthnMFA, session, assertion)
+}
+
+// FinishMFA verifies the assertion given as the second factor of a password login.
+func (s *Service) FinishMFA(ctx context.Context, userID uint64, ceremonyID string, response []byte) error {
+	log := s.log.WithFields(logger.Fields{
+		"method": "FinishMFA",
+	})
+
+	if err := s.checkEnabled(log); err != nil {
+		return err
+	}
+
+	session, err := s.takeCeremony(ctx, log, ceremonyID, entity.WebAuthnMFA, userID)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+	if err != nil {
+		log.Warnf("failed to parse assertion: %v", err)
+
+		return s.errorsService.GetError(codes.InvalidWebAuthnCredential)
+	}
+
+	owner, err := s.getUser(ctx, log, userID)
+	if err != nil {
+		return err
+	}
+
+	credential, err := s.webAuthn.ValidateLogin(owner, session, parsed)
+	if err != nil {
+		log.Warnf("failed to verify assertion: %v", err)
+
+		return s.errorsService.GetError(codes.InvalidWebAuthnCredential)
+	}
+
+	return s.useCredential(ctx, log, owner, credential)
+}
+
+func (s *Service) GetCredentials(ctx context.Context, userID uint64) ([]entity.WebAuthnCredential, error) {
+	log := s.log.WithFields(logger.Fields{
+		"method": "GetCredentials",
+	})
+
+	credentials, err := s.credentialsRepo.GetWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		log.Errorf("failed to get credentials: %v", err)
+
+		return nil, s.errorsService.GetError(codes.InternalError)
+	}
+
+	return credentials, nil
+}
+
+func (s *Service) DeleteCredential(ctx context.Context, userID uint64, id uint64) error {
+	log := s.log.WithFields(logger.Fields{
+		"method": "DeleteCredential",
+	})
+
+	deleted, err := s.credentialsRepo.DeleteWebAuthnCredential(ctx, userID, id)
+	if err != nil {
+		log.Errorf("failed to delete credential: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
+
+	if !deleted {
+		return s.errorsService.GetError(codes.WebAuthnCredentialNotFound)
+	}
+
+	return nil
+}
+
+func (s *Service) checkEnabled(log logger.Logger) error {
+	if s.webAuthn == nil {
+		log.Warnf("webauthn ceremony requested without a relying party id")
+
+		return s.errorsService.GetError(codes.FeatureIsDisabled)
+	}
+
+	return nil
+}
+
+func (s *Service) getUser(ctx context.Context, log logger.Logger, userID uint64) (*user, error) {
+	found, err := s.usersService.GetUser(ctx, userID)
+	if err != nil {
+		log.Errorf("failed to get user: %v", err)
+
+		return nil, err
+	}
+
+	credentials, err := s.credentialsRepo.GetWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		log.Errorf("failed to get credentials: %v", err)
+
+		return nil, s.errorsService.GetError(codes.InternalError)
+	}
+
+	return &user{
+		user:        found,
+		credentials: credentials,
+	}, nil
+}
+
+func (s *Service) saveCeremony(
+	ctx context.Context,
+	log logger.Logger,
+	userID uint64,
+	purpose string,
+	session *webauthn.SessionData,
+	options any,
+) (entity.WebAuthnChallenge, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		log.Errorf("failed to marshal session data: %v", err)
+
+		return entity.WebAuthnChallenge{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	plain, hash, err := secret.New()
+	if err != nil {
+		log.Errorf("failed to generate ceremony id: %v", err)
+
+		return entity.WebAuthnChallenge{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	err = s.credentialsRepo.SaveWebAuthnCeremony(ctx, entity.WebAuthnCeremony{
+		ID:        hash,
+		UserID:    userID,
+		Purpose:   purpose,
+		Data:      data,
+		ExpiresAt: time.Now().Add(s.cfg.CeremonyTTL),
+	})
+	if err != nil {
+		log.Errorf("failed to save ceremony: %v", err)
+
+		return entity.WebAuthnChallenge{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	return entity.WebAuthnChallenge{
+		CeremonyID: plain,
+		Options:    options,
+	}, nil
+}
+
+// takeCeremony consumes the ceremony and checks that it was started by the same user.
+func (s *Service) takeCeremony(
+	ctx context.Context,
+	log logger.Logger,
+	ceremonyID string,
+	purpose string,
+	userID uint64,
+) (webauthn.SessionData, error) {
+	ceremony, err := s.credentialsRepo.TakeWebAuthnCeremony(ctx, secret.Hash(ceremonyID), purpose)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return webauthn.SessionData{}, s.errorsService.GetError(codes.InvalidWebAuthnCeremony)
+		}
+
+		log.Errorf("failed to take ceremony: %v", err)
+
+		return webauthn.SessionData{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	if ceremony.UserID != userID {
+		return webauthn.SessionData{}, s.errorsService.GetError(codes.InvalidWebAuthnCeremony)
+	}
+
+	var session webauthn.SessionData
+
+	if err = json.Unmarshal(ceremony.Data, &session); err != nil {
+		log.Errorf("failed to unmarshal session data: %v", err)
+
+		return webauthn.SessionData{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	return session, nil
+}
+
+// useCredential stores the result of a verified assertion. A signature counter that
+// did not increase means the private key may have been copied, so the credential is
+// flagged and refused until the user removes it and registers the authenticator again.
+func (s *Service) useCredential(
+	ctx context.Context,
+	log logger.Logger,
+	owner *user,
+	verified *webauthn.Credential,
+) error {
+	stored, ok := owner.credential(verified.ID)
+	if !ok {
+		return s.errorsService.GetError(codes.InvalidWebAuthnCredential)
+	}
+
+	if stored.CloneWarning {
+		return s.errorsService.GetError(codes.WebAuthnCredentialCloned)
+	}
+
+	stored.CloneWarning = verified.Authenticator.CloneWarning
+	stored.BackupState = verified.Flags.BackupState
+
+	if !stored.CloneWarning {
+		stored.SignCount = verified.Authenticator.SignCount
+	}
+
+	if err := s.credentialsRepo.UpdateWebAuthnCredential(ctx, stored); err != nil {
+		log.Errorf("failed to update credential: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
+
+	if stored.CloneWarning {
+		log.Warnf("signature counter of credential %d of user %d went backwards", stored.ID, stored.UserID)
+
+		return s.errorsService.GetError(codes.WebAuthnCredentialCloned)
+	}
+
+	return nil
+}
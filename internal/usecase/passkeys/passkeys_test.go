@@ -0,0 +1,384 @@
+package passkeys
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo/memory"
+	cerrors "github.com/0x16F/cloud-users/internal/usecase/errors"
+	"github.com/0x16F/cloud-users/pkg/codes"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+const (
+	rpID   = "example.com"
+	origin = "https://example.com"
+)
+
+// the flags of the authenticator data
+const (
+	flagUserPresent        = 0x01
+	flagUserVerified       = 0x04
+	flagAttestedCredential = 0x40
+)
+
+// authenticator is a software passkey: an ES256 key pair, a credential id and a
+// signature counter the test sets before each assertion.
+type authenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+}
+
+func newAuthenticator(t *testing.T) *authenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	credentialID := make([]byte, 16)
+
+	if _, err = rand.Read(credentialID); err != nil {
+		t.Fatalf("failed to generate credential id: %v", err)
+	}
+
+	return &authenticator{
+		key:          key,
+		credentialID: credentialID,
+	}
+}
+
+// register answers the creation options with a "none" attestation.
+func (a *authenticator) register(t *testing.T, options any) []byte {
+	t.Helper()
+
+	creation, ok := options.(*protocol.CredentialCreation)
+	if !ok {
+		t.Fatalf("got %T as creation options", options)
+	}
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatalf("failed to encode public key: %v", err)
+	}
+
+	authData := a.authData(flagUserPresent | flagUserVerified | flagAttestedCredential)
+
+	// an empty AAGUID, then the credential id with its length and the public key
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestation, err := webauthncbor.Marshal(struct {
+		Format    string         `cbor:"fmt"`
+		Statement map[string]any `cbor:"attStmt"`
+		AuthData  []byte         `cbor:"authData"`
+	}{
+		Format:    "none",
+		Statement: map[string]any{},
+		AuthData:  authData,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode attestation: %v", err)
+	}
+
+	return a.response(t, map[string]string{
+		"clientDataJSON":    encode(clientData(t, "webauthn.create", creation.Response.Challenge)),
+		"attestationObject": encode(attestation),
+	})
+}
+
+// login answers the assertion options for the user with the handle.
+func (a *authenticator) login(t *testing.T, options any, userHandle []byte) []byte {
+	t.Helper()
+
+	assertion, ok := options.(*protocol.CredentialAssertion)
+	if !ok {
+		t.Fatalf("got %T as assertion options", options)
+	}
+
+	authData := a.authData(flagUserPresent | flagUserVerified)
+	data := clientData(t, "webauthn.get", assertion.Response.Challenge)
+
+	digest := sha256.Sum256(data)
+	signed := sha256.Sum256(append(append([]byte{}, authData...), digest[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, signed[:])
+	if err != nil {
+		t.Fatalf("failed to sign assertion: %v", err)
+	}
+
+	return a.response(t, map[string]string{
+		"clientDataJSON":    encode(data),
+		"authenticatorData": encode(authData),
+		"signature":         encode(signature),
+		"userHandle":        encode(userHandle),
+	})
+}
+
+func (a *authenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+
+	data := append(rpIDHash[:], flags)
+
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+func (a *authenticator) response(t *testing.T, response map[string]string) []byte {
+	t.Helper()
+
+	encoded, err := json.Marshal(map[string]any{
+		"id":       encode(a.credentialID),
+		"rawId":    encode(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode response: %v", err)
+	}
+
+	return encoded
+}
+
+func clientData(t *testing.T, ceremony string, challenge protocol.URLEncodedBase64) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": encode(challenge),
+		"origin":    origin,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode client data: %v", err)
+	}
+
+	return data
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+type memoryUsers struct {
+	db *memory.DB
+}
+
+func (u memoryUsers) GetUser(ctx context.Context, id uint64) (entity.User, error) {
+	return u.db.GetUser(ctx, id)
+}
+
+func newService(t *testing.T) (*Service, entity.User) {
+	t.Helper()
+
+	log := logger.New("error")
+
+	errorsService, err := cerrors.New(log, "", "en")
+	if err != nil {
+		t.Fatalf("failed to load errors: %v", err)
+	}
+
+	db := memory.NewDB()
+
+	owner, err := db.CreateUser(context.Background(), entity.User{
+		Email:    "alice@example.com",
+		Username: "alice",
+		Password: "password",
+	})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	cfg := Config{
+		RPID:        rpID,
+		RPName:      "test",
+		RPOrigins:   []string{origin},
+		CeremonyTTL: time.Minute,
+	}
+
+	service, err := New(log, cfg, db, memoryUsers{db}, errorsService)
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	return service, owner
+}
+
+// register runs a registration ceremony of the authenticator for the user.
+func register(t *testing.T, s *Service, owner entity.User, a *authenticator) entity.WebAuthnCredential {
+	t.Helper()
+
+	ctx := context.Background()
+
+	challenge, err := s.BeginRegistration(ctx, owner.ID)
+	if err != nil {
+		t.Fatalf("failed to begin registration: %v", err)
+	}
+
+	credential, err := s.FinishRegistration(ctx, owner.ID, challenge.CeremonyID, "laptop", a.register(t, challenge.Options))
+	if err != nil {
+		t.Fatalf("failed to finish registration: %v", err)
+	}
+
+	return credential
+}
+
+// login runs a passwordless login ceremony of the authenticator with its counter
+// at signCount.
+func login(t *testing.T, s *Service, owner entity.User, a *authenticator, signCount uint32) (entity.User, error) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	challenge, err := s.BeginLogin(ctx)
+	if err != nil {
+		t.Fatalf("failed to begin login: %v", err)
+	}
+
+	a.signCount = signCount
+
+	return s.FinishLogin(ctx, challenge.CeremonyID, a.login(t, challenge.Options, (&user{user: owner}).WebAuthnID()))
+}
+
+func TestRegistration(t *testing.T) {
+	s, owner := newService(t)
+
+	credential := register(t, s, owner, newAuthenticator(t))
+
+	if credential.UserID != owner.ID || credential.Name != "laptop" {
+		t.Errorf("got credential %q of user %d, want laptop of user %d", credential.Name, credential.UserID, owner.ID)
+	}
+
+	credentials, err := s.GetCredentials(context.Background(), owner.ID)
+	if err != nil {
+		t.Fatalf("failed to get credentials: %v", err)
+	}
+
+	if len(credentials) != 1 {
+		t.Fatalf("got %d credentials, want 1", len(credentials))
+	}
+
+	// the ceremony is used up
+	ctx := context.Background()
+
+	challenge, err := s.BeginRegistration(ctx, owner.ID)
+	if err != nil {
+		t.Fatalf("failed to begin registration: %v", err)
+	}
+
+	response := newAuthenticator(t).register(t, challenge.Options)
+
+	if _, err = s.FinishRegistration(ctx, owner.ID, challenge.CeremonyID, "phone", response); err != nil {
+		t.Fatalf("failed to finish registration: %v", err)
+	}
+
+	_, err = s.FinishRegistration(ctx, owner.ID, challenge.CeremonyID, "phone", response)
+	assertCode(t, err, codes.InvalidWebAuthnCeremony)
+}
+
+func TestLogin(t *testing.T) {
+	tests := []struct {
+		name string
+		// the counters of the logins after the registration, the last one gets want
+		signCounts []uint32
+		want       int
+	}{
+		{
+			name:       "increasing counter",
+			signCounts: []uint32{1, 2, 10},
+		},
+		{
+			name:       "authenticator without a counter",
+			signCounts: []uint32{0, 0},
+		},
+		{
+			name:       "counter went backwards",
+			signCounts: []uint32{5, 3},
+			want:       codes.WebAuthnCredentialCloned,
+		},
+		{
+			name:       "counter repeated",
+			signCounts: []uint32{5, 5},
+			want:       codes.WebAuthnCredentialCloned,
+		},
+		{
+			name:       "cloned credential stays refused",
+			signCounts: []uint32{5, 3, 6},
+			want:       codes.WebAuthnCredentialCloned,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, owner := newService(t)
+			a := newAuthenticator(t)
+
+			register(t, s, owner, a)
+
+			var (
+				got entity.User
+				err error
+			)
+
+			for _, signCount := range tt.signCounts {
+				got, err = login(t, s, owner, a, signCount)
+			}
+
+			if tt.want != 0 {
+				assertCode(t, err, tt.want)
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to log in: %v", err)
+			}
+
+			if got.ID != owner.ID {
+				t.Errorf("logged in as user %d, want %d", got.ID, owner.ID)
+			}
+		})
+	}
+}
+
+func TestLoginWithUnknownCredential(t *testing.T) {
+	s, owner := newService(t)
+
+	register(t, s, owner, newAuthenticator(t))
+
+	_, err := login(t, s, owner, newAuthenticator(t), 1)
+	assertCode(t, err, codes.InvalidWebAuthnCredential)
+}
+
+func assertCode(t *testing.T, err error, code int) {
+	t.Helper()
+
+	var ce *cerrors.Error
+
+	if !errors.As(err, &ce) || ce.Code != code {
+		t.Errorf("got %v, want code %d", err, code)
+	}
+}
@@ -0,0 +1,106 @@
+package passkeys
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const userHandleLength = 8
+
+// user adapts a user and its stored credentials to webauthn.User.
+type user struct {
+	user        entity.User
+	credentials []entity.WebAuthnCredential
+}
+
+// WebAuthnID returns the user handle, the big endian user id.
+func (u *user) WebAuthnID() []byte {
+	handle := make([]byte, userHandleLength)
+	binary.BigEndian.PutUint64(handle, u.user.ID)
+
+	return handle
+}
+
+func (u *user) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *user) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u *user) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *user) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+
+	for _, credential := range u.credentials {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(credential.Transports))
+		for _, transport := range credential.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              credential.CredentialID,
+			PublicKey:       credential.PublicKey,
+			AttestationType: credential.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: credential.BackupEligible,
+				BackupState:    credential.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:       credential.AAGUID,
+				SignCount:    credential.SignCount,
+				CloneWarning: credential.CloneWarning,
+			},
+		})
+	}
+
+	return credentials
+}
+
+func (u *user) credential(credentialID []byte) (entity.WebAuthnCredential, bool) {
+	for _, credential := range u.credentials {
+		if bytes.Equal(credential.CredentialID, credentialID) {
+			return credential, true
+		}
+	}
+
+	return entity.WebAuthnCredential{}, false
+}
+
+func parseUserHandle(handle []byte) (uint64, error) {
+	if len(handle) != userHandleLength {
+		return 0, errors.New("invalid user handle")
+	}
+
+	return binary.BigEndian.Uint64(handle), nil
+}
+
+func newCredential(userID uint64, name string, credential *webauthn.Credential) entity.WebAuthnCredential {
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	return entity.WebAuthnCredential{
+		UserID:          userID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		Transports:      transports,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+}
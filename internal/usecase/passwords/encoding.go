@@ -0,0 +1,51 @@
+package passwords
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+// encodeBase64 encodes bytes the way PHC strings do: standard alphabet without padding.
+func encodeBase64(data []byte) string {
+	return base64.RawStdEncoding.EncodeToString(data)
+}
+
+// decodeBase64 accepts standard base64 with or without padding as well as the
+// passlib "adapted" alphabet that uses '.' instead of '+'.
+func decodeBase64(data string) ([]byte, error) {
+	data = strings.TrimRight(data, "=")
+	data = strings.ReplaceAll(data, ".", "+")
+
+	return base64.RawStdEncoding.DecodeString(data)
+}
+
+// parseParams parses a PHC parameter list such as "ln=15,r=8,p=1".
+func parseParams(params string) (map[string]string, error) {
+	result := make(map[string]string)
+
+	for _, param := range strings.Split(params, ",") {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return nil, ErrMalformedHash
+		}
+
+		result[key] = value
+	}
+
+	return result, nil
+}
+
+func parseIntParam(params map[string]string, key string) (int, error) {
+	value, ok := params[key]
+	if !ok {
+		return 0, ErrMalformedHash
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, ErrMalformedHash
+	}
+
+	return n, nil
+}
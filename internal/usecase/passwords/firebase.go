@@ -0,0 +1,134 @@
+package passwords
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	firebaseKeyLength = 32
+)
+
+type firebaseParams struct {
+	memCost       int
+	rounds        int
+	saltSeparator []byte
+	signerKey     []byte
+}
+
+// FirebaseScrypt verifies hashes exported from Firebase Authentication. The project
+// hash parameters are kept inside the encoded hash so that every row is self-contained:
+// $firebase-scrypt$m=14,r=8,s=<salt separator>,k=<signer key>$salt$hash.
+type FirebaseScrypt struct{}
+
+func NewFirebaseScrypt() *FirebaseScrypt {
+	return &FirebaseScrypt{}
+}
+
+func (f *FirebaseScrypt) IDs() []string {
+	return []string{AlgorithmFirebaseScrypt}
+}
+
+func (f *FirebaseScrypt) Verify(password string, encoded string) (bool, error) {
+	params, salt, hash, err := decodeFirebaseScrypt(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	actual, err := firebaseHash(password, params, salt)
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(actual, hash) == 1, nil
+}
+
+// firebaseHash encrypts the signer key with AES-256-CTR using the scrypt derived
+// key of the password, which is what Firebase stores as the password hash.
+func firebaseHash(password string, params firebaseParams, salt []byte) ([]byte, error) {
+	derived, err := scrypt.Key(
+		[]byte(password),
+		append(append([]byte{}, salt...), params.saltSeparator...),
+		1<<params.memCost,
+		params.rounds,
+		1,
+		firebaseKeyLength,
+	)
+	if err != nil {
+		return nil, ErrMalformedHash
+	}
+
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, ErrMalformedHash
+	}
+
+	result := make([]byte, len(params.signerKey))
+	cipher.NewCTR(block, make([]byte, aes.BlockSize)).XORKeyStream(result, params.signerKey)
+
+	return result, nil
+}
+
+func decodeFirebaseScrypt(encoded string) (firebaseParams, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[1] != AlgorithmFirebaseScrypt {
+		return firebaseParams{}, nil, nil, ErrMalformedHash
+	}
+
+	raw, err := parseParams(parts[2])
+	if err != nil {
+		return firebaseParams{}, nil, nil, err
+	}
+
+	var params firebaseParams
+
+	if params.memCost, err = parseIntParam(raw, "m"); err != nil {
+		return firebaseParams{}, nil, nil, err
+	}
+
+	if params.rounds, err = parseIntParam(raw, "r"); err != nil {
+		return firebaseParams{}, nil, nil, err
+	}
+
+	if err = checkScryptCost(params.memCost, params.rounds, 1); err != nil {
+		return firebaseParams{}, nil, nil, err
+	}
+
+	if params.saltSeparator, err = decodeBase64(raw["s"]); err != nil {
+		return firebaseParams{}, nil, nil, ErrMalformedHash
+	}
+
+	if params.signerKey, err = decodeBase64(raw["k"]); err != nil || len(params.signerKey) == 0 {
+		return firebaseParams{}, nil, nil, ErrMalformedHash
+	}
+
+	salt, err := decodeBase64(parts[3])
+	if err != nil {
+		return firebaseParams{}, nil, nil, ErrMalformedHash
+	}
+
+	hash, err := decodeBase64(parts[4])
+	if err != nil || len(hash) == 0 {
+		return firebaseParams{}, nil, nil, ErrMalformedHash
+	}
+
+	return params, salt, hash, nil
+}
+
+func encodeFirebaseScrypt(params firebaseParams, salt []byte, hash []byte) string {
+	return fmt.Sprintf(
+		"$%s$m=%d,r=%d,s=%s,k=%s$%s$%s",
+		AlgorithmFirebaseScrypt,
+		params.memCost,
+		params.rounds,
+		encodeBase64(params.saltSeparator),
+		encodeBase64(params.signerKey),
+		encodeBase64(salt),
+		encodeBase64(hash),
+	)
+}
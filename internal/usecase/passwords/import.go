@@ -0,0 +1,128 @@
+package passwords
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/0x16F/cloud-users/internal/entity"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var djangoPBKDF2IDs = map[string]string{
+	"pbkdf2_sha1":   AlgorithmPBKDF2,
+	"pbkdf2_sha256": AlgorithmPBKDF2 + "-sha256",
+}
+
+// Normalize converts a hash exported by another system into the tagged form the
+// service stores and verifies. The result is verified through Verify like any
+// other hash and gets replaced by the configured algorithm on the next login.
+func (s *Service) Normalize(cfg entity.PasswordHashConfig, hash string, salt string) (string, error) {
+	switch cfg.Algorithm {
+	case AlgorithmBcrypt:
+		return normalizeBcrypt(hash)
+	case AlgorithmScrypt:
+		params, salt, key, err := decodeScrypt(hash)
+		if err != nil {
+			return "", err
+		}
+
+		return encodeScrypt(params, salt, key), nil
+	case AlgorithmPBKDF2:
+		return normalizePBKDF2(hash)
+	case AlgorithmFirebaseScrypt:
+		return normalizeFirebaseScrypt(cfg, hash, salt)
+	default:
+		return "", ErrUnknownAlgorithm
+	}
+}
+
+func normalizeBcrypt(hash string) (string, error) {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return "", ErrMalformedHash
+	}
+
+	if cost > maxBcryptCost {
+		return "", ErrCostTooHigh
+	}
+
+	return hash, nil
+}
+
+// normalizePBKDF2 accepts both the passlib form and the Django form
+// pbkdf2_sha256$260000$salt$key, where the salt is stored as plain text.
+func normalizePBKDF2(hash string) (string, error) {
+	if strings.HasPrefix(hash, "$") {
+		id, iterations, salt, key, err := decodePBKDF2(hash)
+		if err != nil {
+			return "", err
+		}
+
+		return encodePBKDF2(id, iterations, salt, key), nil
+	}
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 {
+		return "", ErrMalformedHash
+	}
+
+	id, ok := djangoPBKDF2IDs[parts[0]]
+	if !ok {
+		return "", ErrUnknownAlgorithm
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return "", ErrMalformedHash
+	}
+
+	key, err := decodeBase64(parts[3])
+	if err != nil || len(key) == 0 {
+		return "", ErrMalformedHash
+	}
+
+	if err = checkPBKDF2Cost(iterations, key); err != nil {
+		return "", err
+	}
+
+	return encodePBKDF2(id, iterations, []byte(parts[2]), key), nil
+}
+
+func normalizeFirebaseScrypt(cfg entity.PasswordHashConfig, hash string, salt string) (string, error) {
+	if cfg.MemCost <= 0 || cfg.Rounds <= 0 {
+		return "", ErrMalformedHash
+	}
+
+	if err := checkScryptCost(cfg.MemCost, cfg.Rounds, 1); err != nil {
+		return "", err
+	}
+
+	signerKey, err := decodeBase64(cfg.SignerKey)
+	if err != nil || len(signerKey) == 0 {
+		return "", ErrMalformedHash
+	}
+
+	saltSeparator, err := decodeBase64(cfg.SaltSeparator)
+	if err != nil {
+		return "", ErrMalformedHash
+	}
+
+	decodedSalt, err := decodeBase64(salt)
+	if err != nil {
+		return "", ErrMalformedHash
+	}
+
+	decodedHash, err := decodeBase64(hash)
+	if err != nil || len(decodedHash) == 0 {
+		return "", ErrMalformedHash
+	}
+
+	params := firebaseParams{
+		memCost:       cfg.MemCost,
+		rounds:        cfg.Rounds,
+		saltSeparator: saltSeparator,
+		signerKey:     signerKey,
+	}
+
+	return encodeFirebaseScrypt(params, decodedSalt, decodedHash), nil
+}
@@ -0,0 +1,132 @@
+package passwords
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/0x16F/cloud-common/pkg/generator"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/pkg/errors"
+)
+
+const (
+	AlgorithmArgon2id       = "argon2id"
+	AlgorithmBcrypt         = "bcrypt"
+	AlgorithmScrypt         = "scrypt"
+	AlgorithmPBKDF2         = "pbkdf2"
+	AlgorithmFirebaseScrypt = "firebase-scrypt"
+)
+
+// Limits on the cost parameters of hashes that come from other systems. Every
+// login verifies the hash with its own parameters, so one above them could make
+// a login allocate gigabytes or run for minutes.
+const (
+	maxBcryptCost       = 16
+	maxScryptMemory     = 256 << 20 // 128 * N * r bytes
+	maxScryptWork       = 1 << 22   // N * r * p
+	maxPBKDF2Iterations = 2_000_000
+	maxPBKDF2KeyLength  = 64
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+	ErrMalformedHash    = errors.New("malformed password hash")
+	ErrCostTooHigh      = errors.New("password hash cost exceeds the limits")
+)
+
+type Config struct {
+	Algorithm         string `env:"PASSWORD_ALGORITHM" env-default:"argon2id"`
+	Argon2Memory      uint32 `env:"PASSWORD_ARGON2_MEMORY" env-default:"65536"`
+	Argon2Iterations  uint32 `env:"PASSWORD_ARGON2_ITERATIONS" env-default:"3"`
+	Argon2Parallelism uint8  `env:"PASSWORD_ARGON2_PARALLELISM" env-default:"2"`
+	BcryptCost        int    `env:"PASSWORD_BCRYPT_COST" env-default:"12"`
+}
+
+// Verifier checks encoded hashes of a single algorithm.
+type Verifier interface {
+	// IDs returns the identifiers found in the encoded hash prefix.
+	IDs() []string
+	Verify(password string, encoded string) (bool, error)
+}
+
+// Hasher is a Verifier that can also produce new hashes.
+type Hasher interface {
+	Verifier
+	Hash(password string) (string, error)
+	// NeedsRehash reports whether the encoded hash was produced with other parameters than the configured ones.
+	NeedsRehash(encoded string) bool
+}
+
+type Service struct {
+	current   Hasher
+	verifiers map[string]Verifier
+}
+
+func New(cfg Config) (*Service, error) {
+	argon2id := NewArgon2id(cfg.Argon2Memory, cfg.Argon2Iterations, cfg.Argon2Parallelism)
+	bcrypt := NewBcrypt(cfg.BcryptCost)
+
+	service := &Service{
+		verifiers: make(map[string]Verifier),
+	}
+
+	for _, verifier := range []Verifier{argon2id, bcrypt, NewScrypt(), NewPBKDF2(), NewFirebaseScrypt()} {
+		service.Register(verifier)
+	}
+
+	switch cfg.Algorithm {
+	case AlgorithmArgon2id:
+		service.current = argon2id
+	case AlgorithmBcrypt:
+		service.current = bcrypt
+	default:
+		return nil, errors.Wrapf(ErrUnknownAlgorithm, "algorithm %q", cfg.Algorithm)
+	}
+
+	return service, nil
+}
+
+// Register makes the service able to verify hashes with the verifier's identifiers.
+func (s *Service) Register(verifier Verifier) {
+	for _, id := range verifier.IDs() {
+		s.verifiers[id] = verifier
+	}
+}
+
+// Hash encodes the password with the configured algorithm.
+func (s *Service) Hash(password string) (string, error) {
+	return s.current.Hash(password)
+}
+
+// Verify checks the password against the user's stored hash. The second result
+// reports whether the hash should be replaced with one from the configured algorithm.
+func (s *Service) Verify(password string, user entity.User) (bool, bool, error) {
+	if user.Salt != "" {
+		expected := generator.NewHash(password, user.Salt)
+
+		return subtle.ConstantTimeCompare([]byte(expected), []byte(user.Password)) == 1, true, nil
+	}
+
+	verifier, ok := s.verifiers[hashID(user.Password)]
+	if !ok {
+		return false, false, ErrUnknownAlgorithm
+	}
+
+	valid, err := verifier.Verify(password, user.Password)
+	if err != nil {
+		return false, false, err
+	}
+
+	return valid, verifier != Verifier(s.current) || s.current.NeedsRehash(user.Password), nil
+}
+
+// hashID extracts the algorithm identifier from a PHC or modular crypt formatted hash.
+func hashID(encoded string) string {
+	if !strings.HasPrefix(encoded, "$") {
+		return ""
+	}
+
+	id, _, _ := strings.Cut(encoded[1:], "$")
+
+	return id
+}
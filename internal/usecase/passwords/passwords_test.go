@@ -0,0 +1,155 @@
+package passwords
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/0x16F/cloud-common/pkg/generator"
+	"github.com/0x16F/cloud-users/internal/entity"
+)
+
+// cheap parameters, the tests don't need slow hashes
+var testConfig = Config{
+	Algorithm:         AlgorithmArgon2id,
+	Argon2Memory:      64,
+	Argon2Iterations:  1,
+	Argon2Parallelism: 1,
+	BcryptCost:        4,
+}
+
+func newService(t *testing.T, cfg Config) *Service {
+	t.Helper()
+
+	service, err := New(cfg)
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	return service
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		prefix    string
+	}{
+		{
+			algorithm: AlgorithmArgon2id,
+			prefix:    "$argon2id$v=19$m=64,t=1,p=1$",
+		},
+		{
+			algorithm: AlgorithmBcrypt,
+			prefix:    "$2a$04$",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			cfg := testConfig
+			cfg.Algorithm = tt.algorithm
+
+			s := newService(t, cfg)
+
+			hash, err := s.Hash("password")
+			if err != nil {
+				t.Fatalf("failed to hash: %v", err)
+			}
+
+			if !strings.HasPrefix(hash, tt.prefix) {
+				t.Errorf("got hash %q, want the prefix %q", hash, tt.prefix)
+			}
+
+			user := entity.User{Password: hash}
+
+			ok, rehash, err := s.Verify("password", user)
+			if err != nil || !ok || rehash {
+				t.Errorf("got %t, rehash %t and %v for the password, want a match without rehash", ok, rehash, err)
+			}
+
+			if ok, _, err = s.Verify("wrong", user); err != nil || ok {
+				t.Errorf("got %t and %v for a wrong password, want no match", ok, err)
+			}
+		})
+	}
+}
+
+func TestRehashOnNewParameters(t *testing.T) {
+	hash, err := newService(t, testConfig).Hash("password")
+	if err != nil {
+		t.Fatalf("failed to hash: %v", err)
+	}
+
+	cfg := testConfig
+	cfg.Argon2Iterations = 2
+
+	ok, rehash, err := newService(t, cfg).Verify("password", entity.User{Password: hash})
+	if err != nil || !ok || !rehash {
+		t.Errorf("got %t, rehash %t and %v, want a match to rehash", ok, rehash, err)
+	}
+}
+
+// TestLegacyHashes verifies hashes of other systems. They match the password and
+// are replaced with one of the configured algorithm.
+func TestLegacyHashes(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     entity.User
+		password string
+	}{
+		{
+			name:     "salted sha256",
+			user:     entity.User{Password: generator.NewHash("password", "salt"), Salt: "salt"},
+			password: "password",
+		},
+		{
+			// from the OpenBSD test vectors
+			name:     "bcrypt",
+			user:     entity.User{Password: "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW"},
+			password: "U*U",
+		},
+		{
+			name:     "scrypt",
+			user:     entity.User{Password: "$scrypt$ln=10,r=8,p=1$MDEyMzQ1Njc4OWFiY2RlZg$ZEBCzLptWM7dhpNJDU2HbQ945ovKHmVEozHkePPbSqw"},
+			password: "password",
+		},
+		{
+			name:     "pbkdf2 sha1",
+			user:     entity.User{Password: "$pbkdf2$i=1000$c2FsdHlzYWx0eXNhbHR5IQ$VRJNTJnnVZt7adMw44/MH2TYCOY"},
+			password: "password",
+		},
+		{
+			name:     "pbkdf2 sha256",
+			user:     entity.User{Password: "$pbkdf2-sha256$i=1000$c2FsdHlzYWx0eXNhbHR5IQ$gfUzj7Q3rP8nCMccOcKKvpRSo2ncaVfvyQdTc7xU7OA"},
+			password: "password",
+		},
+		{
+			name: "pbkdf2 sha512",
+			user: entity.User{
+				Password: "$pbkdf2-sha512$i=1000$c2FsdHlzYWx0eXNhbHR5IQ$NenVLkLZ37o1QSbe+UVFyZGnEdGfX33D9AJ2OKy1IMqXOi6dpYmA9icKoU01DvTj7QqElEUr8aNnWSQb/1fHhA",
+			},
+			password: "password",
+		},
+	}
+
+	s := newService(t, testConfig)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := s.Verify(tt.password, tt.user)
+			if err != nil || !ok || !rehash {
+				t.Errorf("got %t, rehash %t and %v, want a match to rehash", ok, rehash, err)
+			}
+
+			if ok, _, err = s.Verify("wrong", tt.user); err != nil || ok {
+				t.Errorf("got %t and %v for a wrong password, want no match", ok, err)
+			}
+		})
+	}
+}
+
+func TestUnknownAlgorithm(t *testing.T) {
+	_, _, err := newService(t, testConfig).Verify("password", entity.User{Password: "$md5$abc"})
+	if err == nil {
+		t.Error("got no error for an unknown algorithm")
+	}
+}
@@ -0,0 +1,96 @@
+package passwords
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var pbkdf2Digests = map[string]func() hash.Hash{
+	AlgorithmPBKDF2:             sha1.New,
+	AlgorithmPBKDF2 + "-sha256": sha256.New,
+	AlgorithmPBKDF2 + "-sha512": sha512.New,
+}
+
+// PBKDF2 verifies hashes in the form $pbkdf2-sha256$i=29000$salt$key. The bare
+// rounds form written by passlib ($pbkdf2-sha256$29000$salt$key) is accepted too.
+type PBKDF2 struct{}
+
+func NewPBKDF2() *PBKDF2 {
+	return &PBKDF2{}
+}
+
+func (p *PBKDF2) IDs() []string {
+	ids := make([]string, 0, len(pbkdf2Digests))
+
+	for id := range pbkdf2Digests {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func (p *PBKDF2) Verify(password string, encoded string) (bool, error) {
+	id, iterations, salt, key, err := decodePBKDF2(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	actual := pbkdf2.Key([]byte(password), salt, iterations, len(key), pbkdf2Digests[id])
+
+	return subtle.ConstantTimeCompare(actual, key) == 1, nil
+}
+
+func decodePBKDF2(encoded string) (string, int, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 {
+		return "", 0, nil, nil, ErrMalformedHash
+	}
+
+	id := parts[1]
+	if _, ok := pbkdf2Digests[id]; !ok {
+		return "", 0, nil, nil, ErrMalformedHash
+	}
+
+	iterations, err := strconv.Atoi(strings.TrimPrefix(parts[2], "i="))
+	if err != nil || iterations <= 0 {
+		return "", 0, nil, nil, ErrMalformedHash
+	}
+
+	salt, err := decodeBase64(parts[3])
+	if err != nil {
+		return "", 0, nil, nil, ErrMalformedHash
+	}
+
+	key, err := decodeBase64(parts[4])
+	if err != nil || len(key) == 0 {
+		return "", 0, nil, nil, ErrMalformedHash
+	}
+
+	if err = checkPBKDF2Cost(iterations, key); err != nil {
+		return "", 0, nil, nil, err
+	}
+
+	return id, iterations, salt, key, nil
+}
+
+// checkPBKDF2Cost rejects too many iterations and keys longer than any digest
+// produces, every further block of the key costs the iterations again.
+func checkPBKDF2Cost(iterations int, key []byte) error {
+	if iterations > maxPBKDF2Iterations || len(key) > maxPBKDF2KeyLength {
+		return ErrCostTooHigh
+	}
+
+	return nil
+}
+
+func encodePBKDF2(id string, iterations int, salt []byte, key []byte) string {
+	return fmt.Sprintf("$%s$i=%d$%s$%s", id, iterations, encodeBase64(salt), encodeBase64(key))
+}
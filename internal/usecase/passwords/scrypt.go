@@ -0,0 +1,102 @@
+package passwords
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Scrypt verifies hashes in the passlib PHC form $scrypt$ln=15,r=8,p=1$salt$key.
+type Scrypt struct{}
+
+func NewScrypt() *Scrypt {
+	return &Scrypt{}
+}
+
+func (s *Scrypt) IDs() []string {
+	return []string{AlgorithmScrypt}
+}
+
+func (s *Scrypt) Verify(password string, encoded string) (bool, error) {
+	params, salt, key, err := decodeScrypt(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	actual, err := scrypt.Key([]byte(password), salt, 1<<params.ln, params.r, params.p, len(key))
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+
+	return subtle.ConstantTimeCompare(actual, key) == 1, nil
+}
+
+type scryptParams struct {
+	ln int
+	r  int
+	p  int
+}
+
+func decodeScrypt(encoded string) (scryptParams, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[1] != AlgorithmScrypt {
+		return scryptParams{}, nil, nil, ErrMalformedHash
+	}
+
+	raw, err := parseParams(parts[2])
+	if err != nil {
+		return scryptParams{}, nil, nil, err
+	}
+
+	var params scryptParams
+
+	if params.ln, err = parseIntParam(raw, "ln"); err != nil {
+		return scryptParams{}, nil, nil, err
+	}
+
+	if params.r, err = parseIntParam(raw, "r"); err != nil {
+		return scryptParams{}, nil, nil, err
+	}
+
+	if params.p, err = parseIntParam(raw, "p"); err != nil {
+		return scryptParams{}, nil, nil, err
+	}
+
+	if err = checkScryptCost(params.ln, params.r, params.p); err != nil {
+		return scryptParams{}, nil, nil, err
+	}
+
+	salt, err := decodeBase64(parts[3])
+	if err != nil {
+		return scryptParams{}, nil, nil, ErrMalformedHash
+	}
+
+	key, err := decodeBase64(parts[4])
+	if err != nil || len(key) == 0 {
+		return scryptParams{}, nil, nil, ErrMalformedHash
+	}
+
+	return params, salt, key, nil
+}
+
+// checkScryptCost rejects parameters whose memory, 128 * 2^ln * r bytes, or work,
+// 2^ln * r * p, exceed the limits.
+func checkScryptCost(ln int, r int, p int) error {
+	if ln >= 32 || r > maxScryptWork || p > maxScryptWork {
+		return ErrCostTooHigh
+	}
+
+	n := uint64(1) << ln
+
+	if 128*n*uint64(r) > maxScryptMemory || n*uint64(r) > maxScryptWork/uint64(p) {
+		return ErrCostTooHigh
+	}
+
+	return nil
+}
+
+func encodeScrypt(params scryptParams, salt []byte, key []byte) string {
+	return fmt.Sprintf("$%s$ln=%d,r=%d,p=%d$%s$%s", AlgorithmScrypt, params.ln, params.r, params.p, encodeBase64(salt), encodeBase64(key))
+}
@@ -0,0 +1,79 @@
+package policy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	prefixLength = 5
+)
+
+// Corpus looks passwords up in a local copy of the breached passwords in the range
+// format of Have I Been Pwned: one file per 5 character prefix of the uppercase SHA-1
+// hash, named after the prefix with an optional .txt extension, holding
+// SUFFIX:COUNT lines. Only the file of the password's prefix is read per lookup, so
+// the full corpus never has to fit in memory.
+type Corpus struct {
+	dir string
+}
+
+func NewCorpus(dir string) (*Corpus, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open breached passwords corpus")
+	}
+
+	if !info.IsDir() {
+		return nil, errors.Errorf("breached passwords corpus %s is not a directory", dir)
+	}
+
+	return &Corpus{
+		dir: dir,
+	}, nil
+}
+
+func (c *Corpus) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	file, err := c.open(prefix)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+
+		// padding entries of the API have a count of 0 and are not breached passwords
+		if strings.EqualFold(line, suffix) && count != "0" {
+			return true, nil
+		}
+	}
+
+	return false, errors.Wrapf(scanner.Err(), "failed to read breached passwords of %s", prefix)
+}
+
+func (c *Corpus) open(prefix string) (*os.File, error) {
+	file, err := os.Open(filepath.Join(c.dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(filepath.Join(c.dir, prefix+".txt"))
+	}
+
+	return file, err
+}
@@ -0,0 +1,233 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/pkg/errors"
+)
+
+// minIdentityLength keeps very short usernames and email local parts from banning
+// every password that happens to contain them.
+const (
+	minIdentityLength = 3
+)
+
+type Config struct {
+	MinLength      int    `env:"PASSWORD_POLICY_MIN_LENGTH" env-default:"8"`
+	MaxLength      int    `env:"PASSWORD_POLICY_MAX_LENGTH" env-default:"128"`
+	RequireLower   bool   `env:"PASSWORD_POLICY_REQUIRE_LOWER" env-default:"false"`
+	RequireUpper   bool   `env:"PASSWORD_POLICY_REQUIRE_UPPER" env-default:"false"`
+	RequireDigit   bool   `env:"PASSWORD_POLICY_REQUIRE_DIGIT" env-default:"false"`
+	RequireSymbol  bool   `env:"PASSWORD_POLICY_REQUIRE_SYMBOL" env-default:"false"`
+	ForbidIdentity bool   `env:"PASSWORD_POLICY_FORBID_IDENTITY" env-default:"true"`
+	HistorySize    int    `env:"PASSWORD_POLICY_HISTORY_SIZE" env-default:"5"`
+	BreachedPath   string `env:"PASSWORD_POLICY_BREACHED_PATH"`
+}
+
+type HistoryRepository interface {
+	AddPasswordHistory(ctx context.Context, entry entity.PasswordHistoryEntry, keep int) error
+	GetPasswordHistory(ctx context.Context, userID uint64, count int) ([]entity.PasswordHistoryEntry, error)
+}
+
+type PasswordsService interface {
+	Verify(password string, user entity.User) (bool, bool, error)
+}
+
+// Service decides whether a password may be set. Violations are returned as
+// *entity.PasswordPolicyError, any other error is a failure of the check itself.
+type Service struct {
+	log              logger.Logger
+	cfg              Config
+	historyRepo      HistoryRepository
+	passwordsService PasswordsService
+	corpus           *Corpus
+}
+
+func New(
+	log logger.Logger,
+	cfg Config,
+	historyRepo HistoryRepository,
+	passwordsService PasswordsService,
+) (*Service, error) {
+	service := &Service{
+		log:              log,
+		cfg:              cfg,
+		historyRepo:      historyRepo,
+		passwordsService: passwordsService,
+	}
+
+	if cfg.BreachedPath != "" {
+		corpus, err := NewCorpus(cfg.BreachedPath)
+		if err != nil {
+			return nil, err
+		}
+
+		service.corpus = corpus
+	}
+
+	return service, nil
+}
+
+// Validate applies the rules that only depend on the password itself: its length
+// and character classes.
+func (s *Service) Validate(password string) error {
+	length := utf8.RuneCountInString(password)
+
+	if length < s.cfg.MinLength {
+		return violation(entity.PasswordRuleMinLength, "must be at least %d characters long", s.cfg.MinLength)
+	}
+
+	if length > s.cfg.MaxLength {
+		return violation(entity.PasswordRuleMaxLength, "must be at most %d characters long", s.cfg.MaxLength)
+	}
+
+	var lower, upper, digit, symbol bool
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	switch {
+	case s.cfg.RequireLower && !lower:
+		return violation(entity.PasswordRuleLower, "must contain a lowercase letter")
+	case s.cfg.RequireUpper && !upper:
+		return violation(entity.PasswordRuleUpper, "must contain an uppercase letter")
+	case s.cfg.RequireDigit && !digit:
+		return violation(entity.PasswordRuleDigit, "must contain a digit")
+	case s.cfg.RequireSymbol && !symbol:
+		return violation(entity.PasswordRuleSymbol, "must contain a symbol")
+	}
+
+	return nil
+}
+
+// Check applies every rule to a password the user wants to set. The user's ID is
+// only needed for the history, new users are checked with a zero ID.
+func (s *Service) Check(ctx context.Context, user entity.User, password string) error {
+	if err := s.Validate(password); err != nil {
+		return err
+	}
+
+	if s.cfg.ForbidIdentity && containsIdentity(user, password) {
+		return violation(entity.PasswordRuleIdentity, "must not contain the username or email")
+	}
+
+	if s.corpus != nil {
+		breached, err := s.corpus.Contains(password)
+		if err != nil {
+			return errors.Wrap(err, "failed to look up breached passwords")
+		}
+
+		if breached {
+			return violation(entity.PasswordRuleBreached, "appears in a data breach, choose another password")
+		}
+	}
+
+	if user.ID != 0 && s.cfg.HistorySize > 0 {
+		reused, err := s.isReused(ctx, user, password)
+		if err != nil {
+			return err
+		}
+
+		if reused {
+			return violation(entity.PasswordRuleReused, "must differ from the last %d passwords", s.cfg.HistorySize)
+		}
+	}
+
+	return nil
+}
+
+// Remember keeps the current password of the user in the history before it is
+// replaced.
+func (s *Service) Remember(ctx context.Context, user entity.User) error {
+	if s.cfg.HistorySize <= 1 {
+		return nil
+	}
+
+	entry := entity.PasswordHistoryEntry{
+		UserID:   user.ID,
+		Password: user.Password,
+		Salt:     user.Salt,
+	}
+
+	// the current password is one of the last HistorySize ones, so the history only
+	// holds the others
+	if err := s.historyRepo.AddPasswordHistory(ctx, entry, s.cfg.HistorySize-1); err != nil {
+		return errors.Wrap(err, "failed to remember password")
+	}
+
+	return nil
+}
+
+func (s *Service) isReused(ctx context.Context, user entity.User, password string) (bool, error) {
+	previous := []entity.User{user}
+
+	if s.cfg.HistorySize > 1 {
+		history, err := s.historyRepo.GetPasswordHistory(ctx, user.ID, s.cfg.HistorySize-1)
+		if err != nil {
+			return false, errors.Wrap(err, "failed to get password history")
+		}
+
+		for _, entry := range history {
+			previous = append(previous, entity.User{
+				ID:       entry.UserID,
+				Password: entry.Password,
+				Salt:     entry.Salt,
+			})
+		}
+	}
+
+	for _, hashed := range previous {
+		ok, _, err := s.passwordsService.Verify(password, hashed)
+		if err != nil {
+			// hashes of unknown algorithms can't match, they don't block the change
+			s.log.Warnf("failed to verify password of user %d against history: %v", user.ID, err)
+
+			continue
+		}
+
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func containsIdentity(user entity.User, password string) bool {
+	password = strings.ToLower(password)
+
+	local, _, _ := strings.Cut(user.Email, "@")
+
+	for _, identity := range []string{user.Username, user.Email, local} {
+		identity = strings.ToLower(identity)
+
+		if utf8.RuneCountInString(identity) >= minIdentityLength && strings.Contains(password, identity) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func violation(rule string, format string, args ...any) error {
+	return &entity.PasswordPolicyError{
+		Rule:    rule,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
@@ -0,0 +1,238 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo/memory"
+)
+
+type plainPasswords struct{}
+
+func (plainPasswords) Verify(password string, user entity.User) (bool, bool, error) {
+	return user.Password == "plain:"+password, false, nil
+}
+
+func newService(t *testing.T, cfg Config) (*Service, *memory.DB) {
+	t.Helper()
+
+	db := memory.NewDB()
+
+	service, err := New(logger.New("error"), cfg, db, plainPasswords{})
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	return service, db
+}
+
+// assertRule fails the test unless err is a violation of rule, or nil for an empty
+// rule.
+func assertRule(t *testing.T, err error, rule string) {
+	t.Helper()
+
+	var policyErr *entity.PasswordPolicyError
+
+	switch {
+	case rule == "" && err != nil:
+		t.Errorf("got %v, want no violation", err)
+	case rule != "" && !errors.As(err, &policyErr):
+		t.Errorf("got %v, want a violation of %s", err, rule)
+	case rule != "" && policyErr.Rule != rule:
+		t.Errorf("got a violation of %s, want %s", policyErr.Rule, rule)
+	}
+}
+
+func TestRules(t *testing.T) {
+	user := entity.User{Email: "alice@example.com", Username: "alice"}
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		password string
+		rule     string
+	}{
+		{
+			name:     "too short",
+			cfg:      Config{MinLength: 8, MaxLength: 16},
+			password: "short",
+			rule:     entity.PasswordRuleMinLength,
+		},
+		{
+			name:     "too long",
+			cfg:      Config{MinLength: 8, MaxLength: 16},
+			password: "much too long a password",
+			rule:     entity.PasswordRuleMaxLength,
+		},
+		{
+			// the length is counted in characters, not bytes
+			name:     "multibyte length",
+			cfg:      Config{MinLength: 8, MaxLength: 8},
+			password: "пароль12",
+		},
+		{
+			name:     "no lowercase",
+			cfg:      Config{MaxLength: 16, RequireLower: true},
+			password: "PASSWORD",
+			rule:     entity.PasswordRuleLower,
+		},
+		{
+			name:     "no uppercase",
+			cfg:      Config{MaxLength: 16, RequireUpper: true},
+			password: "password",
+			rule:     entity.PasswordRuleUpper,
+		},
+		{
+			name:     "no digit",
+			cfg:      Config{MaxLength: 16, RequireDigit: true},
+			password: "password",
+			rule:     entity.PasswordRuleDigit,
+		},
+		{
+			name:     "no symbol",
+			cfg:      Config{MaxLength: 16, RequireSymbol: true},
+			password: "password1",
+			rule:     entity.PasswordRuleSymbol,
+		},
+		{
+			name: "every class",
+			cfg: Config{
+				MaxLength:     16,
+				RequireLower:  true,
+				RequireUpper:  true,
+				RequireDigit:  true,
+				RequireSymbol: true,
+			},
+			password: "Passw0rd!",
+		},
+		{
+			name:     "username",
+			cfg:      Config{MaxLength: 16, ForbidIdentity: true},
+			password: "my-Alice-123",
+			rule:     entity.PasswordRuleIdentity,
+		},
+		{
+			name:     "email",
+			cfg:      Config{MaxLength: 32, ForbidIdentity: true},
+			password: "ALICE@EXAMPLE.COM!",
+			rule:     entity.PasswordRuleIdentity,
+		},
+		{
+			name:     "identity allowed",
+			cfg:      Config{MaxLength: 16},
+			password: "my-alice-123",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newService(t, tt.cfg)
+
+			assertRule(t, s.Check(context.Background(), user, tt.password), tt.rule)
+		})
+	}
+}
+
+func TestShortIdentity(t *testing.T) {
+	s, _ := newService(t, Config{MaxLength: 16, ForbidIdentity: true})
+
+	// a username shorter than minIdentityLength doesn't ban the passwords holding it
+	err := s.Check(context.Background(), entity.User{Email: "al@example.com", Username: "al"}, "always-allowed")
+	assertRule(t, err, "")
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+
+	s, db := newService(t, Config{MaxLength: 16, HistorySize: 3})
+
+	user, err := db.CreateUser(ctx, entity.User{
+		Email:    "alice@example.com",
+		Username: "alice",
+		Password: "plain:first",
+	})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	// the user changes the password twice, each change remembers the one replaced
+	for _, next := range []string{"second", "third"} {
+		if err = s.Remember(ctx, user); err != nil {
+			t.Fatalf("failed to remember password: %v", err)
+		}
+
+		user.Password = "plain:" + next
+	}
+
+	for _, password := range []string{"first", "second", "third"} {
+		assertRule(t, s.Check(ctx, user, password), entity.PasswordRuleReused)
+	}
+
+	assertRule(t, s.Check(ctx, user, "fourth"), "")
+
+	// a fourth change pushes the first password out of the history
+	if err = s.Remember(ctx, user); err != nil {
+		t.Fatalf("failed to remember password: %v", err)
+	}
+
+	user.Password = "plain:fourth"
+
+	history, err := db.GetPasswordHistory(ctx, user.ID, 10)
+	if err != nil {
+		t.Fatalf("failed to get history: %v", err)
+	}
+
+	if len(history) != 2 {
+		t.Errorf("got %d history entries, want 2", len(history))
+	}
+
+	assertRule(t, s.Check(ctx, user, "first"), "")
+	assertRule(t, s.Check(ctx, user, "second"), entity.PasswordRuleReused)
+
+	// new users have no history yet
+	assertRule(t, s.Check(ctx, entity.User{Password: "plain:second"}, "second"), "")
+}
+
+func TestBreached(t *testing.T) {
+	dir := t.TempDir()
+
+	// files of the corpus by the prefix of the SHA-1 hash
+	files := map[string]string{
+		// "password"
+		"5BAA6": "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9659365\r\n",
+		// "letmein", with the extension and a lowercase suffix
+		"B7A87.txt": "5fc1ea228b9061041b7cec4bd3c52ab3ce3:512\r\n",
+		// "correct horse" as a padding entry
+		"2F9E5": "3523B62ABC141A2B4D6019D23CBA835DBD0:0\r\n",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write corpus: %v", err)
+		}
+	}
+
+	s, _ := newService(t, Config{MaxLength: 16, BreachedPath: dir})
+
+	tests := []struct {
+		password string
+		rule     string
+	}{
+		{password: "password", rule: entity.PasswordRuleBreached},
+		{password: "letmein", rule: entity.PasswordRuleBreached},
+		{password: "correct horse"},
+		// no file for the prefix
+		{password: "Tr0ub4dor&3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			assertRule(t, s.Check(context.Background(), entity.User{}, tt.password), tt.rule)
+		})
+	}
+}
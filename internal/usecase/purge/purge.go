@@ -0,0 +1,124 @@
+package purge
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+)
+
+const (
+	ModeDelete    = "delete"
+	ModeAnonymize = "anonymize"
+)
+
+type Config struct {
+	Interval  time.Duration `env:"PURGE_INTERVAL" env-default:"1h"`
+	Retention time.Duration `env:"PURGE_RETENTION" env-default:"720h"`
+	Mode      string        `env:"PURGE_MODE" env-default:"delete"`
+	BatchSize int           `env:"PURGE_BATCH_SIZE" env-default:"1000"`
+}
+
+type UsersRepository interface {
+	PurgeUsers(ctx context.Context, before time.Time, count int) (int64, error)
+	AnonymizeUsers(ctx context.Context, before time.Time, count int) (int64, error)
+}
+
+// Job purges the users that were deleted longer than the retention ago: it either
+// deletes their rows or anonymizes them, depending on the mode. Deleted users can
+// be restored until they are purged.
+type Job struct {
+	log       logger.Logger
+	cfg       Config
+	usersRepo UsersRepository
+	stop      chan struct{}
+}
+
+func New(log logger.Logger, cfg Config, usersRepo UsersRepository) (*Job, error) {
+	if cfg.Mode != ModeDelete && cfg.Mode != ModeAnonymize {
+		return nil, fmt.Errorf("unknown purge mode %q", cfg.Mode)
+	}
+
+	if cfg.BatchSize <= 0 {
+		return nil, fmt.Errorf("invalid purge batch size %d", cfg.BatchSize)
+	}
+
+	return &Job{
+		log:       log,
+		cfg:       cfg,
+		usersRepo: usersRepo,
+		stop:      make(chan struct{}),
+	}, nil
+}
+
+// Start runs the job every interval until Close. A non-positive interval disables
+// the job.
+func (j *Job) Start() {
+	if j.cfg.Interval <= 0 {
+		return
+	}
+
+	log := j.log.WithFields(logger.Fields{
+		"method": "Start",
+	})
+
+	go func() {
+		ticker := time.NewTicker(j.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-j.stop:
+				return
+			case <-ticker.C:
+			}
+
+			purged, err := j.Run(context.Background())
+			if err != nil {
+				log.Errorf("failed to purge users: %v", err)
+			}
+
+			if purged != 0 {
+				log.Infof("purged %d deleted users", purged)
+			}
+		}
+	}()
+}
+
+// Run purges the due users in batches and returns how many it purged.
+func (j *Job) Run(ctx context.Context) (int64, error) {
+	before := time.Now().UTC().Add(-j.cfg.Retention)
+
+	purge := j.usersRepo.PurgeUsers
+	if j.cfg.Mode == ModeAnonymize {
+		purge = j.usersRepo.AnonymizeUsers
+	}
+
+	var total int64
+
+	for {
+		select {
+		case <-j.stop:
+			return total, nil
+		default:
+		}
+
+		purged, err := purge(ctx, before, j.cfg.BatchSize)
+		if err != nil {
+			return total, err
+		}
+
+		total += purged
+
+		if purged < int64(j.cfg.BatchSize) {
+			return total, nil
+		}
+	}
+}
+
+func (j *Job) Close() error {
+	close(j.stop)
+
+	return nil
+}
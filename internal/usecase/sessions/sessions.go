@@ -0,0 +1,288 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/entity"
+	cerrors "github.com/0x16F/cloud-users/internal/usecase/errors"
+	"github.com/0x16F/cloud-users/pkg/codes"
+	"github.com/0x16F/cloud-users/pkg/secret"
+	"github.com/jackc/pgx/v5"
+)
+
+type Config struct {
+	RefreshTTL time.Duration `env:"REFRESH_TOKEN_TTL" env-default:"720h"`
+}
+
+type SessionsRepository interface {
+	CreateSession(ctx context.Context, session entity.Session) (entity.Session, error)
+	GetSession(ctx context.Context, id uint64) (entity.Session, error)
+	GetSessions(ctx context.Context, userID uint64) ([]entity.Session, error)
+	TouchSession(ctx context.Context, id uint64, device entity.Device, expiresAt time.Time) error
+	RevokeSession(ctx context.Context, userID uint64, id uint64) (bool, error)
+	RevokeSessions(ctx context.Context, userID uint64, exceptID uint64) error
+	CreateRefreshToken(ctx context.Context, token entity.RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (entity.RefreshToken, error)
+	UseRefreshToken(ctx context.Context, id uint64) (bool, error)
+}
+
+type UsersRepository interface {
+	GetUser(ctx context.Context, id uint64) (entity.User, error)
+}
+
+type Transactor interface {
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type TokensService interface {
+	Issue(user entity.User, sessionID uint64) (entity.AccessToken, error)
+}
+
+type ErrorsService interface {
+	GetError(code int) error
+}
+
+type Service struct {
+	log           logger.Logger
+	cfg           Config
+	sessionsRepo  SessionsRepository
+	usersRepo     UsersRepository
+	transactor    Transactor
+	tokensService TokensService
+	errorsService ErrorsService
+}
+
+func New(
+	log logger.Logger,
+	cfg Config,
+	sessionsRepo SessionsRepository,
+	usersRepo UsersRepository,
+	transactor Transactor,
+	tokensService TokensService,
+	errorsService ErrorsService,
+) *Service {
+	return &Service{
+		log:           log,
+		cfg:           cfg,
+		sessionsRepo:  sessionsRepo,
+		usersRepo:     usersRepo,
+		transactor:    transactor,
+		tokensService: tokensService,
+		errorsService: errorsService,
+	}
+}
+
+// CreateSession starts a new session for a user whose credentials were verified.
+func (s *Service) CreateSession(ctx context.Context, user entity.User, device entity.Device) (entity.TokenPair, error) {
+	log := s.log.WithFields(logger.Fields{
+		"method": "CreateSession",
+	})
+
+	session, err := s.sessionsRepo.CreateSession(ctx, entity.Session{
+		UserID:    user.ID,
+		UserAgent: device.UserAgent,
+		IP:        device.IP,
+		ExpiresAt: time.Now().Add(s.cfg.RefreshTTL),
+	})
+	if err != nil {
+		log.Errorf("failed to create session: %v", err)
+
+		return entity.TokenPair{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	return s.issue(ctx, log, user, session.ID)
+}
+
+// Refresh exchanges a refresh token for a new token pair. Every refresh token can
+// be used once, presenting a used one again revokes the whole session since the
+// token has most likely been stolen.
+func (s *Service) Refresh(ctx context.Context, refreshToken string, device entity.Device) (entity.TokenPair, error) {
+	log := s.log.WithFields(logger.Fields{
+		"method": "Refresh",
+	})
+
+	token, err := s.sessionsRepo.GetRefreshToken(ctx, secret.Hash(refreshToken))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.TokenPair{}, s.errorsService.GetError(codes.InvalidRefreshToken)
+		}
+
+		log.Errorf("failed to get refresh token: %v", err)
+
+		return entity.TokenPair{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	session, err := s.sessionsRepo.GetSession(ctx, token.SessionID)
+	if err != nil {
+		log.Errorf("failed to get session: %v", err)
+
+		return entity.TokenPair{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	if !session.IsActive(time.Now()) {
+		return entity.TokenPair{}, s.errorsService.GetError(codes.InvalidRefreshToken)
+	}
+
+	var (
+		pair   entity.TokenPair
+		reused bool
+	)
+
+	// the token is used, the session extended and the new pair stored together or
+	// not at all
+	err = s.inTx(ctx, log, func(ctx context.Context) error {
+		unused, err := s.sessionsRepo.UseRefreshToken(ctx, token.ID)
+		if err != nil {
+			log.Errorf("failed to use refresh token: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		if !unused {
+			reused = true
+
+			return s.errorsService.GetError(codes.InvalidRefreshToken)
+		}
+
+		user, err := s.usersRepo.GetUser(ctx, session.UserID)
+		if err != nil {
+			// deleted users are not found
+			if errors.Is(err, pgx.ErrNoRows) {
+				return s.errorsService.GetError(codes.InvalidRefreshToken)
+			}
+
+			log.Errorf("failed to get user: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		if user.IsDeleted() {
+			return s.errorsService.GetError(codes.InvalidRefreshToken)
+		}
+
+		if err = s.sessionsRepo.TouchSession(ctx, session.ID, device, time.Now().Add(s.cfg.RefreshTTL)); err != nil {
+			log.Errorf("failed to touch session: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		pair, err = s.issue(ctx, log, user, session.ID)
+
+		return err
+	})
+
+	// revoked after the rollback, so that the revocation sticks
+	if reused {
+		log.Warnf("refresh token of session %d reused, revoking the session", session.ID)
+
+		if _, err = s.sessionsRepo.RevokeSession(ctx, session.UserID, session.ID); err != nil {
+			log.Errorf("failed to revoke session: %v", err)
+		}
+
+		return entity.TokenPair{}, s.errorsService.GetError(codes.InvalidRefreshToken)
+	}
+
+	if err != nil {
+		return entity.TokenPair{}, err
+	}
+
+	return pair, nil
+}
+
+func (s *Service) GetSessions(ctx context.Context, userID uint64) ([]entity.Session, error) {
+	log := s.log.WithFields(logger.Fields{
+		"method": "GetSessions",
+	})
+
+	sessions, err := s.sessionsRepo.GetSessions(ctx, userID)
+	if err != nil {
+		log.Errorf("failed to get sessions: %v", err)
+
+		return nil, s.errorsService.GetError(codes.InternalError)
+	}
+
+	return sessions, nil
+}
+
+func (s *Service) RevokeSession(ctx context.Context, userID uint64, id uint64) error {
+	log := s.log.WithFields(logger.Fields{
+		"method": "RevokeSession",
+	})
+
+	revoked, err := s.sessionsRepo.RevokeSession(ctx, userID, id)
+	if err != nil {
+		log.Errorf("failed to revoke session: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
+
+	if !revoked {
+		return s.errorsService.GetError(codes.SessionNotFound)
+	}
+
+	return nil
+}
+
+// RevokeSessions revokes every session of the user, including the current one.
+func (s *Service) RevokeSessions(ctx context.Context, userID uint64) error {
+	log := s.log.WithFields(logger.Fields{
+		"method": "RevokeSessions",
+	})
+
+	if err := s.sessionsRepo.RevokeSessions(ctx, userID, 0); err != nil {
+		log.Errorf("failed to revoke sessions: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
+
+	return nil
+}
+
+// inTx runs fn in a transaction. Errors of fn are returned as they are, failures
+// of the transaction itself as an internal error.
+func (s *Service) inTx(ctx context.Context, log logger.Logger, fn func(ctx context.Context) error) error {
+	err := s.transactor.WithTx(ctx, fn)
+
+	var ce *cerrors.Error
+
+	if err != nil && !errors.As(err, &ce) {
+		log.Errorf("failed to run transaction: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
+
+	return err
+}
+
+func (s *Service) issue(ctx context.Context, log logger.Logger, user entity.User, sessionID uint64) (entity.TokenPair, error) {
+	refreshToken, hash, err := secret.New()
+	if err != nil {
+		log.Errorf("failed to generate refresh token: %v", err)
+
+		return entity.TokenPair{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	if err = s.sessionsRepo.CreateRefreshToken(ctx, entity.RefreshToken{
+		SessionID: sessionID,
+		TokenHash: hash,
+	}); err != nil {
+		log.Errorf("failed to create refresh token: %v", err)
+
+		return entity.TokenPair{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	accessToken, err := s.tokensService.Issue(user, sessionID)
+	if err != nil {
+		log.Errorf("failed to issue access token: %v", err)
+
+		return entity.TokenPair{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	return entity.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
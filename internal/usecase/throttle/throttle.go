@@ -0,0 +1,322 @@
+package throttle
+
+import (
+	"context"
+	"time"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/pkg/codes"
+)
+
+const (
+	StorePostgres = "postgres"
+	StoreMemory   = "memory"
+)
+
+type Config struct {
+	Store               string        `env:"THROTTLE_STORE" env-default:"postgres"`
+	Window              time.Duration `env:"THROTTLE_WINDOW" env-default:"15m"`
+	BaseDelay           time.Duration `env:"THROTTLE_BASE_DELAY" env-default:"1s"`
+	MaxDelay            time.Duration `env:"THROTTLE_MAX_DELAY" env-default:"1m"`
+	LockoutDuration     time.Duration `env:"THROTTLE_LOCKOUT_DURATION" env-default:"15m"`
+	AccountDelayAfter   int           `env:"THROTTLE_ACCOUNT_DELAY_AFTER" env-default:"3"`
+	AccountLockoutAfter int           `env:"THROTTLE_ACCOUNT_LOCKOUT_AFTER" env-default:"10"`
+	IPDelayAfter        int           `env:"THROTTLE_IP_DELAY_AFTER" env-default:"10"`
+	IPLockoutAfter      int           `env:"THROTTLE_IP_LOCKOUT_AFTER" env-default:"100"`
+	MFADelayAfter       int           `env:"THROTTLE_MFA_DELAY_AFTER" env-default:"3"`
+	MFALockoutAfter     int           `env:"THROTTLE_MFA_LOCKOUT_AFTER" env-default:"10"`
+	// a login challenge is burned after this many wrong second factors
+	ChallengeAttempts int `env:"THROTTLE_CHALLENGE_ATTEMPTS" env-default:"5"`
+}
+
+type Store interface {
+	GetAttempts(ctx context.Context, key string) (entity.LoginAttempts, error)
+	Reserve(ctx context.Context, key string, now time.Time, window time.Duration) (entity.LoginAttempts, error)
+	Release(ctx context.Context, key string) error
+	Lock(ctx context.Context, key string, now time.Time, until time.Time) (bool, error)
+	ResetAttempts(ctx context.Context, key string) error
+}
+
+type ErrorsService interface {
+	GetError(code int) error
+}
+
+type limits struct {
+	delayAfter   int
+	lockoutAfter int
+	// lockedUntil ends the lockout, LockoutDuration after the last failure when zero.
+	// A key locked until a fixed time is used up after lockoutAfter attempts.
+	lockedUntil time.Time
+	// refusal is the error code of a refused attempt
+	refusal int
+}
+
+// Service throttles password checks per account and per client IP, and second
+// factors per account and login challenge. After a number
+// of failures every further attempt has to wait twice as long as the previous one,
+// after more failures the key is locked out for a while.
+//
+// Every attempt is reserved before the credentials are checked and counts as a
+// failure until it succeeds, so that concurrent attempts can't pass on the same
+// count. Refused attempts count as well.
+type Service struct {
+	log           logger.Logger
+	cfg           Config
+	store         Store
+	errorsService ErrorsService
+}
+
+func New(log logger.Logger, cfg Config, store Store, errorsService ErrorsService) *Service {
+	return &Service{
+		log:           log,
+		cfg:           cfg,
+		store:         store,
+		errorsService: errorsService,
+	}
+}
+
+// Check reserves an attempt for the account and the IP and fails with
+// codes.TooManyAttempts while either has to wait. A zero userID or an empty ip
+// skips that key.
+func (s *Service) Check(ctx context.Context, userID uint64, ip string) error {
+	return s.reserve(ctx, "Check", s.keys(userID, ip))
+}
+
+// Fail keeps the reserved attempt as a failure and locks out the keys that reached
+// their limit.
+func (s *Service) Fail(ctx context.Context, userID uint64, ip string) error {
+	return s.fail(ctx, "Fail", s.keys(userID, ip))
+}
+
+// Succeed forgets the failures of the account and takes back the attempt of the IP.
+// The earlier failures of the IP stay, so that logging into an own account doesn't
+// clear an attacker's record.
+func (s *Service) Succeed(ctx context.Context, userID uint64, ip string) error {
+	log := s.log.WithFields(logger.Fields{
+		"method": "Succeed",
+	})
+
+	if ip != "" {
+		if err := s.store.Release(ctx, entity.IPAttemptsKey(ip)); err != nil {
+			log.Errorf("failed to release attempt: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+	}
+
+	return s.unlock(ctx, "Succeed", entity.AccountAttemptsKey(userID))
+}
+
+// CheckMFA reserves an attempt for the account and the challenge. It fails with
+// codes.TooManyAttempts while the account has to wait for its next second factor
+// and with codes.InvalidMFAToken once the challenge is burned. The second factors
+// are counted apart from the passwords, so that passing the password step again
+// doesn't clear them.
+func (s *Service) CheckMFA(ctx context.Context, challenge entity.MFAChallenge) error {
+	return s.reserve(ctx, "CheckMFA", s.mfaKeys(challenge))
+}
+
+// FailMFA keeps the reserved attempt as a wrong second factor, the challenge is
+// burned once it reaches ChallengeAttempts.
+func (s *Service) FailMFA(ctx context.Context, challenge entity.MFAChallenge) error {
+	return s.fail(ctx, "FailMFA", s.mfaKeys(challenge))
+}
+
+// SucceedMFA forgets the second factor failures of the account and burns the
+// challenge, so that it can't complete another login. Of concurrent attempts with
+// the same challenge only the one that burns it succeeds.
+func (s *Service) SucceedMFA(ctx context.Context, challenge entity.MFAChallenge) error {
+	log := s.log.WithFields(logger.Fields{
+		"method": "SucceedMFA",
+	})
+
+	burned, err := s.store.Lock(ctx, entity.ChallengeAttemptsKey(challenge.ID), time.Now().UTC(), challenge.ExpiresAt)
+	if err != nil {
+		log.Errorf("failed to lock: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
+
+	if !burned {
+		log.Warnf("challenge of user %d was passed already", challenge.UserID)
+
+		return s.errorsService.GetError(codes.InvalidMFAToken)
+	}
+
+	return s.unlock(ctx, "SucceedMFA", entity.MFAAttemptsKey(challenge.UserID))
+}
+
+func (s *Service) UnlockUser(ctx context.Context, userID uint64) error {
+	if err := s.unlock(ctx, "UnlockUser", entity.MFAAttemptsKey(userID)); err != nil {
+		return err
+	}
+
+	return s.unlock(ctx, "UnlockUser", entity.AccountAttemptsKey(userID))
+}
+
+func (s *Service) UnlockIP(ctx context.Context, ip string) error {
+	return s.unlock(ctx, "UnlockIP", entity.IPAttemptsKey(ip))
+}
+
+// reserve counts the attempt for every key and refuses it if any key has to wait.
+// All keys are reserved before deciding, so that a refused attempt counts the same
+// everywhere.
+func (s *Service) reserve(ctx context.Context, method string, keys map[string]limits) error {
+	log := s.log.WithFields(logger.Fields{
+		"method": method,
+	})
+
+	now := time.Now().UTC()
+	refusal := 0
+
+	for key, limits := range keys {
+		attempts, err := s.store.Reserve(ctx, key, now, s.cfg.Window)
+		if err != nil {
+			log.Errorf("failed to reserve attempt: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		if !s.refused(attempts, limits, now) {
+			continue
+		}
+
+		log.Warnf("throttled attempt for %s", key)
+
+		// a burned challenge outweighs a delay
+		if refusal == 0 || limits.refusal != codes.TooManyAttempts {
+			refusal = limits.refusal
+		}
+	}
+
+	if refusal != 0 {
+		return s.errorsService.GetError(refusal)
+	}
+
+	return nil
+}
+
+// refused reports whether the reserved attempt has to be refused. It is decided on
+// the failures before it, which no concurrent attempt shares.
+func (s *Service) refused(attempts entity.LoginAttempts, limits limits, now time.Time) bool {
+	if attempts.IsLocked(now) {
+		return true
+	}
+
+	previous := attempts.Failures - 1
+
+	if !limits.lockedUntil.IsZero() && previous >= limits.lockoutAfter {
+		return true
+	}
+
+	return attempts.PreviousFailureAt != nil && now.Before(s.retryAt(previous, *attempts.PreviousFailureAt, limits))
+}
+
+func (s *Service) fail(ctx context.Context, method string, keys map[string]limits) error {
+	log := s.log.WithFields(logger.Fields{
+		"method": method,
+	})
+
+	now := time.Now().UTC()
+
+	for key, limits := range keys {
+		attempts, err := s.store.GetAttempts(ctx, key)
+		if err != nil {
+			log.Errorf("failed to get attempts: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		if attempts.Failures < limits.lockoutAfter || attempts.IsLocked(now) {
+			continue
+		}
+
+		until := limits.lockedUntil
+		if until.IsZero() {
+			until = now.Add(s.cfg.LockoutDuration)
+		}
+
+		locked, err := s.store.Lock(ctx, key, now, until)
+		if err != nil {
+			log.Errorf("failed to lock: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		if locked {
+			log.Warnf("locked out %s after %d failures", key, attempts.Failures)
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) unlock(ctx context.Context, method string, key string) error {
+	log := s.log.WithFields(logger.Fields{
+		"method": method,
+	})
+
+	if err := s.store.ResetAttempts(ctx, key); err != nil {
+		log.Errorf("failed to reset attempts: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
+
+	return nil
+}
+
+func (s *Service) keys(userID uint64, ip string) map[string]limits {
+	keys := make(map[string]limits, 2)
+
+	if userID != 0 {
+		keys[entity.AccountAttemptsKey(userID)] = limits{
+			delayAfter:   s.cfg.AccountDelayAfter,
+			lockoutAfter: s.cfg.AccountLockoutAfter,
+			refusal:      codes.TooManyAttempts,
+		}
+	}
+
+	if ip != "" {
+		keys[entity.IPAttemptsKey(ip)] = limits{
+			delayAfter:   s.cfg.IPDelayAfter,
+			lockoutAfter: s.cfg.IPLockoutAfter,
+			refusal:      codes.TooManyAttempts,
+		}
+	}
+
+	return keys
+}
+
+func (s *Service) mfaKeys(challenge entity.MFAChallenge) map[string]limits {
+	return map[string]limits{
+		entity.MFAAttemptsKey(challenge.UserID): {
+			delayAfter:   s.cfg.MFADelayAfter,
+			lockoutAfter: s.cfg.MFALockoutAfter,
+			refusal:      codes.TooManyAttempts,
+		},
+		entity.ChallengeAttemptsKey(challenge.ID): {
+			delayAfter:   s.cfg.ChallengeAttempts,
+			lockoutAfter: s.cfg.ChallengeAttempts,
+			lockedUntil:  challenge.ExpiresAt,
+			refusal:      codes.InvalidMFAToken,
+		},
+	}
+}
+
+// retryAt returns when the attempt after the given failures is allowed: the delay
+// runs from the last of them and doubles with every failure past delayAfter, up to
+// MaxDelay.
+func (s *Service) retryAt(failures int, lastFailureAt time.Time, limits limits) time.Time {
+	if failures < limits.delayAfter {
+		return time.Time{}
+	}
+
+	delay := s.cfg.BaseDelay
+
+	for i := limits.delayAfter; i < failures && delay < s.cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return lastFailureAt.Add(min(delay, s.cfg.MaxDelay))
+}
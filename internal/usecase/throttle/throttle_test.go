@@ -0,0 +1,265 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo/attempts"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo/repotest"
+	cerrors "github.com/0x16F/cloud-users/internal/usecase/errors"
+	"github.com/0x16F/cloud-users/pkg/codes"
+)
+
+const (
+	userID = 1
+	ip     = "192.0.2.1"
+)
+
+// testConfig delays the account after 3 failures long enough that no test sees the
+// delay run out, and locks it after 5. The IP is never throttled.
+var testConfig = Config{
+	Window:              time.Hour,
+	BaseDelay:           time.Hour,
+	MaxDelay:            time.Hour,
+	LockoutDuration:     time.Hour,
+	AccountDelayAfter:   3,
+	AccountLockoutAfter: 5,
+	IPDelayAfter:        1000,
+	IPLockoutAfter:      1000,
+}
+
+func newService(t *testing.T, cfg Config, store Store) *Service {
+	t.Helper()
+
+	log := logger.New("error")
+
+	errorsService, err := cerrors.New(log, "", "en")
+	if err != nil {
+		t.Fatalf("failed to load errors: %v", err)
+	}
+
+	return New(log, cfg, store, errorsService)
+}
+
+// assertCode fails the test unless err has the code, or is nil for a zero code.
+func assertCode(t *testing.T, err error, code int) {
+	t.Helper()
+
+	var ce *cerrors.Error
+
+	switch {
+	case code == 0 && err != nil:
+		t.Errorf("got %v, want no error", err)
+	case code != 0 && (!errors.As(err, &ce) || ce.Code != code):
+		t.Errorf("got %v, want code %d", err, code)
+	}
+}
+
+// failLogins checks and fails the given number of logins, which all have to pass
+// the check.
+func failLogins(t *testing.T, s *Service, count int) {
+	t.Helper()
+
+	for i := range count {
+		if err := s.Check(context.Background(), userID, ip); err != nil {
+			t.Fatalf("attempt %d: got %v, want it allowed", i+1, err)
+		}
+
+		if err := s.Fail(context.Background(), userID, ip); err != nil {
+			t.Fatalf("failed to fail attempt %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestRetryAt(t *testing.T) {
+	s := newService(t, Config{BaseDelay: time.Second, MaxDelay: 10 * time.Second}, attempts.NewMemory())
+
+	last := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	limits := limits{delayAfter: 3}
+
+	tests := []struct {
+		failures int
+		want     time.Time
+	}{
+		{failures: 0, want: time.Time{}},
+		{failures: 2, want: time.Time{}},
+		{failures: 3, want: last.Add(time.Second)},
+		{failures: 4, want: last.Add(2 * time.Second)},
+		{failures: 5, want: last.Add(4 * time.Second)},
+		{failures: 6, want: last.Add(8 * time.Second)},
+		{failures: 7, want: last.Add(10 * time.Second)},
+		{failures: 100, want: last.Add(10 * time.Second)},
+	}
+
+	for _, tt := range tests {
+		if got := s.retryAt(tt.failures, last, limits); !got.Equal(tt.want) {
+			t.Errorf("got %v after %d failures, want %v", got, tt.failures, tt.want)
+		}
+	}
+}
+
+func TestDelay(t *testing.T) {
+	ctx := context.Background()
+
+	s := newService(t, testConfig, attempts.NewMemory())
+
+	failLogins(t, s, testConfig.AccountDelayAfter)
+
+	assertCode(t, s.Check(ctx, userID, ip), codes.TooManyAttempts)
+
+	// the delay is the account's, another account from the same IP may try
+	assertCode(t, s.Check(ctx, userID+1, ip), 0)
+}
+
+func TestLockout(t *testing.T) {
+	ctx := context.Background()
+
+	// without a delay only the lockout refuses attempts
+	cfg := testConfig
+	cfg.BaseDelay, cfg.MaxDelay = 0, 0
+
+	store := attempts.NewMemory()
+	s := newService(t, cfg, store)
+
+	failLogins(t, s, cfg.AccountLockoutAfter)
+
+	before := time.Now().UTC()
+
+	assertCode(t, s.Check(ctx, userID, ip), codes.TooManyAttempts)
+
+	account, err := store.GetAttempts(ctx, entity.AccountAttemptsKey(userID))
+	if err != nil {
+		t.Fatalf("failed to get attempts: %v", err)
+	}
+
+	if !account.IsLocked(before.Add(cfg.LockoutDuration - time.Minute)) {
+		t.Errorf("got the account locked until %v, want about %v", account.LockedUntil, before.Add(cfg.LockoutDuration))
+	}
+
+	// an admin lifts the lockout
+	if err = s.UnlockUser(ctx, userID); err != nil {
+		t.Fatalf("failed to unlock: %v", err)
+	}
+
+	assertCode(t, s.Check(ctx, userID, ip), 0)
+}
+
+func TestSucceed(t *testing.T) {
+	ctx := context.Background()
+
+	store := attempts.NewMemory()
+	s := newService(t, testConfig, store)
+
+	failLogins(t, s, testConfig.AccountDelayAfter-1)
+
+	if err := s.Check(ctx, userID, ip); err != nil {
+		t.Fatalf("got %v, want the attempt allowed", err)
+	}
+
+	if err := s.Succeed(ctx, userID, ip); err != nil {
+		t.Fatalf("failed to succeed: %v", err)
+	}
+
+	account, err := store.GetAttempts(ctx, entity.AccountAttemptsKey(userID))
+	if err != nil {
+		t.Fatalf("failed to get attempts: %v", err)
+	}
+
+	// the IP keeps its failures, only the successful attempt is taken back
+	address, err := store.GetAttempts(ctx, entity.IPAttemptsKey(ip))
+	if err != nil {
+		t.Fatalf("failed to get attempts: %v", err)
+	}
+
+	if account.Failures != 0 || address.Failures != testConfig.AccountDelayAfter-1 {
+		t.Errorf("got %d failures of the account and %d of the IP, want 0 and %d",
+			account.Failures, address.Failures, testConfig.AccountDelayAfter-1)
+	}
+}
+
+// TestConcurrentFailures checks and fails logins from concurrent requests. Every
+// attempt has to count, and only as many as the delay allows may pass the check.
+func TestConcurrentFailures(t *testing.T) {
+	const racers = 20
+
+	stores := map[string]func(t *testing.T) Store{
+		repo.DriverMemory: func(t *testing.T) Store {
+			return attempts.NewMemory()
+		},
+		repo.DriverSQLite: func(t *testing.T) Store {
+			return attempts.NewRepo(repotest.SQLite(t))
+		},
+		repo.DriverPostgres: func(t *testing.T) Store {
+			return attempts.NewRepo(repotest.Postgres(t))
+		},
+	}
+
+	for driver, newStore := range stores {
+		t.Run(driver, func(t *testing.T) {
+			ctx := context.Background()
+
+			store := newStore(t)
+			s := newService(t, testConfig, store)
+
+			var (
+				wg     sync.WaitGroup
+				start  = make(chan struct{})
+				passed = make([]bool, racers)
+			)
+
+			for i := range racers {
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+
+					<-start
+
+					if err := s.Check(ctx, userID, ip); err != nil {
+						assertCode(t, err, codes.TooManyAttempts)
+
+						return
+					}
+
+					passed[i] = true
+
+					if err := s.Fail(ctx, userID, ip); err != nil {
+						t.Errorf("failed to fail attempt: %v", err)
+					}
+				}()
+			}
+
+			close(start)
+			wg.Wait()
+
+			allowed := 0
+
+			for _, ok := range passed {
+				if ok {
+					allowed++
+				}
+			}
+
+			if allowed != testConfig.AccountDelayAfter {
+				t.Errorf("got %d attempts allowed, want %d", allowed, testConfig.AccountDelayAfter)
+			}
+
+			for _, key := range []string{entity.AccountAttemptsKey(userID), entity.IPAttemptsKey(ip)} {
+				counted, err := store.GetAttempts(ctx, key)
+				if err != nil {
+					t.Fatalf("failed to get attempts: %v", err)
+				}
+
+				if counted.Failures != racers {
+					t.Errorf("got %d failures of %s, want %d", counted.Failures, key, racers)
+				}
+			}
+		})
+	}
+}
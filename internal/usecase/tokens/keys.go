@@ -0,0 +1,209 @@
+package tokens
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+const (
+	rsaKeyBits = 2048
+	keyFileExt = ".pem"
+	keyIDBytes = 16
+)
+
+var (
+	ErrUnsupportedKey = errors.New("unsupported signing key")
+)
+
+type signingKey struct {
+	id        string
+	signer    crypto.Signer
+	method    jwt.SigningMethod
+	createdAt time.Time
+}
+
+func newSigningKey(id string, signer crypto.Signer, createdAt time.Time) (signingKey, error) {
+	key := signingKey{
+		id:        id,
+		signer:    signer,
+		createdAt: createdAt,
+	}
+
+	switch signer.(type) {
+	case *rsa.PrivateKey:
+		key.method = jwt.SigningMethodRS256
+	case ed25519.PrivateKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return signingKey{}, ErrUnsupportedKey
+	}
+
+	return key, nil
+}
+
+// generateKey creates a key for the configured algorithm with a random ID, so that
+// instances rotating at the same time don't name their keys alike.
+func generateKey(algorithm string, now time.Time) (signingKey, error) {
+	var (
+		signer crypto.Signer
+		err    error
+	)
+
+	switch algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		signer, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case jwt.SigningMethodEdDSA.Alg():
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return signingKey{}, errors.Wrapf(ErrUnsupportedKey, "algorithm %q", algorithm)
+	}
+
+	if err != nil {
+		return signingKey{}, errors.Wrap(err, "failed to generate key")
+	}
+
+	id := make([]byte, keyIDBytes)
+
+	if _, err = rand.Read(id); err != nil {
+		return signingKey{}, errors.Wrap(err, "failed to generate key id")
+	}
+
+	return newSigningKey(hex.EncodeToString(id), signer, now)
+}
+
+// loadKeys reads PEM encoded private keys from a single file or from every
+// *.pem file of a directory. The file name without extension is used as key ID
+// and the modification time as creation time.
+func loadKeys(path string) ([]signingKey, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to stat keys path")
+	}
+
+	files := []string{path}
+
+	if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(path, "*"+keyFileExt)); err != nil {
+			return nil, errors.Wrap(err, "failed to list keys")
+		}
+	}
+
+	keys := make([]signingKey, 0, len(files))
+
+	for _, file := range files {
+		key, err := loadKey(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load key %s", file)
+		}
+
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].createdAt.Before(keys[j].createdAt)
+	})
+
+	return keys, nil
+}
+
+func loadKey(file string) (signingKey, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return signingKey{}, errors.New("no PEM block found")
+	}
+
+	var parsed any
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return signingKey{}, errors.Wrapf(ErrUnsupportedKey, "PEM block %q", block.Type)
+	}
+
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return signingKey{}, ErrUnsupportedKey
+	}
+
+	id := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+
+	return newSigningKey(id, signer, info.ModTime())
+}
+
+func saveKey(dir string, key signingKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.signer)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal key")
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	})
+
+	// never replace a key that another instance may already sign with
+	file, err := os.OpenFile(keyFile(dir, key), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "failed to create key file")
+	}
+
+	if _, err = file.Write(data); err != nil {
+		_ = file.Close()
+
+		return errors.Wrap(err, "failed to write key")
+	}
+
+	if err = file.Close(); err != nil {
+		return errors.Wrap(err, "failed to write key")
+	}
+
+	// loadKeys takes the modification time for the creation time
+	if err = os.Chtimes(keyFile(dir, key), key.createdAt, key.createdAt); err != nil {
+		return errors.Wrap(err, "failed to set key creation time")
+	}
+
+	return nil
+}
+
+// deleteKey removes the file of a key. Other instances may have removed it already.
+func deleteKey(dir string, key signingKey) error {
+	if err := os.Remove(keyFile(dir, key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrap(err, "failed to delete key")
+	}
+
+	return nil
+}
+
+func keyFile(dir string, key signingKey) string {
+	return filepath.Join(dir, key.id+keyFileExt)
+}
@@ -0,0 +1,356 @@
+package tokens
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/pkg/secret"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+const (
+	purposeMFA = "mfa"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+type Config struct {
+	Issuer         string        `env:"JWT_ISSUER" env-default:"cloud-users"`
+	Algorithm      string        `env:"JWT_ALGORITHM" env-default:"EdDSA"`
+	AccessTTL      time.Duration `env:"JWT_ACCESS_TTL" env-default:"15m"`
+	KeysPath       string        `env:"JWT_KEYS_PATH"`
+	RotationPeriod time.Duration `env:"JWT_ROTATION_PERIOD" env-default:"24h"`
+	ChallengeTTL   time.Duration `env:"JWT_CHALLENGE_TTL" env-default:"5m"`
+}
+
+type Claims struct {
+	jwt.RegisteredClaims
+	SessionID uint64 `json:"sid,omitempty"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	// EmailVerified reflects the user at the time the token was issued.
+	EmailVerified bool `json:"email_verified"`
+	// Purpose is set for tokens that only prove a step of a flow, such as the
+	// password step of a two-factor login, and can't be used as access tokens.
+	Purpose string `json:"purpose,omitempty"`
+}
+
+type Service struct {
+	log    logger.Logger
+	cfg    Config
+	mu     sync.RWMutex
+	keys   []signingKey
+	cancel context.CancelFunc
+}
+
+// New loads the signing keys and starts rotating them. A single key file is used
+// as is and never rotated. Keys of a key directory are rotated and new keys are
+// written into it, so that restarts and other instances pick them up. Without
+// JWT_KEYS_PATH the keys are generated and kept in memory.
+func New(log logger.Logger, cfg Config) (*Service, error) {
+	log = log.WithFields(logger.Fields{
+		"module": "tokens",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	service := &Service{
+		log:    log,
+		cfg:    cfg,
+		cancel: cancel,
+	}
+
+	if cfg.KeysPath != "" {
+		info, err := os.Stat(cfg.KeysPath)
+		if err != nil {
+			cancel()
+
+			return nil, errors.Wrap(err, "failed to stat keys path")
+		}
+
+		if !info.IsDir() {
+			service.cfg.RotationPeriod = 0
+		}
+	}
+
+	if err := service.rotate(time.Now()); err != nil {
+		cancel()
+
+		return nil, err
+	}
+
+	if service.cfg.RotationPeriod > 0 {
+		go service.run(ctx)
+	}
+
+	return service, nil
+}
+
+func (s *Service) Close() {
+	s.cancel()
+}
+
+// Issue creates a signed access token for the user's session.
+func (s *Service) Issue(user entity.User, sessionID uint64) (entity.AccessToken, error) {
+	return s.sign(user, sessionID, "", "", s.cfg.AccessTTL)
+}
+
+// IssueChallenge creates a short-lived token proving that the user passed the
+// password step of a login that still requires a second factor. Its ID lets the
+// failed attempts be counted per challenge.
+func (s *Service) IssueChallenge(user entity.User) (entity.AccessToken, error) {
+	id, _, err := secret.New()
+	if err != nil {
+		return entity.AccessToken{}, errors.Wrap(err, "failed to generate challenge id")
+	}
+
+	return s.sign(user, 0, id, purposeMFA, s.cfg.ChallengeTTL)
+}
+
+// Parse verifies the access token against the published keys and returns its claims.
+func (s *Service) Parse(token string) (entity.UserData, error) {
+	claims, id, err := s.parse(token)
+	if err != nil {
+		return entity.UserData{}, err
+	}
+
+	if claims.Purpose != "" {
+		return entity.UserData{}, errors.Wrap(ErrInvalidToken, "not an access token")
+	}
+
+	return entity.UserData{
+		ID:            id,
+		SessionID:     claims.SessionID,
+		Login:         claims.Username,
+		Role:          claims.Role,
+		EmailVerified: claims.EmailVerified,
+	}, nil
+}
+
+// ParseChallenge verifies a token created by IssueChallenge.
+func (s *Service) ParseChallenge(token string) (entity.MFAChallenge, error) {
+	claims, id, err := s.parse(token)
+	if err != nil {
+		return entity.MFAChallenge{}, err
+	}
+
+	if claims.Purpose != purposeMFA || claims.ID == "" {
+		return entity.MFAChallenge{}, errors.Wrap(ErrInvalidToken, "not a challenge token")
+	}
+
+	return entity.MFAChallenge{
+		ID:        claims.ID,
+		UserID:    id,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
+
+func (s *Service) sign(
+	user entity.User,
+	sessionID uint64,
+	id string,
+	purpose string,
+	ttl time.Duration,
+) (entity.AccessToken, error) {
+	now := time.Now()
+	key := s.activeKey(now)
+
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.cfg.Issuer,
+			Subject:   strconv.FormatUint(user.ID, 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			ID:        id,
+		},
+		SessionID:     sessionID,
+		Username:      user.Username,
+		Role:          user.Role,
+		EmailVerified: user.IsEmailVerified(),
+		Purpose:       purpose,
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+
+	signed, err := token.SignedString(key.signer)
+	if err != nil {
+		return entity.AccessToken{}, errors.Wrap(err, "failed to sign token")
+	}
+
+	return entity.AccessToken{
+		Token:     signed,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
+
+func (s *Service) parse(token string) (Claims, uint64, error) {
+	var claims Claims
+
+	_, err := jwt.ParseWithClaims(token, &claims, s.publicKey,
+		jwt.WithIssuer(s.cfg.Issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+	)
+	if err != nil {
+		return Claims{}, 0, errors.Wrap(ErrInvalidToken, err.Error())
+	}
+
+	id, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return Claims{}, 0, errors.Wrap(ErrInvalidToken, "invalid subject")
+	}
+
+	return claims, id, nil
+}
+
+// JWKS returns the public keys of every key that may still have valid tokens.
+func (s *Service) JWKS() JWKS {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jwks := JWKS{
+		Keys: make([]JWK, 0, len(s.keys)),
+	}
+
+	for _, key := range s.keys {
+		jwks.Keys = append(jwks.Keys, newJWK(key))
+	}
+
+	return jwks
+}
+
+func (s *Service) publicKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.keys {
+		if key.id == kid && key.method.Alg() == token.Method.Alg() {
+			return key.signer.Public(), nil
+		}
+	}
+
+	return nil, errors.New("unknown key id")
+}
+
+// activeKey returns the newest key that was published long enough to sign, or the
+// first key while none was.
+func (s *Service) activeKey(now time.Time) signingKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := len(s.keys) - 1; i > 0; i-- {
+		if !now.Before(s.signsFrom(s.keys[i])) {
+			return s.keys[i]
+		}
+	}
+
+	return s.keys[0]
+}
+
+// reloadInterval is how often every instance reloads the keys of the key directory.
+func (s *Service) reloadInterval() time.Duration {
+	return s.cfg.RotationPeriod / 10
+}
+
+// signsFrom returns when a key starts signing. A new key is only published in the
+// JWKS at first, for two reload intervals, so that every instance reloaded it at
+// least once whatever the phase of its ticker and accepts its tokens.
+func (s *Service) signsFrom(key signingKey) time.Time {
+	return key.createdAt.Add(2 * s.reloadInterval())
+}
+
+func (s *Service) run(ctx context.Context) {
+	ticker := time.NewTicker(s.reloadInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.rotate(now); err != nil {
+				s.log.Errorf("failed to rotate keys: %v", err)
+			}
+		}
+	}
+}
+
+// rotate reloads the keys, creates a new key once the newest one is older than the
+// rotation period and drops keys whose tokens have all expired, together with their
+// files. The new key signs from signsFrom on, until then the current one does.
+func (s *Service) rotate(now time.Time) error {
+	s.mu.RLock()
+	keys := append([]signingKey{}, s.keys...)
+	s.mu.RUnlock()
+
+	if s.cfg.KeysPath != "" {
+		loaded, err := loadKeys(s.cfg.KeysPath)
+		if err != nil {
+			return err
+		}
+
+		keys = loaded
+	}
+
+	outdated := len(keys) == 0 || (s.cfg.RotationPeriod > 0 && now.Sub(keys[len(keys)-1].createdAt) >= s.cfg.RotationPeriod)
+
+	if outdated {
+		key, err := generateKey(s.cfg.Algorithm, now)
+		if err != nil {
+			return err
+		}
+
+		if s.cfg.KeysPath != "" {
+			if err = saveKey(s.cfg.KeysPath, key); err != nil {
+				return err
+			}
+		}
+
+		keys = append(keys, key)
+	}
+
+	retained := s.retainKeys(keys, now)
+
+	s.mu.Lock()
+	s.keys = retained
+	s.mu.Unlock()
+
+	// a single key file is never rotated, only the keys of a directory expire.
+	// The dropped keys are the oldest ones.
+	if s.cfg.KeysPath == "" || s.cfg.RotationPeriod == 0 {
+		return nil
+	}
+
+	for _, key := range keys[:len(keys)-len(retained)] {
+		if err := deleteKey(s.cfg.KeysPath, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// retainKeys keeps the keys that sign or will, and every retired key that was
+// replaced less than one token lifetime ago.
+func (s *Service) retainKeys(keys []signingKey, now time.Time) []signingKey {
+	retained := make([]signingKey, 0, len(keys))
+
+	for i, key := range keys {
+		if i == len(keys)-1 || now.Sub(s.signsFrom(keys[i+1])) < s.cfg.AccessTTL {
+			retained = append(retained, key)
+		}
+	}
+
+	return retained
+}
@@ -0,0 +1,232 @@
+package tokens
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testConfig rotates every 10 hours, so a new key is published for 2 hours before
+// it signs, and the old one stays for 30 minutes after.
+var testConfig = Config{
+	Issuer:         "cloud-users",
+	Algorithm:      jwt.SigningMethodEdDSA.Alg(),
+	AccessTTL:      30 * time.Minute,
+	RotationPeriod: 10 * time.Hour,
+}
+
+// newTestService returns a service whose keys only rotate when the test calls
+// rotate.
+func newTestService(t *testing.T, cfg Config, now time.Time) *Service {
+	t.Helper()
+
+	s := &Service{
+		log:    logger.New("error"),
+		cfg:    cfg,
+		cancel: func() {},
+	}
+
+	if err := s.rotate(now); err != nil {
+		t.Fatalf("failed to rotate keys: %v", err)
+	}
+
+	return s
+}
+
+func jwksKeyIDs(s *Service) []string {
+	ids := make([]string, 0, len(s.JWKS().Keys))
+
+	for _, key := range s.JWKS().Keys {
+		ids = append(ids, key.KeyID)
+	}
+
+	return ids
+}
+
+// TestRotation rotates the keys of an instance over two rotation periods. A key is
+// published before it signs and stays published until the tokens it signed expire.
+func TestRotation(t *testing.T) {
+	steps := []struct {
+		at time.Duration
+		// the keys by the order they were created in
+		published []int
+		active    int
+	}{
+		{at: 0, published: []int{0}, active: 0},
+		{at: 9 * time.Hour, published: []int{0}, active: 0},
+		{at: 10 * time.Hour, published: []int{0, 1}, active: 0},
+		{at: 11*time.Hour + 59*time.Minute, published: []int{0, 1}, active: 0},
+		{at: 12 * time.Hour, published: []int{0, 1}, active: 1},
+		{at: 12*time.Hour + 29*time.Minute, published: []int{0, 1}, active: 1},
+		{at: 12*time.Hour + 30*time.Minute, published: []int{1}, active: 1},
+		{at: 20 * time.Hour, published: []int{1, 2}, active: 1},
+	}
+
+	tests := []struct {
+		name     string
+		keysPath func(t *testing.T) string
+	}{
+		{
+			name: "memory",
+			keysPath: func(t *testing.T) string {
+				return ""
+			},
+		},
+		{
+			name: "directory",
+			keysPath: func(t *testing.T) string {
+				return t.TempDir()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig
+			cfg.KeysPath = tt.keysPath(t)
+
+			start := time.Now().Truncate(time.Second)
+
+			s := newTestService(t, cfg, start)
+
+			var created []string
+
+			for _, step := range steps {
+				now := start.Add(step.at)
+
+				if err := s.rotate(now); err != nil {
+					t.Fatalf("failed to rotate keys at %v: %v", step.at, err)
+				}
+
+				published := jwksKeyIDs(s)
+
+				for _, id := range published {
+					if !slices.Contains(created, id) {
+						created = append(created, id)
+					}
+				}
+
+				want := make([]string, 0, len(step.published))
+
+				for _, i := range step.published {
+					if i < len(created) {
+						want = append(want, created[i])
+					}
+				}
+
+				if !slices.Equal(published, want) {
+					t.Errorf("at %v: got keys %v published, want %v", step.at, published, want)
+				}
+
+				if active := s.activeKey(now).id; step.active >= len(created) || active != created[step.active] {
+					t.Errorf("at %v: got key %s signing, want key %d of %v", step.at, active, step.active, created)
+				}
+
+				if cfg.KeysPath != "" {
+					if files := keyFiles(t, cfg.KeysPath); !slices.Equal(files, want) {
+						t.Errorf("at %v: got key files %v, want %v", step.at, files, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestSharedDirectory starts a second instance on the key directory of the first
+// one, it has to publish and sign with the same keys.
+func TestSharedDirectory(t *testing.T) {
+	cfg := testConfig
+	cfg.KeysPath = t.TempDir()
+
+	start := time.Now().Truncate(time.Second)
+	now := start.Add(11 * time.Hour)
+
+	first := newTestService(t, cfg, start)
+
+	if err := first.rotate(start.Add(10 * time.Hour)); err != nil {
+		t.Fatalf("failed to rotate keys: %v", err)
+	}
+
+	second := newTestService(t, cfg, now)
+
+	if err := first.rotate(now); err != nil {
+		t.Fatalf("failed to rotate keys: %v", err)
+	}
+
+	if a, b := jwksKeyIDs(first), jwksKeyIDs(second); len(a) != 2 || !slices.Equal(a, b) {
+		t.Errorf("got keys %v and %v published, want the same 2", a, b)
+	}
+
+	if a, b := first.activeKey(now).id, second.activeKey(now).id; a != b {
+		t.Errorf("got keys %s and %s signing, want the same", a, b)
+	}
+}
+
+// TestRetiredKeyTokens checks that the tokens of a replaced key are accepted until
+// the key is dropped.
+func TestRetiredKeyTokens(t *testing.T) {
+	start := time.Now()
+
+	s := newTestService(t, testConfig, start)
+
+	token, err := s.Issue(entity.User{ID: 1, Username: "alice"}, 1)
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+
+	if err = s.rotate(start.Add(10 * time.Hour)); err != nil {
+		t.Fatalf("failed to rotate keys: %v", err)
+	}
+
+	if _, err = s.Parse(token.Token); err != nil {
+		t.Errorf("got %v for a token of the replaced key, want it valid", err)
+	}
+
+	if err = s.rotate(start.Add(12*time.Hour + 30*time.Minute)); err != nil {
+		t.Fatalf("failed to rotate keys: %v", err)
+	}
+
+	if _, err = s.Parse(token.Token); err == nil {
+		t.Error("got a token of a dropped key accepted")
+	}
+}
+
+// keyFiles returns the key IDs of the files in dir, oldest first.
+func keyFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+keyFileExt))
+	if err != nil {
+		t.Fatalf("failed to list keys: %v", err)
+	}
+
+	slices.SortFunc(files, func(a, b string) int {
+		return modTime(t, a).Compare(modTime(t, b))
+	})
+
+	ids := make([]string, 0, len(files))
+
+	for _, file := range files {
+		ids = append(ids, strings.TrimSuffix(filepath.Base(file), keyFileExt))
+	}
+
+	return ids
+}
+
+func modTime(t *testing.T, file string) time.Time {
+	t.Helper()
+
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatalf("failed to stat key: %v", err)
+	}
+
+	return info.ModTime()
+}
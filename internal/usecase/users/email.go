@@ -0,0 +1,215 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/pkg/codes"
+	"github.com/0x16F/cloud-users/pkg/secret"
+	"github.com/jackc/pgx/v5"
+)
+
+// UpdateEmail stores the address as pending and mails a confirmation link to it.
+// The email only changes once the link is followed.
+func (s *Service) UpdateEmail(ctx context.Context, id uint64, email string) error {
+	log := s.log.WithFields(logger.Fields{
+		"method": "UpdateEmail",
+	})
+
+	email = entity.NormalizeEmail(email)
+
+	user, err := s.GetUser(ctx, id)
+	if err != nil {
+		log.Errorf("failed to get user: %v", err)
+
+		return err
+	}
+
+	var plain string
+
+	err = s.inTx(ctx, log, func(ctx context.Context) error {
+		// the address is held as long as the change token can confirm it
+		expiresAt := time.Now().Add(s.cfg.EmailChangeTTL)
+
+		if err := s.usersRepo.SetPendingEmail(ctx, id, email, expiresAt); err != nil {
+			if conflict := s.conflictError(err); conflict != nil {
+				return conflict
+			}
+
+			log.Errorf("failed to set pending email: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		if err := s.usersRepo.DeleteTokens(ctx, id, entity.TokenEmailChange); err != nil {
+			log.Errorf("failed to delete email change tokens: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		plain, err = s.issueToken(ctx, log, id, entity.TokenEmailChange, email, s.cfg.EmailChangeTTL)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.sendMail(log, entity.Mail{
+		To:      email,
+		Subject: "Confirm your new email",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nUse the link below to confirm %s as your new email address. It expires in %s.\n\n%s\n",
+			user.Username,
+			email,
+			s.cfg.EmailChangeTTL,
+			tokenURL(s.cfg.EmailChangeURL, plain),
+		),
+	})
+
+	return nil
+}
+
+// ConfirmEmailChange commits a pending email change and mails the previous address
+// a link to revert it.
+func (s *Service) ConfirmEmailChange(ctx context.Context, token string) error {
+	log := s.log.WithFields(logger.Fields{
+		"method": "ConfirmEmailChange",
+	})
+
+	var (
+		user        entity.User
+		changeToken entity.UserToken
+		plain       string
+	)
+
+	// the token stays valid if the change fails
+	err := s.inTx(ctx, log, func(ctx context.Context) error {
+		var err error
+
+		user, changeToken, err = s.useEmailToken(ctx, log, token, entity.TokenEmailChange)
+		if err != nil {
+			return err
+		}
+
+		confirmed, err := s.usersRepo.ConfirmEmail(ctx, user.ID, changeToken.Payload)
+		if err != nil {
+			if conflict := s.conflictError(err); conflict != nil {
+				return conflict
+			}
+
+			log.Errorf("failed to confirm email: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		if !confirmed {
+			return s.errorsService.GetError(codes.InvalidEmailChangeToken)
+		}
+
+		if err = s.usersRepo.DeleteTokens(ctx, user.ID, entity.TokenEmailChange); err != nil {
+			log.Errorf("failed to delete email change tokens: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		plain, err = s.issueToken(ctx, log, user.ID, entity.TokenEmailRevert, user.Email, s.cfg.EmailRevertTTL)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.sendMail(log, entity.Mail{
+		To:      user.Email,
+		Subject: "Your email was changed",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nThe email address of your account was changed to %s.\n\n"+
+				"If this wasn't you, use the link below within %s to restore this address. "+
+				"Your account will be locked until you reset your password.\n\n%s\n",
+			user.Username,
+			changeToken.Payload,
+			s.cfg.EmailRevertTTL,
+			tokenURL(s.cfg.EmailRevertURL, plain),
+		),
+	})
+
+	return nil
+}
+
+// RevertEmailChange restores the previous email, locks the user and revokes every
+// session. The user gets access back through a password reset.
+func (s *Service) RevertEmailChange(ctx context.Context, token string) error {
+	log := s.log.WithFields(logger.Fields{
+		"method": "RevertEmailChange",
+	})
+
+	return s.inTx(ctx, log, func(ctx context.Context) error {
+		user, revertToken, err := s.useEmailToken(ctx, log, token, entity.TokenEmailRevert)
+		if err != nil {
+			return err
+		}
+
+		if err = s.usersRepo.RevertEmail(ctx, user.ID, revertToken.Payload); err != nil {
+			if conflict := s.conflictError(err); conflict != nil {
+				return conflict
+			}
+
+			log.Errorf("failed to revert email: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		for _, purpose := range []string{entity.TokenEmailChange, entity.TokenEmailRevert} {
+			if err = s.usersRepo.DeleteTokens(ctx, user.ID, purpose); err != nil {
+				log.Errorf("failed to delete %s tokens: %v", purpose, err)
+
+				return s.errorsService.GetError(codes.InternalError)
+			}
+		}
+
+		if err = s.sessionsRepo.RevokeSessions(ctx, user.ID, 0); err != nil {
+			log.Errorf("failed to revoke sessions: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		return nil
+	})
+}
+
+func (s *Service) useEmailToken(
+	ctx context.Context,
+	log logger.Logger,
+	token string,
+	purpose string,
+) (entity.User, entity.UserToken, error) {
+	emailToken, err := s.usersRepo.UseToken(ctx, secret.Hash(token), purpose)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.User{}, entity.UserToken{}, s.errorsService.GetError(codes.InvalidEmailChangeToken)
+		}
+
+		log.Errorf("failed to use %s token: %v", purpose, err)
+
+		return entity.User{}, entity.UserToken{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	user, err := s.GetUser(ctx, emailToken.UserID)
+	if err != nil {
+		log.Errorf("failed to get user: %v", err)
+
+		return entity.User{}, entity.UserToken{}, err
+	}
+
+	if user.IsDeleted() {
+		return entity.User{}, entity.UserToken{}, s.errorsService.GetError(codes.InvalidEmailChangeToken)
+	}
+
+	return user, emailToken, nil
+}
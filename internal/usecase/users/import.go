@@ -0,0 +1,70 @@
+package users
+
+import (
+	"context"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/pkg/codes"
+)
+
+// ImportUsers creates users that come with password hashes from another system.
+// Every user is imported independently, failures are reported per user.
+func (s *Service) ImportUsers(ctx context.Context, dto entity.UsersImportDTO) ([]entity.UserImportResult, error) {
+	log := s.log.WithFields(logger.Fields{
+		"method": "ImportUsers",
+	})
+
+	results := make([]entity.UserImportResult, 0, len(dto.Users))
+
+	for _, user := range dto.Users {
+		result := entity.UserImportResult{
+			Email: user.Email,
+		}
+
+		id, err := s.importUser(ctx, log, dto.Hash, user)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, s.errorsService.GetError(codes.InternalError)
+			}
+
+			result.Error = err
+		}
+
+		result.ID = id
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func (s *Service) importUser(
+	ctx context.Context,
+	log logger.Logger,
+	cfg entity.PasswordHashConfig,
+	dto entity.UserImportDTO,
+) (uint64, error) {
+	hash, err := s.passwordsService.Normalize(cfg, dto.PasswordHash, dto.Salt)
+	if err != nil {
+		log.Warnf("failed to normalize password hash of %s: %v", dto.Email, err)
+
+		return 0, s.errorsService.GetError(codes.InvalidPasswordHash)
+	}
+
+	user, err := s.usersRepo.CreateUser(ctx, entity.User{
+		Email:    entity.NormalizeEmail(dto.Email),
+		Username: entity.NormalizeUsername(dto.Username),
+		Password: hash,
+	})
+	if err != nil {
+		if conflict := s.conflictError(err); conflict != nil {
+			return 0, conflict
+		}
+
+		log.Errorf("failed to create user: %v", err)
+
+		return 0, s.errorsService.GetError(codes.InternalError)
+	}
+
+	return user.ID, nil
+}
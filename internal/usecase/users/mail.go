@@ -0,0 +1,71 @@
+package users
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/pkg/codes"
+	"github.com/0x16F/cloud-users/pkg/secret"
+)
+
+const (
+	mailTimeout = 30 * time.Second
+
+	// tokenPlaceholder marks where the links of the config take the token
+	tokenPlaceholder = "{token}"
+)
+
+// issueToken stores the hash of a new single-use token and returns the token to mail.
+func (s *Service) issueToken(
+	ctx context.Context,
+	log logger.Logger,
+	userID uint64,
+	purpose string,
+	payload string,
+	ttl time.Duration,
+) (string, error) {
+	plain, hash, err := secret.New()
+	if err != nil {
+		log.Errorf("failed to generate %s token: %v", purpose, err)
+
+		return "", s.errorsService.GetError(codes.InternalError)
+	}
+
+	err = s.usersRepo.CreateToken(ctx, entity.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		Payload:   payload,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		log.Errorf("failed to create %s token: %v", purpose, err)
+
+		return "", s.errorsService.GetError(codes.InternalError)
+	}
+
+	return plain, nil
+}
+
+// tokenURL puts the token into the placeholder of a link from the config. The link
+// is never used as a format string, a stray % in it would garble the mail.
+func tokenURL(link string, token string) string {
+	return strings.ReplaceAll(link, tokenPlaceholder, url.QueryEscape(token))
+}
+
+// sendMail delivers the mail without blocking the request. Delivery failures are
+// only logged.
+func (s *Service) sendMail(log logger.Logger, mail entity.Mail) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+
+		if err := s.mailer.Send(ctx, mail); err != nil {
+			log.Errorf("failed to send mail: %v", err)
+		}
+	}()
+}
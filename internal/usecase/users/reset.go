@@ -0,0 +1,133 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/pkg/codes"
+	"github.com/0x16F/cloud-users/pkg/secret"
+	"github.com/jackc/pgx/v5"
+)
+
+// RequestPasswordReset mails a single-use reset link to the owner of the email. It
+// succeeds for unknown emails as well and sends the mail in the background, so
+// neither the response nor its timing reveals whether the account exists.
+func (s *Service) RequestPasswordReset(ctx context.Context, email string) error {
+	log := s.log.WithFields(logger.Fields{
+		"method": "RequestPasswordReset",
+	})
+
+	user, err := s.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, s.errorsService.GetError(codes.UserNotFound)) {
+			return nil
+		}
+
+		log.Errorf("failed to get user by email: %v", err)
+
+		return err
+	}
+
+	if user.IsDeleted() {
+		return nil
+	}
+
+	plain, err := s.issueToken(ctx, log, user.ID, entity.TokenPasswordReset, "", s.cfg.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	s.sendMail(log, entity.Mail{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nUse the link below to choose a new password. It expires in %s.\n\n%s\n\n"+
+				"If you did not request a password reset, you can ignore this email.\n",
+			user.Username,
+			s.cfg.PasswordResetTTL,
+			tokenURL(s.cfg.PasswordResetURL, plain),
+		),
+	})
+
+	return nil
+}
+
+// ResetPassword sets a new password with a reset token and unlocks the user. All
+// outstanding reset tokens of the user are invalidated and every session is revoked.
+func (s *Service) ResetPassword(ctx context.Context, token string, password string) error {
+	log := s.log.WithFields(logger.Fields{
+		"method": "ResetPassword",
+	})
+
+	// the token is only used once the password passed the policy, so that a rejected
+	// password doesn't cost the user the link
+	resetToken, err := s.usersRepo.GetToken(ctx, secret.Hash(token), entity.TokenPasswordReset)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s.errorsService.GetError(codes.InvalidResetToken)
+		}
+
+		log.Errorf("failed to get reset token: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
+
+	user, err := s.GetUser(ctx, resetToken.UserID)
+	if err != nil {
+		log.Errorf("failed to get user: %v", err)
+
+		return err
+	}
+
+	if user.IsDeleted() {
+		return s.errorsService.GetError(codes.InvalidResetToken)
+	}
+
+	if err = s.checkPassword(ctx, log, user, password, codes.InvalidPassword, "$.password"); err != nil {
+		return err
+	}
+
+	return s.inTx(ctx, log, func(ctx context.Context) error {
+		if _, err := s.usersRepo.UseToken(ctx, resetToken.TokenHash, entity.TokenPasswordReset); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return s.errorsService.GetError(codes.InvalidResetToken)
+			}
+
+			log.Errorf("failed to use reset token: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		if err := s.changePassword(ctx, log, user, password); err != nil {
+			return err
+		}
+
+		if err := s.usersRepo.DeleteTokens(ctx, user.ID, entity.TokenPasswordReset); err != nil {
+			log.Errorf("failed to delete reset tokens: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		// a reset proves control of the email, which is what a locked account waits for
+		if err := s.usersRepo.UnlockUser(ctx, user.ID); err != nil {
+			log.Errorf("failed to unlock user: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		if err := s.throttle.Succeed(ctx, user.ID, ""); err != nil {
+			return err
+		}
+
+		if err := s.sessionsRepo.RevokeSessions(ctx, user.ID, 0); err != nil {
+			log.Errorf("failed to revoke sessions: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		return nil
+	})
+}
@@ -3,41 +3,124 @@ package users
 import (
 	"context"
 	"errors"
+	"strings"
+	"time"
 
-	"github.com/0x16F/cloud-common/pkg/generator"
 	"github.com/0x16F/cloud-common/pkg/logger"
 	"github.com/0x16F/cloud-users/internal/entity"
+	cerrors "github.com/0x16F/cloud-users/internal/usecase/errors"
 	"github.com/0x16F/cloud-users/pkg/codes"
 	"github.com/jackc/pgx/v5"
 )
 
+type Config struct {
+	PasswordResetTTL time.Duration `env:"PASSWORD_RESET_TTL" env-default:"1h"`
+	PasswordResetURL string        `env:"PASSWORD_RESET_URL" env-default:"http://localhost:8080/reset-password?token={token}"`
+
+	EmailVerificationTTL time.Duration `env:"EMAIL_VERIFICATION_TTL" env-default:"24h"`
+	EmailVerificationURL string        `env:"EMAIL_VERIFICATION_URL" env-default:"http://localhost:8080/verify-email?token={token}"`
+
+	EmailChangeTTL time.Duration `env:"EMAIL_CHANGE_TTL" env-default:"24h"`
+	EmailChangeURL string        `env:"EMAIL_CHANGE_URL" env-default:"http://localhost:8080/confirm-email?token={token}"`
+	EmailRevertTTL time.Duration `env:"EMAIL_REVERT_TTL" env-default:"72h"`
+	EmailRevertURL string        `env:"EMAIL_REVERT_URL" env-default:"http://localhost:8080/revert-email?token={token}"`
+}
+
 type UsersRepository interface {
 	CreateUser(ctx context.Context, user entity.User) (entity.User, error)
 	GetUser(ctx context.Context, id uint64) (entity.User, error)
+	GetUserProfile(ctx context.Context, id uint64) (entity.User, error)
+	GetUserWithDeleted(ctx context.Context, id uint64) (entity.User, error)
 	GetUserByEmail(ctx context.Context, email string) (entity.User, error)
 	GetUserByUsername(ctx context.Context, username string) (entity.User, error)
 	GetUsers(ctx context.Context, params entity.GetUsersParams) ([]entity.User, error)
-	UpdateEmail(ctx context.Context, id uint64, email string) error
+	SetPendingEmail(ctx context.Context, id uint64, email string, expiresAt time.Time) error
+	ConfirmEmail(ctx context.Context, id uint64, email string) (bool, error)
+	RevertEmail(ctx context.Context, id uint64, email string) error
+	UnlockUser(ctx context.Context, id uint64) error
 	UpdateUsername(ctx context.Context, id uint64, username string) error
-	UpdatePassword(ctx context.Context, id uint64, password string, salt string) error
+	UpdatePassword(ctx context.Context, id uint64, password string) error
+	VerifyEmail(ctx context.Context, id uint64) error
 	DeleteUser(ctx context.Context, id uint64) error
+	RestoreUser(ctx context.Context, id uint64) (entity.User, error)
+	CreateToken(ctx context.Context, token entity.UserToken) error
+	GetToken(ctx context.Context, tokenHash string, purpose string) (entity.UserToken, error)
+	UseToken(ctx context.Context, tokenHash string, purpose string) (entity.UserToken, error)
+	DeleteTokens(ctx context.Context, userID uint64, purpose string) error
 }
 
 type ErrorsService interface {
 	GetError(code int) error
+	GetFieldsError(code int, fields []cerrors.FieldError) error
+}
+
+// Transactor runs fn in a transaction that the repositories join through the
+// context passed to fn.
+type Transactor interface {
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type SessionsRepository interface {
+	RevokeSessions(ctx context.Context, userID uint64, exceptID uint64) error
+}
+
+type PasswordsService interface {
+	Hash(password string) (string, error)
+	Verify(password string, user entity.User) (bool, bool, error)
+	Normalize(cfg entity.PasswordHashConfig, hash string, salt string) (string, error)
+}
+
+type PasswordPolicy interface {
+	Check(ctx context.Context, user entity.User, password string) error
+	Remember(ctx context.Context, user entity.User) error
+}
+
+type Throttle interface {
+	Check(ctx context.Context, userID uint64, ip string) error
+	Fail(ctx context.Context, userID uint64, ip string) error
+	Succeed(ctx context.Context, userID uint64, ip string) error
+}
+
+type Mailer interface {
+	Send(ctx context.Context, mail entity.Mail) error
 }
 
 type Service struct {
-	log           logger.Logger
-	usersRepo     UsersRepository
-	errorsService ErrorsService
+	log              logger.Logger
+	cfg              Config
+	usersRepo        UsersRepository
+	sessionsRepo     SessionsRepository
+	transactor       Transactor
+	errorsService    ErrorsService
+	passwordsService PasswordsService
+	passwordPolicy   PasswordPolicy
+	throttle         Throttle
+	mailer           Mailer
 }
 
-func New(log logger.Logger, usersRepo UsersRepository, errorsService ErrorsService) *Service {
+func New(
+	log logger.Logger,
+	cfg Config,
+	usersRepo UsersRepository,
+	sessionsRepo SessionsRepository,
+	transactor Transactor,
+	errorsService ErrorsService,
+	passwordsService PasswordsService,
+	passwordPolicy PasswordPolicy,
+	throttle Throttle,
+	mailer Mailer,
+) *Service {
 	return &Service{
-		log:           log,
-		usersRepo:     usersRepo,
-		errorsService: errorsService,
+		log:              log,
+		cfg:              cfg,
+		usersRepo:        usersRepo,
+		sessionsRepo:     sessionsRepo,
+		transactor:       transactor,
+		errorsService:    errorsService,
+		passwordsService: passwordsService,
+		passwordPolicy:   passwordPolicy,
+		throttle:         throttle,
+		mailer:           mailer,
 	}
 }
 
@@ -46,37 +129,63 @@ func (s *Service) CreateUser(ctx context.Context, dto entity.UserCreateDTO) (ent
 		"method": "CreateUser",
 	})
 
-	user, err := s.usersRepo.GetUserByEmail(ctx, dto.Email)
-	if err != nil && errors.Is(err, s.errorsService.GetError(codes.InternalError)) {
-		log.Errorf("failed to get user by email: %v", err)
-
+	if err := s.checkPassword(ctx, log, entity.NewUser(dto, ""), dto.Password, codes.InvalidPassword, "$.password"); err != nil {
 		return entity.User{}, err
 	}
 
-	if user.ID != 0 {
-		return entity.User{}, s.errorsService.GetError(codes.EmailAlreadyExists)
-	}
-
-	user, err = s.usersRepo.GetUserByUsername(ctx, dto.Username)
-	if err != nil && errors.Is(err, s.errorsService.GetError(codes.InternalError)) {
-		log.Errorf("failed to get user by username: %v", err)
-
-		return entity.User{}, err
-	}
+	hash, err := s.passwordsService.Hash(dto.Password)
+	if err != nil {
+		log.Errorf("failed to hash password: %v", err)
 
-	if user.ID != 0 {
-		return entity.User{}, s.errorsService.GetError(codes.UsernameAlreadyExists)
+		return entity.User{}, s.errorsService.GetError(codes.InternalError)
 	}
 
-	user, err = s.usersRepo.CreateUser(ctx, entity.NewUser(dto))
+	user, err := s.usersRepo.CreateUser(ctx, entity.NewUser(dto, hash))
 	if err != nil {
+		if conflict := s.conflictError(err); conflict != nil {
+			return entity.User{}, conflict
+		}
+
 		log.Errorf("failed to create user: %v", err)
 
 		return entity.User{}, s.errorsService.GetError(codes.InternalError)
 	}
 
+	// the account is usable without a verified email, so a failed mail only gets logged
+	if err = s.sendVerificationEmail(ctx, log, user); err != nil {
+		log.Errorf("failed to send verification email: %v", err)
+	}
+
 	return user, nil
+}
+
+// conflictError returns the domain error of a unique violation reported by the
+// repository, or nil for any other error.
+func (s *Service) conflictError(err error) error {
+	switch {
+	case errors.Is(err, entity.ErrEmailAlreadyExists):
+		return s.errorsService.GetError(codes.EmailAlreadyExists)
+	case errors.Is(err, entity.ErrUsernameAlreadyExists):
+		return s.errorsService.GetError(codes.UsernameAlreadyExists)
+	}
+
+	return nil
+}
+
+// inTx runs fn in a transaction. fn returns catalog errors, so any other error
+// comes from the transaction itself.
+func (s *Service) inTx(ctx context.Context, log logger.Logger, fn func(ctx context.Context) error) error {
+	err := s.transactor.WithTx(ctx, fn)
+
+	var ce *cerrors.Error
+
+	if err != nil && !errors.As(err, &ce) {
+		log.Errorf("failed to run transaction: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
 
+	return err
 }
 
 func (s *Service) GetUser(ctx context.Context, id uint64) (entity.User, error) {
@@ -98,12 +207,54 @@ func (s *Service) GetUser(ctx context.Context, id uint64) (entity.User, error) {
 	return user, nil
 }
 
+// GetUserProfile returns the user for showing it. It reads a replica that may lag
+// behind, use GetUser for anything that decides about access.
+func (s *Service) GetUserProfile(ctx context.Context, id uint64) (entity.User, error) {
+	log := s.log.WithFields(logger.Fields{
+		"method": "GetUserProfile",
+	})
+
+	user, err := s.usersRepo.GetUserProfile(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.User{}, s.errorsService.GetError(codes.UserNotFound)
+		}
+
+		log.Errorf("failed to get user profile: %v", err)
+
+		return entity.User{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	return user, nil
+}
+
+// GetUserWithDeleted returns the user even if it is deleted, as long as it was not
+// purged.
+func (s *Service) GetUserWithDeleted(ctx context.Context, id uint64) (entity.User, error) {
+	log := s.log.WithFields(logger.Fields{
+		"method": "GetUserWithDeleted",
+	})
+
+	user, err := s.usersRepo.GetUserWithDeleted(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.User{}, s.errorsService.GetError(codes.UserNotFound)
+		}
+
+		log.Errorf("failed to get user with deleted: %v", err)
+
+		return entity.User{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	return user, nil
+}
+
 func (s *Service) GetUserByEmail(ctx context.Context, email string) (entity.User, error) {
 	log := s.log.WithFields(logger.Fields{
 		"method": "GetUserByEmail",
 	})
 
-	user, err := s.usersRepo.GetUserByEmail(ctx, email)
+	user, err := s.usersRepo.GetUserByEmail(ctx, entity.NormalizeEmail(email))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return entity.User{}, s.errorsService.GetError(codes.UserNotFound)
@@ -122,7 +273,7 @@ func (s *Service) GetUserByUsername(ctx context.Context, username string) (entit
 		"method": "GetUserByUsername",
 	})
 
-	user, err := s.usersRepo.GetUserByUsername(ctx, username)
+	user, err := s.usersRepo.GetUserByUsername(ctx, entity.NormalizeUsername(username))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return entity.User{}, s.errorsService.GetError(codes.UserNotFound)
@@ -141,6 +292,9 @@ func (s *Service) GetUsers(ctx context.Context, params entity.GetUsersParams) ([
 		"method": "GetUsers",
 	})
 
+	params.Email = entity.NormalizeEmail(params.Email)
+	params.Username = entity.NormalizeUsername(params.Username)
+
 	users, err := s.usersRepo.GetUsers(ctx, params)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -155,73 +309,143 @@ func (s *Service) GetUsers(ctx context.Context, params entity.GetUsersParams) ([
 	return users, nil
 }
 
-func (s *Service) UpdateEmail(ctx context.Context, id uint64, email string) error {
+func (s *Service) UpdateUsername(ctx context.Context, id uint64, username string) error {
 	log := s.log.WithFields(logger.Fields{
-		"method": "UpdateEmail",
+		"method": "UpdateUsername",
 	})
 
-	user, err := s.GetUserByEmail(ctx, email)
-	if err != nil && errors.Is(err, s.errorsService.GetError(codes.InternalError)) {
-		log.Errorf("failed to get user by email: %v", err)
+	if err := s.usersRepo.UpdateUsername(ctx, id, entity.NormalizeUsername(username)); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s.errorsService.GetError(codes.UserNotFound)
+		}
 
-		return err
+		if conflict := s.conflictError(err); conflict != nil {
+			return conflict
+		}
+
+		log.Errorf("failed to update username: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
 	}
 
-	if user.ID != 0 {
-		return s.errorsService.GetError(codes.EmailAlreadyExists)
+	return nil
+}
+
+// checkPassword applies the password policy. A violation is returned as the error
+// of code, naming the failed rule for the field at path.
+func (s *Service) checkPassword(
+	ctx context.Context,
+	log logger.Logger,
+	user entity.User,
+	password string,
+	code int,
+	path string,
+) error {
+	err := s.passwordPolicy.Check(ctx, user, password)
+	if err == nil {
+		return nil
 	}
 
-	if _, err = s.GetUser(ctx, id); err != nil {
-		log.Errorf("failed to get user: %v", err)
+	var violation *entity.PasswordPolicyError
 
-		return err
+	if errors.As(err, &violation) {
+		return s.errorsService.GetFieldsError(code, []cerrors.FieldError{{
+			Path:    path,
+			Code:    code,
+			Rule:    violation.Rule,
+			Message: violation.Message,
+		}})
 	}
 
-	if err = s.usersRepo.UpdateEmail(ctx, id, email); err != nil {
-		log.Errorf("failed to update email: %v", err)
+	log.Errorf("failed to check password policy: %v", err)
+
+	return s.errorsService.GetError(codes.InternalError)
+}
+
+// changePassword stores the hash of a password that passed the policy and keeps the
+// replaced one in the password history.
+func (s *Service) changePassword(ctx context.Context, log logger.Logger, user entity.User, password string) error {
+	hash, err := s.passwordsService.Hash(password)
+	if err != nil {
+		log.Errorf("failed to hash password: %v", err)
 
 		return s.errorsService.GetError(codes.InternalError)
 	}
 
-	return nil
+	return s.inTx(ctx, log, func(ctx context.Context) error {
+		if err := s.passwordPolicy.Remember(ctx, user); err != nil {
+			log.Errorf("failed to remember password: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		if err := s.usersRepo.UpdatePassword(ctx, user.ID, hash); err != nil {
+			log.Errorf("failed to update password: %v", err)
+
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		return nil
+	})
 }
 
-func (s *Service) UpdateUsername(ctx context.Context, id uint64, username string) error {
+// VerifyPassword checks the current password of the user. Failures are throttled
+// like failed logins.
+func (s *Service) VerifyPassword(ctx context.Context, id uint64, password string, ip string) error {
 	log := s.log.WithFields(logger.Fields{
-		"method": "UpdateUsername",
+		"method": "VerifyPassword",
 	})
 
-	user, err := s.usersRepo.GetUserByUsername(ctx, username)
-	if err != nil && errors.Is(err, s.errorsService.GetError(codes.InternalError)) {
-		log.Errorf("failed to get user by username: %v", err)
+	user, err := s.GetUser(ctx, id)
+	if err != nil {
+		log.Errorf("failed to get user: %v", err)
 
 		return err
 	}
 
-	if user.ID != 0 {
-		return s.errorsService.GetError(codes.UsernameAlreadyExists)
+	if err = s.throttle.Check(ctx, user.ID, ip); err != nil {
+		return err
 	}
 
-	if _, err = s.GetUser(ctx, id); err != nil {
-		log.Errorf("failed to get user: %v", err)
+	ok, _, err := s.passwordsService.Verify(password, user)
+	if err != nil {
+		log.Errorf("failed to verify password: %v", err)
 
-		return err
+		return s.errorsService.GetError(codes.InternalError)
 	}
 
-	if err = s.usersRepo.UpdateUsername(ctx, id, username); err != nil {
-		log.Errorf("failed to update username: %v", err)
+	if !ok {
+		if err = s.throttle.Fail(ctx, user.ID, ip); err != nil {
+			return err
+		}
 
-		return s.errorsService.GetError(codes.InternalError)
+		return s.errorsService.GetError(codes.InvalidPassword)
 	}
 
-	return nil
+	return s.throttle.Succeed(ctx, user.ID, ip)
 }
 
-func (s *Service) UpdatePassword(ctx context.Context, id uint64, oldPassword string, newPassword string) error {
+// UpdatePassword changes the password and revokes every session of the user except the current one.
+func (s *Service) UpdatePassword(
+	ctx context.Context,
+	id uint64,
+	oldPassword string,
+	newPassword string,
+	sessionID uint64,
+	ip string,
+) error {
 	log := s.log.WithFields(logger.Fields{
 		"method": "UpdatePassword",
 	})
 
+	if err := s.VerifyPassword(ctx, id, oldPassword, ip); err != nil {
+		if errors.Is(err, s.errorsService.GetError(codes.InvalidPassword)) {
+			return s.errorsService.GetError(codes.InvalidOldPassword)
+		}
+
+		return err
+	}
+
 	user, err := s.GetUser(ctx, id)
 	if err != nil {
 		log.Errorf("failed to get user: %v", err)
@@ -229,20 +453,108 @@ func (s *Service) UpdatePassword(ctx context.Context, id uint64, oldPassword str
 		return err
 	}
 
-	if ok := user.ValidatePassword(oldPassword); !ok {
-		return s.errorsService.GetError(codes.InvalidOldPassword)
+	if err = s.checkPassword(ctx, log, user, newPassword, codes.InvalidNewPassword, "$.new_password"); err != nil {
+		return err
 	}
 
-	salt := generator.NewString(entity.SaltLength)
-	hash := generator.NewHash(newPassword, salt)
+	return s.inTx(ctx, log, func(ctx context.Context) error {
+		if err := s.changePassword(ctx, log, user, newPassword); err != nil {
+			return err
+		}
 
-	if err = s.usersRepo.UpdatePassword(ctx, id, hash, salt); err != nil {
-		log.Errorf("failed to update password: %v", err)
+		if err := s.sessionsRepo.RevokeSessions(ctx, id, sessionID); err != nil {
+			log.Errorf("failed to revoke sessions: %v", err)
 
-		return s.errorsService.GetError(codes.InternalError)
+			return s.errorsService.GetError(codes.InternalError)
+		}
+
+		return nil
+	})
+}
+
+// Login checks the credentials of a user. Failed attempts are counted for the
+// account and the client IP, both are throttled once they fail too often.
+func (s *Service) Login(ctx context.Context, login string, password string, ip string) (entity.User, error) {
+	log := s.log.WithFields(logger.Fields{
+		"method": "Login",
+	})
+
+	var (
+		user entity.User
+		err  error
+	)
+
+	if strings.Contains(login, "@") {
+		user, err = s.GetUserByEmail(ctx, login)
+	} else {
+		user, err = s.GetUserByUsername(ctx, login)
 	}
 
-	return nil
+	if err != nil && !errors.Is(err, s.errorsService.GetError(codes.UserNotFound)) {
+		log.Errorf("failed to get user: %v", err)
+
+		return entity.User{}, err
+	}
+
+	// an unknown login has no account to count against, only the IP is throttled
+	if err = s.throttle.Check(ctx, user.ID, ip); err != nil {
+		return entity.User{}, err
+	}
+
+	if user.ID == 0 {
+		// hash anyway so that unknown logins take as long as wrong passwords
+		_, _ = s.passwordsService.Hash(password)
+
+		return entity.User{}, s.failLogin(ctx, 0, ip)
+	}
+
+	ok, rehash, err := s.passwordsService.Verify(password, user)
+	if err != nil {
+		log.Errorf("failed to verify password: %v", err)
+
+		return entity.User{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	if user.IsDeleted() || !ok {
+		return entity.User{}, s.failLogin(ctx, user.ID, ip)
+	}
+
+	if err = s.throttle.Succeed(ctx, user.ID, ip); err != nil {
+		return entity.User{}, err
+	}
+
+	if user.IsLocked() {
+		return entity.User{}, s.errorsService.GetError(codes.AccountLocked)
+	}
+
+	if rehash {
+		s.rehashPassword(ctx, log, user, password)
+	}
+
+	return user, nil
+}
+
+func (s *Service) failLogin(ctx context.Context, userID uint64, ip string) error {
+	if err := s.throttle.Fail(ctx, userID, ip); err != nil {
+		return err
+	}
+
+	return s.errorsService.GetError(codes.InvalidCredentials)
+}
+
+// rehashPassword upgrades the stored hash to the configured algorithm. Failures are
+// only logged since the password itself has already been verified.
+func (s *Service) rehashPassword(ctx context.Context, log logger.Logger, user entity.User, password string) {
+	hash, err := s.passwordsService.Hash(password)
+	if err != nil {
+		log.Errorf("failed to rehash password: %v", err)
+
+		return
+	}
+
+	if err = s.usersRepo.UpdatePassword(ctx, user.ID, hash); err != nil {
+		log.Errorf("failed to update rehashed password: %v", err)
+	}
 }
 
 func (s *Service) DeleteUser(ctx context.Context, id uint64) error {
@@ -251,6 +563,10 @@ func (s *Service) DeleteUser(ctx context.Context, id uint64) error {
 	})
 
 	if err := s.usersRepo.DeleteUser(ctx, id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s.errorsService.GetError(codes.UserNotFound)
+		}
+
 		log.Errorf("failed to delete user: %v", err)
 
 		return s.errorsService.GetError(codes.InternalError)
@@ -258,3 +574,28 @@ func (s *Service) DeleteUser(ctx context.Context, id uint64) error {
 
 	return nil
 }
+
+// RestoreUser undoes the deletion of a user that was not purged yet. It fails if
+// another user took the email or the username in the meantime.
+func (s *Service) RestoreUser(ctx context.Context, id uint64) (entity.User, error) {
+	log := s.log.WithFields(logger.Fields{
+		"method": "RestoreUser",
+	})
+
+	user, err := s.usersRepo.RestoreUser(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.User{}, s.errorsService.GetError(codes.UserNotFound)
+		}
+
+		if conflict := s.conflictError(err); conflict != nil {
+			return entity.User{}, conflict
+		}
+
+		log.Errorf("failed to restore user: %v", err)
+
+		return entity.User{}, s.errorsService.GetError(codes.InternalError)
+	}
+
+	return user, nil
+}
@@ -0,0 +1,277 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo/memory"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo/repotest"
+	"github.com/0x16F/cloud-users/internal/infrastructure/repo/sessions"
+	usersRepo "github.com/0x16F/cloud-users/internal/infrastructure/repo/users"
+	cerrors "github.com/0x16F/cloud-users/internal/usecase/errors"
+	"github.com/0x16F/cloud-users/internal/usecase/passwords"
+	"github.com/0x16F/cloud-users/pkg/codes"
+)
+
+// the number of requests that race for the same email
+const racers = 16
+
+type plainPasswords struct{}
+
+func (plainPasswords) Hash(password string) (string, error) {
+	return "plain:" + password, nil
+}
+
+func (plainPasswords) Verify(password string, user entity.User) (bool, bool, error) {
+	return user.Password == "plain:"+password, false, nil
+}
+
+func (plainPasswords) Normalize(cfg entity.PasswordHashConfig, hash string, salt string) (string, error) {
+	return hash, nil
+}
+
+type allowPasswords struct{}
+
+func (allowPasswords) Check(ctx context.Context, user entity.User, password string) error {
+	return nil
+}
+
+func (allowPasswords) Remember(ctx context.Context, user entity.User) error {
+	return nil
+}
+
+type noThrottle struct{}
+
+func (noThrottle) Check(ctx context.Context, userID uint64, ip string) error {
+	return nil
+}
+
+func (noThrottle) Fail(ctx context.Context, userID uint64, ip string) error {
+	return nil
+}
+
+func (noThrottle) Succeed(ctx context.Context, userID uint64, ip string) error {
+	return nil
+}
+
+type discardMailer struct{}
+
+func (discardMailer) Send(ctx context.Context, mail entity.Mail) error {
+	return nil
+}
+
+// newService returns the service on an empty store of the driver.
+func newService(t *testing.T, driver string) *Service {
+	t.Helper()
+
+	log := logger.New("error")
+
+	errorsService, err := cerrors.New(log, "", "en")
+	if err != nil {
+		t.Fatalf("failed to load errors: %v", err)
+	}
+
+	var (
+		users      UsersRepository
+		sessionsDB SessionsRepository
+		transactor Transactor
+	)
+
+	switch driver {
+	case repo.DriverMemory:
+		db := memory.NewDB()
+		users, sessionsDB, transactor = db, db, db
+	case repo.DriverSQLite:
+		db := repotest.SQLite(t)
+		users, sessionsDB, transactor = usersRepo.NewRepo(db, db), sessions.NewRepo(db), db
+	case repo.DriverPostgres:
+		db := repotest.Postgres(t)
+		users, sessionsDB, transactor = usersRepo.NewRepo(db, db), sessions.NewRepo(db), db
+	}
+
+	cfg := Config{
+		EmailVerificationTTL: time.Hour,
+		EmailChangeTTL:       time.Hour,
+	}
+
+	return New(
+		log,
+		cfg,
+		users,
+		sessionsDB,
+		transactor,
+		errorsService,
+		plainPasswords{},
+		allowPasswords{},
+		nil,
+		discardMailer{},
+	)
+}
+
+// TestEmailRace claims the same email from concurrent requests. The store decides
+// the winner, every other request has to fail with EmailAlreadyExists rather than
+// an internal error.
+func TestEmailRace(t *testing.T) {
+	const email = "taken@example.com"
+
+	tests := []struct {
+		name string
+		// prepare runs before the race, claim runs in it for each racer
+		prepare func(t *testing.T, s *Service, racer int) uint64
+		claim   func(ctx context.Context, s *Service, racer int, id uint64) error
+	}{
+		{
+			name: "create user",
+			prepare: func(t *testing.T, s *Service, racer int) uint64 {
+				return 0
+			},
+			claim: func(ctx context.Context, s *Service, racer int, _ uint64) error {
+				_, err := s.CreateUser(ctx, entity.UserCreateDTO{
+					Email:    email,
+					Username: fmt.Sprintf("user%d", racer),
+					Password: "password",
+				})
+
+				return err
+			},
+		},
+		{
+			name: "update email",
+			prepare: func(t *testing.T, s *Service, racer int) uint64 {
+				user, err := s.CreateUser(context.Background(), entity.UserCreateDTO{
+					Email:    fmt.Sprintf("user%d@example.com", racer),
+					Username: fmt.Sprintf("user%d", racer),
+					Password: "password",
+				})
+				if err != nil {
+					t.Fatalf("failed to create user: %v", err)
+				}
+
+				return user.ID
+			},
+			claim: func(ctx context.Context, s *Service, _ int, id uint64) error {
+				return s.UpdateEmail(ctx, id, email)
+			},
+		},
+	}
+
+	for _, driver := range []string{repo.DriverMemory, repo.DriverSQLite, repo.DriverPostgres} {
+		t.Run(driver, func(t *testing.T) {
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					s := newService(t, driver)
+
+					ids := make([]uint64, racers)
+
+					for i := range ids {
+						ids[i] = tt.prepare(t, s, i)
+					}
+
+					var (
+						wg    sync.WaitGroup
+						start = make(chan struct{})
+						errs  = make([]error, racers)
+					)
+
+					for i := range ids {
+						wg.Add(1)
+
+						go func() {
+							defer wg.Done()
+
+							<-start
+
+							errs[i] = tt.claim(context.Background(), s, i, ids[i])
+						}()
+					}
+
+					close(start)
+					wg.Wait()
+
+					won := 0
+
+					for i, err := range errs {
+						var ce *cerrors.Error
+
+						switch {
+						case err == nil:
+							won++
+						case !errors.As(err, &ce) || ce.Code != codes.EmailAlreadyExists:
+							t.Errorf("racer %d: got %v, want EmailAlreadyExists", i, err)
+						}
+					}
+
+					if won != 1 {
+						t.Errorf("got %d requests that claimed the email, want 1", won)
+					}
+				})
+			}
+		})
+	}
+}
+
+// TestLoginRehashesLegacyHash logs in with a bcrypt hash, which is replaced with a
+// hash of the configured algorithm.
+func TestLoginRehashesLegacyHash(t *testing.T) {
+	log := logger.New("error")
+	ctx := context.Background()
+
+	errorsService, err := cerrors.New(log, "", "en")
+	if err != nil {
+		t.Fatalf("failed to load errors: %v", err)
+	}
+
+	passwordsService, err := passwords.New(passwords.Config{
+		Algorithm:         passwords.AlgorithmArgon2id,
+		Argon2Memory:      64,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+	})
+	if err != nil {
+		t.Fatalf("failed to create passwords service: %v", err)
+	}
+
+	hash, err := passwords.NewBcrypt(4).Hash("password")
+	if err != nil {
+		t.Fatalf("failed to hash: %v", err)
+	}
+
+	db := memory.NewDB()
+
+	legacy, err := db.CreateUser(ctx, entity.User{
+		Email:    "alice@example.com",
+		Username: "alice",
+		Password: hash,
+	})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	s := New(log, Config{}, db, db, db, errorsService, passwordsService, allowPasswords{}, noThrottle{}, discardMailer{})
+
+	if _, err = s.Login(ctx, "alice", "password", "192.0.2.1"); err != nil {
+		t.Fatalf("failed to log in: %v", err)
+	}
+
+	user, err := db.GetUser(ctx, legacy.ID)
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+
+	if !strings.HasPrefix(user.Password, "$argon2id$") {
+		t.Errorf("got hash %q, want an argon2id hash", user.Password)
+	}
+
+	// the new hash works for the next login
+	if _, err = s.Login(ctx, "alice", "password", "192.0.2.1"); err != nil {
+		t.Errorf("failed to log in with the new hash: %v", err)
+	}
+}
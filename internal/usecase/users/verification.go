@@ -0,0 +1,103 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/0x16F/cloud-common/pkg/logger"
+	"github.com/0x16F/cloud-users/internal/entity"
+	"github.com/0x16F/cloud-users/pkg/codes"
+	"github.com/0x16F/cloud-users/pkg/secret"
+	"github.com/jackc/pgx/v5"
+)
+
+// SendVerificationEmail mails a new verification link to the user. Links sent
+// before stop working.
+func (s *Service) SendVerificationEmail(ctx context.Context, id uint64) error {
+	log := s.log.WithFields(logger.Fields{
+		"method": "SendVerificationEmail",
+	})
+
+	user, err := s.GetUser(ctx, id)
+	if err != nil {
+		log.Errorf("failed to get user: %v", err)
+
+		return err
+	}
+
+	if user.IsEmailVerified() {
+		return s.errorsService.GetError(codes.EmailAlreadyVerified)
+	}
+
+	return s.sendVerificationEmail(ctx, log, user)
+}
+
+// VerifyEmail marks the email the token was sent to as verified.
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	log := s.log.WithFields(logger.Fields{
+		"method": "VerifyEmail",
+	})
+
+	verificationToken, err := s.usersRepo.UseToken(ctx, secret.Hash(token), entity.TokenEmailVerification)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s.errorsService.GetError(codes.InvalidVerificationToken)
+		}
+
+		log.Errorf("failed to use verification token: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
+
+	user, err := s.GetUser(ctx, verificationToken.UserID)
+	if err != nil {
+		log.Errorf("failed to get user: %v", err)
+
+		return err
+	}
+
+	if user.IsDeleted() {
+		return s.errorsService.GetError(codes.InvalidVerificationToken)
+	}
+
+	if err = s.usersRepo.VerifyEmail(ctx, user.ID); err != nil {
+		log.Errorf("failed to verify email: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
+
+	if err = s.usersRepo.DeleteTokens(ctx, user.ID, entity.TokenEmailVerification); err != nil {
+		log.Errorf("failed to delete verification tokens: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
+
+	return nil
+}
+
+func (s *Service) sendVerificationEmail(ctx context.Context, log logger.Logger, user entity.User) error {
+	if err := s.usersRepo.DeleteTokens(ctx, user.ID, entity.TokenEmailVerification); err != nil {
+		log.Errorf("failed to delete verification tokens: %v", err)
+
+		return s.errorsService.GetError(codes.InternalError)
+	}
+
+	plain, err := s.issueToken(ctx, log, user.ID, entity.TokenEmailVerification, "", s.cfg.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	s.sendMail(log, entity.Mail{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nUse the link below to verify your email address. It expires in %s.\n\n%s\n",
+			user.Username,
+			s.cfg.EmailVerificationTTL,
+			tokenURL(s.cfg.EmailVerificationURL, plain),
+		),
+	})
+
+	return nil
+}
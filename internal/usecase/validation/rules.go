@@ -0,0 +1,69 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/0x16F/cloud-users/internal/entity"
+)
+
+func emailRule(maxLength int) func(string) (string, string) {
+	return func(value string) (string, string) {
+		email := entity.NormalizeEmail(value)
+
+		if utf8.RuneCountInString(email) > maxLength {
+			return "max_length", fmt.Sprintf("must be at most %d characters long", maxLength)
+		}
+
+		// ParseAddress also accepts display names and angle brackets, only a bare
+		// address that parses back to itself is an email
+		address, err := mail.ParseAddress(email)
+		if err != nil || address.Address != email || address.Name != "" {
+			return "email", "must be a valid email address"
+		}
+
+		at := strings.LastIndex(email, "@")
+		if !strings.Contains(email[at+1:], ".") {
+			return "email", "must be a valid email address"
+		}
+
+		return "", ""
+	}
+}
+
+func usernameRule(minLength int, maxLength int) func(string) (string, string) {
+	return func(value string) (string, string) {
+		username := entity.NormalizeUsername(value)
+		length := utf8.RuneCountInString(username)
+
+		if length < minLength || length > maxLength {
+			return "length", fmt.Sprintf("must be between %d and %d characters long", minLength, maxLength)
+		}
+
+		for _, r := range username {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("._-", r) {
+				return "charset", "may only contain letters, digits, '.', '_' and '-'"
+			}
+		}
+
+		return "", ""
+	}
+}
+
+// passwordRule applies the rules of the password policy that don't need the user,
+// the rest are checked when the password is set.
+func passwordRule(policy PasswordPolicy) func(string) (string, string) {
+	return func(value string) (string, string) {
+		var violation *entity.PasswordPolicyError
+
+		if err := policy.Validate(value); errors.As(err, &violation) {
+			return violation.Rule, violation.Message
+		}
+
+		return "", ""
+	}
+}
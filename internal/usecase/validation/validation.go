@@ -0,0 +1,191 @@
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/0x16F/cloud-users/internal/usecase/errors"
+	"github.com/0x16F/cloud-users/pkg/codes"
+)
+
+const (
+	tagName  = "validate"
+	rootPath = "$"
+)
+
+type Config struct {
+	EmailMaxLength    int `env:"VALIDATION_EMAIL_MAX_LENGTH" env-default:"254"`
+	UsernameMinLength int `env:"VALIDATION_USERNAME_MIN_LENGTH" env-default:"3"`
+	UsernameMaxLength int `env:"VALIDATION_USERNAME_MAX_LENGTH" env-default:"32"`
+}
+
+type ErrorsService interface {
+	GetFieldsError(code int, fields []errors.FieldError) error
+}
+
+// PasswordPolicy checks the rules of the password policy that don't need the user.
+type PasswordPolicy interface {
+	Validate(password string) error
+}
+
+// rule checks a string field and returns the failed rule and why it failed, or an
+// empty message. The code is reported for every failure of a field carrying the rule.
+type rule struct {
+	code  int
+	check func(value string) (string, string)
+}
+
+// Service validates requests declaratively. String fields are tagged with a comma
+// separated list of rules, e.g. `validate:"required,email"`, nested structs and
+// slices are walked and reported by their JSON path.
+type Service struct {
+	errorsService ErrorsService
+	rules         map[string]rule
+}
+
+func New(cfg Config, passwordPolicy PasswordPolicy, errorsService ErrorsService) *Service {
+	return &Service{
+		errorsService: errorsService,
+		rules: map[string]rule{
+			"email": {
+				code:  codes.InvalidEmail,
+				check: emailRule(cfg.EmailMaxLength),
+			},
+			"username": {
+				code:  codes.InvalidUsername,
+				check: usernameRule(cfg.UsernameMinLength, cfg.UsernameMaxLength),
+			},
+			"password": {
+				code:  codes.InvalidPassword,
+				check: passwordRule(passwordPolicy),
+			},
+			"new_password": {
+				code:  codes.InvalidNewPassword,
+				check: passwordRule(passwordPolicy),
+			},
+		},
+	}
+}
+
+// Validate checks every tagged field of the request and returns a single
+// codes.ValidationFailed error listing all failing fields, or nil.
+func (s *Service) Validate(req any) error {
+	fields := s.validate(reflect.ValueOf(req), rootPath)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	return s.errorsService.GetFieldsError(codes.ValidationFailed, fields)
+}
+
+func (s *Service) validate(value reflect.Value, path string) []errors.FieldError {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+
+		value = value.Elem()
+	}
+
+	var fields []errors.FieldError
+
+	switch value.Kind() {
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			if field.Anonymous {
+				fields = append(fields, s.validate(value.Field(i), path)...)
+
+				continue
+			}
+
+			name := jsonName(field)
+			if name == "" {
+				continue
+			}
+
+			fieldPath := path + "." + name
+
+			if tag, ok := field.Tag.Lookup(tagName); ok && value.Field(i).Kind() == reflect.String {
+				if fieldError, failed := s.check(tag, value.Field(i).String(), fieldPath); failed {
+					fields = append(fields, fieldError)
+				}
+
+				continue
+			}
+
+			fields = append(fields, s.validate(value.Field(i), fieldPath)...)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			fields = append(fields, s.validate(value.Index(i), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+
+	return fields
+}
+
+// check applies the rules of the tag in order and reports the first failure. Empty
+// values only fail a required field, the other rules are skipped for them.
+func (s *Service) check(tag string, value string, path string) (errors.FieldError, bool) {
+	names := strings.Split(tag, ",")
+
+	code := codes.InvalidBody
+
+	for _, name := range names {
+		if r, ok := s.rules[name]; ok {
+			code = r.code
+
+			break
+		}
+	}
+
+	if strings.TrimSpace(value) == "" {
+		if required(names) {
+			return errors.FieldError{Path: path, Code: code, Rule: "required", Message: "is required"}, true
+		}
+
+		return errors.FieldError{}, false
+	}
+
+	for _, name := range names {
+		r, ok := s.rules[name]
+		if !ok {
+			continue
+		}
+
+		if failed, message := r.check(value); message != "" {
+			return errors.FieldError{Path: path, Code: r.code, Rule: failed, Message: message}, true
+		}
+	}
+
+	return errors.FieldError{}, false
+}
+
+func required(names []string) bool {
+	for _, name := range names {
+		if name == "required" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+
+	return name
+}
@@ -0,0 +1,2 @@
+-- +goose Up
+ALTER TABLE cd_users ALTER COLUMN salt DROP NOT NULL;
@@ -0,0 +1,2 @@
+-- +goose Up
+ALTER TABLE cd_users ADD COLUMN role VARCHAR(32) NOT NULL DEFAULT 'user';
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE cd_totp (
+    user_id INTEGER PRIMARY KEY REFERENCES cd_users (id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    confirmed_at TIMESTAMP NULL
+);
+
+CREATE TABLE cd_recovery_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES cd_users (id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP NULL
+);
+
+CREATE INDEX cd_recovery_codes_user_id_idx ON cd_recovery_codes (user_id);
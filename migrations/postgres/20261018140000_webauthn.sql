@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE cd_webauthn_credentials (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES cd_users (id) ON DELETE CASCADE,
+    name VARCHAR(64) NOT NULL DEFAULT '',
+    credential_id BYTEA NOT NULL UNIQUE,
+    public_key BYTEA NOT NULL,
+    attestation_type VARCHAR(32) NOT NULL DEFAULT '',
+    aaguid BYTEA NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    transports TEXT[] NOT NULL DEFAULT '{}',
+    backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+    backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+    clone_warning BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP NULL
+);
+
+CREATE INDEX cd_webauthn_credentials_user_id_idx ON cd_webauthn_credentials (user_id);
+
+CREATE TABLE cd_webauthn_ceremonies (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NULL REFERENCES cd_users (id) ON DELETE CASCADE,
+    purpose VARCHAR(16) NOT NULL,
+    data JSONB NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,2 @@
+-- +goose Up
+ALTER TABLE cd_users ADD COLUMN email_verified_at TIMESTAMP NULL;
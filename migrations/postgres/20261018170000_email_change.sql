@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE cd_users ADD COLUMN pending_email VARCHAR(255) NULL;
+ALTER TABLE cd_users ADD COLUMN locked_at TIMESTAMP NULL;
+
+ALTER TABLE cd_user_tokens ADD COLUMN payload TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- +goose Up
+ALTER TABLE cd_users ADD CONSTRAINT cd_users_pending_email_key UNIQUE (pending_email);
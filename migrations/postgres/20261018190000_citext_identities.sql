@@ -0,0 +1,9 @@
+-- +goose Up
+-- Existing rows that only differ in case make this migration fail. Run
+-- cmd/normalize first to find them.
+CREATE EXTENSION IF NOT EXISTS citext;
+
+ALTER TABLE cd_users
+    ALTER COLUMN email TYPE CITEXT,
+    ALTER COLUMN username TYPE CITEXT,
+    ALTER COLUMN pending_email TYPE CITEXT;
@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE cd_password_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES cd_users (id) ON DELETE CASCADE,
+    password VARCHAR(255) NOT NULL,
+    salt VARCHAR(10) NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX cd_password_history_user_id_idx ON cd_password_history (user_id, id DESC);
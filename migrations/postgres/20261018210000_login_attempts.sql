@@ -0,0 +1,7 @@
+-- +goose Up
+CREATE TABLE cd_login_attempts (
+    key VARCHAR(255) PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP NULL
+);
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Deleted users no longer hold their email and username, so the unique
+-- constraints only cover users that are not deleted.
+ALTER TABLE cd_users
+    DROP CONSTRAINT cd_users_email_key,
+    DROP CONSTRAINT cd_users_username_key,
+    DROP CONSTRAINT cd_users_pending_email_key,
+    ADD COLUMN purged_at TIMESTAMP NULL;
+
+CREATE UNIQUE INDEX cd_users_email_key ON cd_users (email) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX cd_users_username_key ON cd_users (username) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX cd_users_pending_email_key ON cd_users (pending_email) WHERE deleted_at IS NULL;
+CREATE INDEX cd_users_deleted_at_idx ON cd_users (deleted_at) WHERE deleted_at IS NOT NULL AND purged_at IS NULL;
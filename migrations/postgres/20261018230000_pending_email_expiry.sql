@@ -0,0 +1,17 @@
+-- +goose Up
+-- A pending email holds its address only until the change token expires. The
+-- pending emails of before take the expiry of their token, the ones without a
+-- token left can never be confirmed and are dropped.
+ALTER TABLE cd_users ADD COLUMN pending_email_expires_at TIMESTAMP NULL;
+
+UPDATE cd_users u
+SET pending_email_expires_at = (
+    SELECT MAX(t.expires_at)
+    FROM cd_user_tokens t
+    WHERE t.user_id = u.id AND t.purpose = 'email_change' AND t.used_at IS NULL
+)
+WHERE pending_email IS NOT NULL;
+
+UPDATE cd_users
+SET pending_email = NULL
+WHERE pending_email IS NOT NULL AND pending_email_expires_at IS NULL;
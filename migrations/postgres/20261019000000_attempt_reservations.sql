@@ -0,0 +1,5 @@
+-- +goose Up
+-- Attempts are counted when they are reserved, before the credentials are checked.
+-- The delay of an attempt runs from the one before it, which the reservation
+-- overwrites in last_failure_at.
+ALTER TABLE cd_login_attempts ADD COLUMN previous_failure_at TIMESTAMP NULL;
@@ -0,0 +1,119 @@
+-- +goose Up
+-- The schema of the Postgres migrations up to 20261018220000_soft_delete.sql.
+-- Timestamps are UTC text, which sorts like the times it stands for, and
+-- string arrays are JSON. Emails and usernames compare like CITEXT does.
+CREATE TABLE cd_users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email VARCHAR(255) NOT NULL COLLATE CITEXT,
+    username VARCHAR(255) NOT NULL COLLATE CITEXT,
+    password VARCHAR(255) NOT NULL,
+    salt VARCHAR(10) NULL,
+    role VARCHAR(32) NOT NULL DEFAULT 'user',
+    email_verified_at TIMESTAMP NULL,
+    pending_email VARCHAR(255) NULL COLLATE CITEXT,
+    locked_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    deleted_at TIMESTAMP NULL,
+    purged_at TIMESTAMP NULL
+);
+
+CREATE UNIQUE INDEX cd_users_email_key ON cd_users (email) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX cd_users_username_key ON cd_users (username) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX cd_users_pending_email_key ON cd_users (pending_email) WHERE deleted_at IS NULL;
+CREATE INDEX cd_users_deleted_at_idx ON cd_users (deleted_at) WHERE deleted_at IS NOT NULL AND purged_at IS NULL;
+
+CREATE TABLE cd_sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES cd_users (id) ON DELETE CASCADE,
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    last_used_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NULL
+);
+
+CREATE INDEX cd_sessions_user_id_idx ON cd_sessions (user_id);
+
+CREATE TABLE cd_refresh_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id INTEGER NOT NULL REFERENCES cd_sessions (id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    used_at TIMESTAMP NULL
+);
+
+CREATE TABLE cd_totp (
+    user_id INTEGER PRIMARY KEY REFERENCES cd_users (id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    confirmed_at TIMESTAMP NULL
+);
+
+CREATE TABLE cd_recovery_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES cd_users (id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP NULL
+);
+
+CREATE INDEX cd_recovery_codes_user_id_idx ON cd_recovery_codes (user_id);
+
+CREATE TABLE cd_webauthn_credentials (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES cd_users (id) ON DELETE CASCADE,
+    name VARCHAR(64) NOT NULL DEFAULT '',
+    credential_id BLOB NOT NULL UNIQUE,
+    public_key BLOB NOT NULL,
+    attestation_type VARCHAR(32) NOT NULL DEFAULT '',
+    aaguid BLOB NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    transports TEXT NOT NULL DEFAULT '[]',
+    backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+    backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+    clone_warning BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    last_used_at TIMESTAMP NULL
+);
+
+CREATE INDEX cd_webauthn_credentials_user_id_idx ON cd_webauthn_credentials (user_id);
+
+CREATE TABLE cd_webauthn_ceremonies (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NULL REFERENCES cd_users (id) ON DELETE CASCADE,
+    purpose VARCHAR(16) NOT NULL,
+    data BLOB NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE cd_user_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES cd_users (id) ON DELETE CASCADE,
+    purpose VARCHAR(32) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    payload TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL
+);
+
+CREATE INDEX cd_user_tokens_user_id_purpose_idx ON cd_user_tokens (user_id, purpose);
+
+CREATE TABLE cd_password_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES cd_users (id) ON DELETE CASCADE,
+    password VARCHAR(255) NOT NULL,
+    salt VARCHAR(10) NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE INDEX cd_password_history_user_id_idx ON cd_password_history (user_id, id DESC);
+
+CREATE TABLE cd_login_attempts (
+    key VARCHAR(255) PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP NULL
+);
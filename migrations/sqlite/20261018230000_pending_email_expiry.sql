@@ -0,0 +1,15 @@
+-- +goose Up
+-- See the Postgres migration of the same name.
+ALTER TABLE cd_users ADD COLUMN pending_email_expires_at TIMESTAMP NULL;
+
+UPDATE cd_users
+SET pending_email_expires_at = (
+    SELECT MAX(t.expires_at)
+    FROM cd_user_tokens t
+    WHERE t.user_id = cd_users.id AND t.purpose = 'email_change' AND t.used_at IS NULL
+)
+WHERE pending_email IS NOT NULL;
+
+UPDATE cd_users
+SET pending_email = NULL
+WHERE pending_email IS NOT NULL AND pending_email_expires_at IS NULL;
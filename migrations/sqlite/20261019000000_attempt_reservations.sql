@@ -0,0 +1,3 @@
+-- +goose Up
+-- See the Postgres migration of the same name.
+ALTER TABLE cd_login_attempts ADD COLUMN previous_failure_at TIMESTAMP NULL;
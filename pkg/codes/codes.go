@@ -1,17 +1,84 @@
 package codes
 
 const (
-	InvalidBody           = 1000
-	InvalidID             = 1001
-	InvalidEmail          = 1002
-	InvalidUsername       = 1003
-	InvalidPassword       = 1004
-	InvalidOldPassword    = 1005
-	InvalidNewPassword    = 1006
-	InternalError         = 1007
-	InvalidQuery          = 1008
-	UserNotFound          = 1009
-	EmailAlreadyExists    = 1010
-	UsernameAlreadyExists = 1011
-	FeatureIsDisabled     = 1012
+	InvalidBody                = 1000
+	InvalidID                  = 1001
+	InvalidEmail               = 1002
+	InvalidUsername            = 1003
+	InvalidPassword            = 1004
+	InvalidOldPassword         = 1005
+	InvalidNewPassword         = 1006
+	InternalError              = 1007
+	InvalidQuery               = 1008
+	UserNotFound               = 1009
+	EmailAlreadyExists         = 1010
+	UsernameAlreadyExists      = 1011
+	FeatureIsDisabled          = 1012
+	InvalidCredentials         = 1013
+	InvalidPasswordHash        = 1014
+	InvalidToken               = 1015
+	Unauthorized               = 1016
+	InvalidRefreshToken        = 1017
+	SessionNotFound            = 1018
+	InvalidOTPCode             = 1019
+	TOTPAlreadyEnabled         = 1020
+	TOTPNotEnabled             = 1021
+	InvalidMFAToken            = 1022
+	InvalidWebAuthnCeremony    = 1023
+	InvalidWebAuthnCredential  = 1024
+	WebAuthnCredentialNotFound = 1025
+	WebAuthnCredentialCloned   = 1026
+	WebAuthnNotEnabled         = 1027
+	InvalidResetToken          = 1028
+	EmailAlreadyVerified       = 1029
+	InvalidVerificationToken   = 1030
+	AccountLocked              = 1031
+	InvalidEmailChangeToken    = 1032
+	ValidationFailed           = 1033
+	TooManyAttempts            = 1034
+	Forbidden                  = 1035
 )
+
+// All returns every code above. The errors catalog must have an entry for each of
+// them, so a new code has to be added here as well. TestAll catches one that
+// isn't.
+func All() []int {
+	return []int{
+		InvalidBody,
+		InvalidID,
+		InvalidEmail,
+		InvalidUsername,
+		InvalidPassword,
+		InvalidOldPassword,
+		InvalidNewPassword,
+		InternalError,
+		InvalidQuery,
+		UserNotFound,
+		EmailAlreadyExists,
+		UsernameAlreadyExists,
+		FeatureIsDisabled,
+		InvalidCredentials,
+		InvalidPasswordHash,
+		InvalidToken,
+		Unauthorized,
+		InvalidRefreshToken,
+		SessionNotFound,
+		InvalidOTPCode,
+		TOTPAlreadyEnabled,
+		TOTPNotEnabled,
+		InvalidMFAToken,
+		InvalidWebAuthnCeremony,
+		InvalidWebAuthnCredential,
+		WebAuthnCredentialNotFound,
+		WebAuthnCredentialCloned,
+		WebAuthnNotEnabled,
+		InvalidResetToken,
+		EmailAlreadyVerified,
+		InvalidVerificationToken,
+		AccountLocked,
+		InvalidEmailChangeToken,
+		ValidationFailed,
+		TooManyAttempts,
+		Forbidden,
+	}
+}
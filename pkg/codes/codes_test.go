@@ -0,0 +1,75 @@
+package codes
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"testing"
+)
+
+// TestAll checks All against the constants declared in codes.go, so that a new code
+// can't be left out of it.
+func TestAll(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "codes.go", nil, 0)
+	if err != nil {
+		t.Fatalf("failed to parse codes.go: %v", err)
+	}
+
+	declared := make(map[string]int)
+
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			value := spec.(*ast.ValueSpec)
+
+			for i, name := range value.Names {
+				lit, ok := value.Values[i].(*ast.BasicLit)
+				if !ok || lit.Kind != token.INT {
+					t.Fatalf("%s is not an integer literal", name.Name)
+				}
+
+				code, err := strconv.Atoi(lit.Value)
+				if err != nil {
+					t.Fatalf("failed to parse %s: %v", name.Name, err)
+				}
+
+				declared[name.Name] = code
+			}
+		}
+	}
+
+	listed := make(map[int]bool)
+
+	for _, code := range All() {
+		if listed[code] {
+			t.Errorf("code %d is listed twice", code)
+		}
+
+		listed[code] = true
+	}
+
+	names := make(map[int]string)
+
+	for name, code := range declared {
+		if other, ok := names[code]; ok {
+			t.Errorf("%s and %s are both %d", name, other, code)
+		}
+
+		names[code] = name
+
+		if !listed[code] {
+			t.Errorf("%s (%d) is missing from All", name, code)
+		}
+	}
+
+	for code := range listed {
+		if _, ok := names[code]; !ok {
+			t.Errorf("code %d of All is not declared", code)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package secret
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+const (
+	length = 32
+)
+
+// New returns a random URL-safe secret together with the hash to store in its place.
+func New() (string, string, error) {
+	data := make([]byte, length)
+
+	if _, err := rand.Read(data); err != nil {
+		return "", "", err
+	}
+
+	plain := base64.RawURLEncoding.EncodeToString(data)
+
+	return plain, Hash(plain), nil
+}
+
+// Hash returns the hex encoded SHA-256 of a secret. Secrets carry enough entropy
+// that a fast hash is sufficient to store them.
+func Hash(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+
+	return hex.EncodeToString(sum[:])
+}
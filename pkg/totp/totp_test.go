@@ -0,0 +1,75 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 secret of RFC 6238, "12345678901234567890" in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// rfcVectors are the SHA-1 test vectors of RFC 6238, appendix B, cut from 8 to the
+// last 6 digits like the truncation of RFC 4226 does.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{unix: 59, code: "287082"},
+	{unix: 1111111109, code: "081804"},
+	{unix: 1111111111, code: "050471"},
+	{unix: 1234567890, code: "005924"},
+	{unix: 2000000000, code: "279037"},
+	{unix: 20000000000, code: "353130"},
+}
+
+func TestCode(t *testing.T) {
+	for _, tt := range rfcVectors {
+		code, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("failed to generate code: %v", err)
+		}
+
+		if code != tt.code {
+			t.Errorf("got code %s at %d, want %s", code, tt.unix, tt.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	tests := []struct {
+		name   string
+		secret string
+		at     time.Time
+		code   string
+		skew   int64
+		ok     bool
+	}{
+		{name: "current step", at: now, code: "050471", ok: true},
+		{name: "lowercase secret", secret: "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", at: now, code: "050471", ok: true},
+		{name: "previous step without skew", at: now.Add(period * time.Second), code: "050471"},
+		{name: "previous step with skew", at: now.Add(period * time.Second), code: "050471", skew: 1, ok: true},
+		{name: "two steps away", at: now.Add(2 * period * time.Second), code: "050471", skew: 1},
+		{name: "wrong code", at: now, code: "050472", skew: 1},
+		{name: "8 digits", at: now, code: "14050471", skew: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := tt.secret
+			if secret == "" {
+				secret = rfcSecret
+			}
+
+			step, ok := Validate(secret, tt.code, tt.at, tt.skew)
+			if ok != tt.ok {
+				t.Fatalf("got %t, want %t", ok, tt.ok)
+			}
+
+			if ok && step != Step(now) {
+				t.Errorf("got step %d, want %d", step, Step(now))
+			}
+		})
+	}
+}